@@ -0,0 +1,258 @@
+package npm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Add installs packages and saves them to the dependencies in dir/package.json
+// like `npm install <pkg>`. Remote packages are saved with a caret range of the
+// resolved version (e.g. ^4.17.21). The package.json is created if it doesn't
+// exist, otherwise its existing fields and formatting are kept.
+func Add(ctx context.Context, dir string, packages ...string) error {
+	return defaultInstaller.Add(ctx, dir, packages...)
+}
+
+// Add installs packages and saves them to the dependencies in dir/package.json.
+func (in *Installer) Add(ctx context.Context, dir string, packages ...string) error {
+	overrides, err := in.readOverrides(dir)
+	if err != nil {
+		return err
+	}
+	s := &session{
+		in:   in,
+		dir:  dir,
+		lock: newLockfile(dir),
+	}
+	defer s.removeStagingDir()
+	pkgs := make([]installable, len(packages))
+	deps := map[string]string{}
+	for i, pkgname := range packages {
+		// Default to the newest version when there's no version
+		if !isLocal(pkgname) && !isAbsolute(pkgname) && !strings.HasPrefix(pkgname, githubProtocol) && strings.LastIndex(pkgname, "@") <= 0 {
+			pkgname += "@*"
+		}
+		pkg, err := s.resolvePackage(ctx, pkgname)
+		if err != nil {
+			return err
+		}
+		switch p := pkg.(type) {
+		case *remotePackage:
+			if p.Alias != "" {
+				deps[p.Alias] = aliasProtocol + p.name() + "@^" + p.Version
+				break
+			}
+			deps[p.name()] = "^" + p.Version
+		case *localPackage:
+			// Workspace packages are saved with the workspace protocol, like npm
+			if spec, err := ParseSpec(pkgname); err == nil && spec.Type == SpecWorkspace {
+				deps[p.Name] = spec.Version
+				break
+			}
+			deps[p.Name] = packages[i]
+		case *localGlob:
+			for _, pkg := range p.Packages {
+				deps[pkg.Name] = localSpec(dir, pkg.Path)
+			}
+		}
+		pkgs[i] = pkg
+	}
+	eg := new(errgroup.Group)
+	for i, pkg := range pkgs {
+		eg.Go(func() error {
+			return s.installPackage(ctx, packages[i], pkg, 0, overrides.enterPackage(pkg))
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	// GitHub packages are saved under the name they were installed as, which
+	// is only known after installing
+	for _, pkg := range pkgs {
+		if p, ok := pkg.(*githubPackage); ok && p.name != "" {
+			deps[p.name] = p.String()
+		}
+	}
+	// Only save the packages once the install has succeeded
+	if err := s.finish(ctx); err != nil {
+		return err
+	}
+	return in.saveDependencies(filepath.Join(dir, "package.json"), deps)
+}
+
+// localSpec returns the spec to save for a local package in dir
+func localSpec(dir, pkgPath string) string {
+	rel, err := filepath.Rel(dir, pkgPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return pkgPath
+	}
+	return "./" + filepath.ToSlash(rel)
+}
+
+// saveDependencies adds the dependencies to the package.json, creating it if
+// it doesn't exist yet.
+func (in *Installer) saveDependencies(manifestPath string, deps map[string]string) error {
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("unable to read package.json: %w", err)
+		}
+		manifest = []byte("{}\n")
+	}
+	root := new(jsonObject)
+	if err := in.unmarshalManifest(manifest, root); err != nil {
+		return fmt.Errorf("unable to unmarshal package.json: %w", err)
+	}
+	dependencies := new(jsonObject)
+	if value, ok := root.Get("dependencies"); ok && string(value) != "null" {
+		if err := json.Unmarshal(value, dependencies); err != nil {
+			return fmt.Errorf("unable to unmarshal dependencies in package.json: %w", err)
+		}
+	}
+	for name, version := range deps {
+		value, err := marshalJSON(version)
+		if err != nil {
+			return err
+		}
+		dependencies.Set(name, value)
+	}
+	// npm keeps dependencies sorted
+	dependencies.Sort()
+	value, err := marshalJSON(dependencies)
+	if err != nil {
+		return err
+	}
+	root.Set("dependencies", value)
+	compact, err := marshalJSON(root)
+	if err != nil {
+		return err
+	}
+	out := new(bytes.Buffer)
+	if err := json.Indent(out, compact, "", detectIndent(manifest)); err != nil {
+		return fmt.Errorf("unable to indent package.json: %w", err)
+	}
+	out.WriteByte('\n')
+	if err := os.WriteFile(manifestPath, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to write package.json: %w", err)
+	}
+	return nil
+}
+
+// detectIndent returns the indentation used by the JSON, defaulting to two
+// spaces like npm.
+func detectIndent(data []byte) string {
+	for _, line := range bytes.Split(data, []byte("\n"))[1:] {
+		trimmed := bytes.TrimLeft(line, " \t")
+		if len(trimmed) > 0 && len(trimmed) < len(line) {
+			return string(line[:len(line)-len(trimmed)])
+		}
+	}
+	return "  "
+}
+
+// marshalJSON without escaping HTML characters, since they're common in
+// version ranges (e.g. >=1.0.0)
+func marshalJSON(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("unable to marshal json: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// jsonObject is a JSON object that remembers the order of its keys, so files
+// like package.json can be edited without shuffling them around.
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func (o *jsonObject) Get(key string) (json.RawMessage, bool) {
+	value, ok := o.values[key]
+	return value, ok
+}
+
+func (o *jsonObject) Set(key string, value json.RawMessage) {
+	if o.values == nil {
+		o.values = map[string]json.RawMessage{}
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Delete the key, returning true if it was there
+func (o *jsonObject) Delete(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (o *jsonObject) Sort() {
+	sort.Strings(o.keys)
+}
+
+func (o *jsonObject) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	} else if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected a json object but got %v", token)
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("expected a json object key but got %v", token)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		o.Set(key, value)
+	}
+	_, err = dec.Token()
+	return err
+}
+
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := marshalJSON(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(o.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,96 @@
+package npm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestAdd(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+		"uid@2.0.2": {},
+		"uid@3.0.0": {},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"^2.0.0"}}`,
+		},
+	}))
+	defer server.Close()
+	files := map[string]string{
+		"package.json": "{\n\t\"name\": \"app\",\n\t\"scripts\": {\n\t\t\"dev\": \"bud run\"\n\t},\n\t\"dependencies\": {\n\t\t\"preact\": \">=10.19.4\"\n\t},\n\t\"private\": true\n}\n",
+	}
+	is.NoErr(writeFiles(dir, files))
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	err := installer.Add(ctx, dir, "uid@^2", "@lukeed/uuid")
+	is.NoErr(err)
+	equals(t, filepath.Join(dir, "package.json"), "{\n\t\"name\": \"app\",\n\t\"scripts\": {\n\t\t\"dev\": \"bud run\"\n\t},\n\t\"dependencies\": {\n\t\t\"@lukeed/uuid\": \"^2.0.1\",\n\t\t\"preact\": \">=10.19.4\",\n\t\t\"uid\": \"^2.0.2\"\n\t},\n\t\"private\": true\n}\n")
+	exists(t, filepath.Join(dir, "node_modules", "uid", "package.json"))
+	exists(t, filepath.Join(dir, "node_modules", "@lukeed", "uuid", "package.json"))
+}
+
+func TestAddFailed(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"gpl@1.0.0": {
+			"package.json": `{"name":"gpl","version":"1.0.0","license":"GPL-3.0"}`,
+		},
+	}))
+	defer server.Close()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"name":"app"}`,
+	}))
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithLicensePolicy(&npm.LicensePolicy{Allow: []string{"MIT"}, Strict: true}))
+	err := installer.Add(context.Background(), dir, "gpl@1.0.0")
+	is.True(err != nil)
+	// The package.json is only saved once the install succeeds
+	equals(t, filepath.Join(dir, "package.json"), `{"name":"app"}`)
+}
+
+func TestAddCreatesPackageJSON(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"local/package.json": `{"name": "bud", "version": "1.0.0"}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	ctx := context.Background()
+	err := npm.Add(ctx, dir, "./local")
+	is.NoErr(err)
+	equals(t, filepath.Join(dir, "package.json"), "{\n  \"dependencies\": {\n    \"bud\": \"./local\"\n  }\n}\n")
+	exists(t, filepath.Join(dir, "node_modules", "bud", "package.json"))
+}
+
+func TestAddGitHub(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	repo, err := createTarball(map[string]string{
+		"package.json": `{"name":"foo","version":"1.0.0"}`,
+	})
+	is.NoErr(err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/user/foo/tarball", "/repos/user/foo/tarball/main":
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(repo)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	is.NoErr(writeFiles(dir, map[string]string{"package.json": "{}\n"}))
+	ctx := context.Background()
+	installer := npm.New(npm.WithGitHubAPI(server.URL))
+	is.NoErr(installer.Add(ctx, dir, "github:user/foo", "bar@github:user/foo#main"))
+	equals(t, filepath.Join(dir, "package.json"), "{\n  \"dependencies\": {\n    \"bar\": \"github:user/foo#main\",\n    \"foo\": \"github:user/foo\"\n  }\n}\n")
+	exists(t, filepath.Join(dir, "node_modules", "foo", "package.json"))
+	exists(t, filepath.Join(dir, "node_modules", "bar", "package.json"))
+}
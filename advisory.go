@@ -0,0 +1,134 @@
+package npm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Advisory warns about an installed package that's either deprecated or has a
+// known security vulnerability.
+type Advisory struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Deprecated is the deprecation message from the registry
+	Deprecated string `json:"deprecated,omitempty"`
+	// The remaining fields come from the registry's security advisories
+	ID                 int    `json:"id,omitempty"`
+	Title              string `json:"title,omitempty"`
+	URL                string `json:"url,omitempty"`
+	Severity           string `json:"severity,omitempty"`
+	VulnerableVersions string `json:"vulnerable_versions,omitempty"`
+}
+
+func (s *session) advise(advisory *Advisory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advisories = append(s.advisories, advisory)
+}
+
+// reportAdvisories looks up security advisories for everything that was
+// installed from the registry and reports them along with any deprecations.
+func (s *session) reportAdvisories(ctx context.Context) error {
+	if s.in.onAdvisory == nil {
+		return nil
+	}
+	installed := map[string][]string{}
+	s.lock.mu.Lock()
+	for key, pkg := range s.lock.Packages {
+		if pkg.Version == "" || strings.HasPrefix(pkg.Resolved, "file:") {
+			continue
+		}
+		name := key[strings.LastIndex(key, "node_modules/")+len("node_modules/"):]
+		installed[name] = append(installed[name], pkg.Version)
+	}
+	s.lock.mu.Unlock()
+	advisories, err := s.in.fetchAdvisories(ctx, installed)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	advisories = append(advisories, s.advisories...)
+	s.mu.Unlock()
+	sort.SliceStable(advisories, func(i, j int) bool {
+		return advisories[i].Name < advisories[j].Name
+	})
+	for _, advisory := range advisories {
+		s.in.onAdvisory(advisory)
+	}
+	return nil
+}
+
+// fetchAdvisories posts the installed versions to the bulk advisory endpoint
+// and returns the advisories that affect them.
+func (in *Installer) fetchAdvisories(ctx context.Context, installed map[string][]string) ([]*Advisory, error) {
+	if len(installed) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(installed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal installed packages for advisories: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, in.registry+"/-/npm/v1/security/advisories/bulk", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request for advisories: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	release, err := in.acquire(ctx, req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	res, err := in.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch advisories: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status code while fetching advisories: %d", res.StatusCode)
+	}
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read advisories: %w", err)
+	}
+	var found map[string][]*Advisory
+	if err := json.Unmarshal(resBody, &found); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal advisories: %w", err)
+	}
+	var advisories []*Advisory
+	for name, list := range found {
+		for _, advisory := range list {
+			for _, version := range installed[name] {
+				if !affects(advisory.VulnerableVersions, version) {
+					continue
+				}
+				affected := *advisory
+				affected.Name = name
+				affected.Version = version
+				advisories = append(advisories, &affected)
+			}
+		}
+	}
+	return advisories, nil
+}
+
+// affects returns true if the version is within the vulnerable range. Ranges
+// we can't parse are assumed to affect the version.
+func affects(vulnerable, version string) bool {
+	checker, err := semver.NewConstraint(vulnerable)
+	if err != nil {
+		return true
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return true
+	}
+	return checker.Check(v)
+}
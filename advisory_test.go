@@ -0,0 +1,64 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestAdvisories(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"package.json": `{"name":"uid","version":"2.0.0","deprecated":"use crypto.randomUUID instead"}`,
+		},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"^2.0.0"}}`,
+		},
+	})
+	var requested map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/-/npm/v1/security/advisories/bulk" {
+			registry.ServeHTTP(w, r)
+			return
+		}
+		is.Equal(r.Method, http.MethodPost)
+		is.NoErr(json.NewDecoder(r.Body).Decode(&requested))
+		w.Write([]byte(`{
+			"@lukeed/uuid": [{
+				"id": 1,
+				"title": "Predictable IDs",
+				"url": "https://github.com/advisories/1",
+				"severity": "high",
+				"vulnerable_versions": "<2.0.2"
+			}]
+		}`))
+	}))
+	defer server.Close()
+	var advisories []*npm.Advisory
+	ctx := context.Background()
+	installer := npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithAdvisories(func(advisory *npm.Advisory) {
+			advisories = append(advisories, advisory)
+		}),
+	)
+	err := installer.Install(ctx, dir, "@lukeed/uuid@^2.0.0")
+	is.NoErr(err)
+	is.Equal(requested["@lukeed/uuid"], []string{"2.0.1"})
+	is.Equal(requested["uid"], []string{"2.0.0"})
+	is.Equal(len(advisories), 2)
+	is.Equal(advisories[0].Name, "@lukeed/uuid")
+	is.Equal(advisories[0].Version, "2.0.1")
+	is.Equal(advisories[0].Severity, "high")
+	is.Equal(advisories[0].Title, "Predictable IDs")
+	is.Equal(advisories[1].Name, "uid")
+	is.Equal(advisories[1].Version, "2.0.0")
+	is.Equal(advisories[1].Deprecated, "use crypto.randomUUID instead")
+}
@@ -0,0 +1,23 @@
+package npm
+
+import "strings"
+
+// aliasProtocol installs a package under another name, like npm's
+// react17@npm:react@^17. This allows side-by-side versions of a package.
+const aliasProtocol = "npm:"
+
+// splitAlias splits an aliased spec like react17@npm:react@^17 into the name
+// to install the package under and the package's own spec
+func splitAlias(pkgname string) (alias, real string, ok bool) {
+	index := strings.Index(pkgname[min(1, len(pkgname)):], "@"+aliasProtocol)
+	if index < 0 {
+		return "", "", false
+	}
+	index++
+	alias, real = pkgname[:index], pkgname[index+1+len(aliasProtocol):]
+	// Aliases without a version install the latest version
+	if strings.LastIndex(real, "@") <= 0 {
+		real += "@latest"
+	}
+	return alias, real, true
+}
@@ -0,0 +1,50 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestAlias(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"react@17.0.2": {},
+		"react@18.2.0": {},
+		"app@1.0.0": {
+			"package.json": `{"name":"app","version":"1.0.0","dependencies":{"legacy-react":"npm:react@^17.0.0"}}`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	// Versions are installed side by side under their aliases
+	result, err := installer.InstallWithResult(ctx, dir, "react17@npm:react@^17.0.0", "react@^18.0.0", "app@1.0.0")
+	is.NoErr(err)
+	nodeModules := filepath.Join(dir, "node_modules")
+	equals(t, filepath.Join(nodeModules, "react17", "package.json"), `{"name":"react","version":"17.0.2"}`)
+	equals(t, filepath.Join(nodeModules, "react", "package.json"), `{"name":"react","version":"18.2.0"}`)
+	equals(t, filepath.Join(nodeModules, "legacy-react", "package.json"), `{"name":"react","version":"17.0.2"}`)
+	is.Equal(len(result.Packages), 4)
+	is.Equal(result.Packages[1].Name, "react")
+	is.Equal(result.Packages[1].Version, "17.0.2")
+	// The lockfile keeps the real name
+	lock, err := os.ReadFile(filepath.Join(nodeModules, ".package-lock.json"))
+	is.NoErr(err)
+	is.True(strings.Contains(string(lock), `"name": "react"`))
+	// Aliases aren't broken packages
+	removed, err := installer.Clean(dir)
+	is.NoErr(err)
+	is.Equal(len(removed), 0)
+	// Aliases are saved with the real name
+	dir = t.TempDir()
+	is.NoErr(installer.Add(ctx, dir, "react17@npm:react@17"))
+	equals(t, filepath.Join(dir, "package.json"), "{\n  \"dependencies\": {\n    \"react17\": \"npm:react@^17.0.2\"\n  }\n}\n")
+}
@@ -0,0 +1,67 @@
+package npm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithAllowedVersions only resolves the versions of a package that are in its
+// allowlist (e.g. {"lodash": {"4.17.21"}}), ignoring every other published
+// version. This enforces a curated list of approved versions. Packages that
+// aren't in the map can resolve any version. Dist-tags that point to a version
+// that isn't allowed fall back to the highest allowed version below it.
+func WithAllowedVersions(allowed map[string][]string) Option {
+	return func(in *Installer) {
+		in.allowed = allowed
+	}
+}
+
+// allowedVersions returns a copy of the metadata with only the versions in
+// the package's allowlist
+func (in *Installer) allowedVersions(meta *metadata) (*metadata, error) {
+	allowed, ok := in.allowed[meta.Name]
+	if !ok {
+		return meta, nil
+	}
+	filtered := &metadata{
+		Name:     meta.Name,
+		DistTags: map[string]string{},
+		Versions: map[string]*versionMetadata{},
+		Time:     meta.Time,
+		size:     meta.size,
+		coerced:  meta.coerced,
+	}
+	for _, version := range allowed {
+		version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+		if versionMeta, ok := meta.Versions[version]; ok {
+			filtered.Versions[version] = versionMeta
+		}
+	}
+	if len(filtered.Versions) == 0 {
+		return nil, fmt.Errorf("unable to resolve a version of %s because none of the allowed versions (%s) are published", meta.Name, strings.Join(allowed, ", "))
+	}
+	filtered.retag(meta.DistTags)
+	return filtered, nil
+}
+
+// resolveAllowed resolves the constraint among the allowed or tagged
+// versions, with an error that lists them when none satisfy it
+func (in *Installer) resolveAllowed(meta *metadata, constraint string) (string, error) {
+	version, err := in.resolveRange(meta, constraint)
+	if err == nil {
+		return version, nil
+	}
+	kind := "allowed"
+	if _, ok := in.allowed[meta.Name]; !ok {
+		if !in.taggedOnly || len(meta.Versions) == 0 {
+			return "", err
+		}
+		kind = "tagged"
+	}
+	versions := meta.versions()
+	list := make([]string, len(versions))
+	for i, version := range versions {
+		list[i] = meta.original(version.Original())
+	}
+	return "", fmt.Errorf("unable to resolve version for %s@%s: none of the %s versions (%s) satisfy it: %w", meta.Name, constraint, kind, strings.Join(list, ", "), err)
+}
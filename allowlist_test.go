@@ -0,0 +1,58 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestAllowedVersions(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0": {},
+		"uid@1.1.0": {},
+		"uid@1.2.0": {},
+		"uid@2.0.0": {},
+		"ms@1.0.0":  {},
+		"ms@2.0.0":  {},
+	}))
+	defer server.Close()
+	installer := npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithAllowedVersions(map[string][]string{
+			"uid": {"1.0.0", "1.1.0", "3.0.0"},
+		}),
+	)
+	version, err := installer.Version(ctx, "uid", "^1.0.0")
+	is.NoErr(err)
+	is.Equal(version, "1.1.0")
+	// latest falls back to the highest allowed version
+	version, err = installer.Version(ctx, "uid", "latest")
+	is.NoErr(err)
+	is.Equal(version, "1.1.0")
+	// Packages without an allowlist resolve any version
+	version, err = installer.Version(ctx, "ms", "*")
+	is.NoErr(err)
+	is.Equal(version, "2.0.0")
+	_, err = installer.Version(ctx, "uid", "^2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "none of the allowed versions (1.0.0, 1.1.0) satisfy it"))
+	// Installs are restricted too
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@*"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"1.1.0"}`)
+	// None of the allowed versions are published
+	installer = npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithAllowedVersions(map[string][]string{"uid": {"3.0.0"}}),
+	)
+	_, err = installer.Version(ctx, "uid", "*")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "none of the allowed versions (3.0.0) are published"))
+}
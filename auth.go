@@ -0,0 +1,277 @@
+package npm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithAuthToken sends the token as a bearer token with requests to the
+// registry.
+func WithAuthToken(token string) Option {
+	return func(in *Installer) {
+		in.authToken = "Bearer " + token
+	}
+}
+
+// WithRegistryAuthToken sends the token as a bearer token with requests to
+// the registry, which is typically one set with WithScopeRegistry. Tokens
+// apply to every URL under the registry's URL, like npm's
+// //host/path/:_authToken in .npmrc.
+func WithRegistryAuthToken(registry, token string) Option {
+	return func(in *Installer) {
+		in.setAuth(registry, "Bearer "+token)
+	}
+}
+
+// WithRegistryBasicAuth sends basic auth with requests to the registry, like
+// npm's //host/path/:_auth in .npmrc. The auth is the base64-encoded
+// username:password.
+func WithRegistryBasicAuth(registry, auth string) Option {
+	return func(in *Installer) {
+		in.setAuth(registry, "Basic "+auth)
+	}
+}
+
+// setAuth sets the Authorization header sent to the registry
+func (in *Installer) setAuth(registry, auth string) {
+	if auth == "" {
+		return
+	}
+	if in.authTokens == nil {
+		in.authTokens = map[string]string{}
+	}
+	in.authTokens[nerfDart(registry)] = auth
+}
+
+// splitUserinfo removes the credentials from the URL, returning them as a
+// basic Authorization header
+func splitUserinfo(rawURL string) (string, string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL, ""
+	}
+	auth := basicAuth(u.User)
+	u.User = nil
+	return u.String(), auth
+}
+
+// basicAuth returns the basic Authorization header for the userinfo
+func basicAuth(user *url.Userinfo) string {
+	password, _ := user.Password()
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password))
+}
+
+// WithAlwaysAuth sends the credentials of a package's registry when
+// downloading its tarball from another host that has no credentials of its
+// own, like always-auth in .npmrc. Redirects still follow WithRedirects.
+func WithAlwaysAuth() Option {
+	return func(in *Installer) {
+		in.alwaysAuth = true
+	}
+}
+
+// WithRedirects sets how tarball downloads follow redirects. At most max
+// redirects are followed. Credentials are only sent to the hosts they're
+// configured for, unless keepAuth is true, in which case they're also sent to
+// the hosts the registry redirects to. Registries that redirect to signed CDN
+// URLs expect the default, while some private registries expect the
+// credentials to be kept. Defaults to 10 redirects without keeping
+// credentials.
+func WithRedirects(max int, keepAuth bool) Option {
+	return func(in *Installer) {
+		in.maxRedirects = max
+		in.redirectAuth = keepAuth
+	}
+}
+
+// nerfDart turns a registry URL into the scheme-less form npm keys credentials
+// by (e.g. //registry.npmjs.org/)
+func nerfDart(registry string) string {
+	u, err := url.Parse(registry)
+	if err != nil || u.Host == "" {
+		return registry
+	}
+	return "//" + u.Host + strings.TrimSuffix(u.Path, "/") + "/"
+}
+
+// tokenFor returns the credentials to send with requests to the URL as an
+// Authorization header. The credentials for the longest matching registry win,
+// falling back to the default registry's.
+func (in *Installer) tokenFor(u *url.URL) string {
+	location := "//" + u.Host + u.Path
+	match, token := "", ""
+	for prefix, prefixToken := range in.authTokens {
+		if strings.HasPrefix(location, prefix) && len(prefix) > len(match) {
+			match, token = prefix, prefixToken
+		}
+	}
+	if token != "" {
+		return token
+	}
+	if in.authToken != "" && strings.HasPrefix(location, nerfDart(in.registry)) {
+		return in.authToken
+	}
+	return ""
+}
+
+// authorize adds the credentials from tokenFor to the request
+func authorize(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+}
+
+// releaseBody releases the request slot once the body is closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// resumedBody is the rest of a tarball, starting from the requested offset
+type resumedBody struct {
+	io.ReadCloser
+}
+
+// requestTarball requests the package's tarball from the offset, falling back
+// to the mirrors when its registry can't be reached. The body is a
+// *resumedBody when the server sent the rest of the tarball, otherwise it's
+// the whole tarball.
+func (in *Installer) requestTarball(ctx context.Context, p *remotePackage, offset int64) (io.ReadCloser, error) {
+	tarballURL := p.url()
+	var err error
+	for i, registry := range in.registriesFor(p.Scope) {
+		if i > 0 {
+			tarballURL = tarballURLFor(registry, p.Scope, p.Name, p.Version)
+		}
+		var body io.ReadCloser
+		var unavailable bool
+		body, unavailable, err = in.requestTarballFrom(ctx, p, tarballURL, offset)
+		if !unavailable {
+			return body, err
+		}
+	}
+	return nil, err
+}
+
+// requestTarballFrom requests the tarball at the url, following redirects. It
+// returns unavailable when the host can't be reached or has a server error.
+func (in *Installer) requestTarballFrom(ctx context.Context, p *remotePackage, tarballURL string, offset int64) (body io.ReadCloser, unavailable bool, err error) {
+	location, err := url.Parse(tarballURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to parse the tarball url for %s: %w", p.Name, err)
+	}
+	token := in.tokenFor(location)
+	// Credentials in the tarball's URL are sent with basic auth instead
+	if location.User != nil {
+		token = basicAuth(location.User)
+		location.User = nil
+	}
+	if token == "" && in.alwaysAuth {
+		if registry, err := url.Parse(in.registryFor(p.Scope) + "/"); err == nil {
+			token = in.tokenFor(registry)
+		}
+	}
+	// Credentials follow same-host redirects, while cross-host redirects
+	// depend on the policy
+	redirectAuth := func(next *url.URL, token string) string {
+		if in.redirectAuth && token != "" {
+			return token
+		}
+		return in.tokenFor(next)
+	}
+	return in.fetchTarball(ctx, p.Name, location, token, offset, redirectAuth)
+}
+
+// fetchTarball requests the tarball at the location with the token, following
+// redirects. Cross-host redirects send the token returned by redirectAuth
+// instead. It returns unavailable when the host can't be reached or has a
+// server error.
+func (in *Installer) fetchTarball(ctx context.Context, name string, location *url.URL, token string, offset int64, redirectAuth func(next *url.URL, token string) string) (body io.ReadCloser, unavailable bool, err error) {
+	// Follow redirects ourselves
+	client := *in.client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	release, err := in.acquire(ctx, location.Host)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to download %s: %w", name, err)
+	}
+	for redirects := 0; ; redirects++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location.String(), nil)
+		if err != nil {
+			release()
+			return nil, false, fmt.Errorf("unable to create request for %s: %w", name, err)
+		} else if err := in.checkTransport(location); err != nil {
+			release()
+			return nil, false, err
+		}
+		authorize(req, token)
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			release()
+			return nil, ctx.Err() == nil, fmt.Errorf("unable to download %s: %w", name, err)
+		}
+		switch res.StatusCode {
+		case http.StatusOK:
+			// Proxies sometimes serve an error page instead of the tarball
+			if contentType := res.Header.Get("Content-Type"); strings.HasPrefix(contentType, "text/") {
+				snippet, _ := io.ReadAll(io.LimitReader(res.Body, snippetSize))
+				res.Body.Close()
+				release()
+				return nil, false, fmt.Errorf("unable to download %s: expected a tarball but got %s from %s: %s", name, contentType, location.Redacted(), bodySnippet(snippet))
+			}
+			return &releaseBody{res.Body, release}, false, nil
+		case http.StatusPartialContent:
+			if offset == 0 {
+				res.Body.Close()
+				release()
+				return nil, false, fmt.Errorf("unable to download %s: unexpected partial content", name)
+			}
+			return &resumedBody{&releaseBody{res.Body, release}}, false, nil
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			res.Body.Close()
+			if redirects >= in.maxRedirects {
+				release()
+				return nil, false, fmt.Errorf("unable to download %s: stopped after %d redirects", name, in.maxRedirects)
+			}
+			next, err := res.Location()
+			if err != nil {
+				release()
+				return nil, false, fmt.Errorf("unable to follow redirect while downloading %s: %w", name, err)
+			}
+			if next.Host != location.Host {
+				token = redirectAuth(next, token)
+			}
+			if next.User != nil {
+				token = basicAuth(next.User)
+				next.User = nil
+			}
+			// Hosts are limited separately, so wait for a slot on the new host
+			if next.Host != location.Host {
+				release()
+				if release, err = in.acquire(ctx, next.Host); err != nil {
+					return nil, false, fmt.Errorf("unable to download %s: %w", name, err)
+				}
+			}
+			location = next
+		default:
+			res.Body.Close()
+			release()
+			return nil, res.StatusCode >= 500, fmt.Errorf("unexpected status code while installing %s: %d", name, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestRedirects(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	var mu sync.Mutex
+	var cdnAuth []string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		cdnAuth = append(cdnAuth, r.Header.Get("Authorization"))
+		mu.Unlock()
+		registry.ServeHTTP(w, r)
+	}))
+	defer cdn.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			http.Redirect(w, r, cdn.URL+r.URL.Path, http.StatusFound)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	// Credentials aren't sent to the CDN by default
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithAuthToken("secret"))
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	is.Equal(cdnAuth, []string{""})
+	// But they can be kept
+	dir = t.TempDir()
+	installer = npm.New(npm.WithRegistry(server.URL), npm.WithAuthToken("secret"), npm.WithRedirects(10, true))
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	is.Equal(cdnAuth, []string{"", "Bearer secret"})
+}
+
+func TestRedirectLimit(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			http.Redirect(w, r, r.URL.Path, http.StatusFound)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithRedirects(2, false))
+	err := installer.Install(context.Background(), t.TempDir(), "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "stopped after 2 redirects"))
+}
+
+func TestUserinfoAuth(t *testing.T) {
+	is := is.New(t)
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:p@ss"))
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != auth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	registryURL := strings.Replace(server.URL, "http://", "http://user:p%40ss@", 1)
+	// Credentials in the registry's URL are sent to the metadata and tarballs
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(registryURL))
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	lockfile, err := os.ReadFile(filepath.Join(dir, "node_modules", ".package-lock.json"))
+	is.NoErr(err)
+	is.True(!strings.Contains(string(lockfile), "p%40ss"))
+	// They never show up in errors
+	err = installer.Install(ctx, t.TempDir(), "missing@1.0.0")
+	is.True(err != nil)
+	is.True(!strings.Contains(err.Error(), "p%40ss"))
+	is.True(!strings.Contains(err.Error(), "p@ss"))
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	installer = npm.New(npm.WithRegistry(strings.Replace(closed.URL, "http://", "http://user:p%40ss@", 1)))
+	err = installer.Install(ctx, t.TempDir(), "uid@2.0.0")
+	is.True(err != nil)
+	is.True(!strings.Contains(err.Error(), "p%40ss"))
+	is.True(!strings.Contains(err.Error(), "user:"))
+	// Credentials in a tarball's URL are sent with basic auth too
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != auth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer cdn.Close()
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Host = "user:p%40ss@" + strings.TrimPrefix(cdn.URL, "http://")
+		registry.ServeHTTP(w, r)
+	}))
+	defer public.Close()
+	dir = t.TempDir()
+	is.NoErr(npm.New(npm.WithRegistry(public.URL)).Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+}
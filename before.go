@@ -0,0 +1,76 @@
+package npm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// WithBeforeDate only resolves versions that were published before the date,
+// using the publish times in the registry's "time" map, like npm's --before.
+// This makes installs reproducible as of a point in time, which is handy for
+// tracking down when a regression was introduced. Dist-tags that point to a
+// newer version fall back to the highest older version, so latest is what
+// latest was at that date.
+func WithBeforeDate(date time.Time) Option {
+	return func(in *Installer) {
+		in.before = date
+	}
+}
+
+// publishedBefore returns a copy of the metadata with only the versions that
+// were published before the installer's date
+func (in *Installer) publishedBefore(meta *metadata) (*metadata, error) {
+	if in.before.IsZero() {
+		return meta, nil
+	}
+	if len(meta.Time) == 0 {
+		return nil, fmt.Errorf("unable to resolve versions of %s published before %s because the registry doesn't list publish times", meta.Name, in.before.Format(time.RFC3339))
+	}
+	filtered := &metadata{
+		Name:     meta.Name,
+		DistTags: map[string]string{},
+		Versions: map[string]*versionMetadata{},
+		Time:     meta.Time,
+		size:     meta.size,
+		coerced:  meta.coerced,
+	}
+	for version, versionMeta := range meta.Versions {
+		published, err := time.Parse(time.RFC3339, meta.Time[meta.original(version)])
+		if err != nil || !published.Before(in.before) {
+			continue
+		}
+		filtered.Versions[version] = versionMeta
+	}
+	if len(filtered.Versions) == 0 && len(meta.Versions) > 0 {
+		return nil, fmt.Errorf("unable to resolve a version of %s because none were published before %s", meta.Name, in.before.Format(time.RFC3339))
+	}
+	filtered.retag(meta.DistTags)
+	return filtered, nil
+}
+
+// retag points the dist-tags at the filtered versions. Tags pointing to a
+// version that was filtered out fall back to the highest version below it,
+// skipping prereleases unless the tag points to one.
+func (m *metadata) retag(distTags map[string]string) {
+	versions := m.versions()
+	for tag, version := range distTags {
+		if _, ok := m.Versions[version]; ok {
+			m.DistTags[tag] = version
+			continue
+		}
+		tagged, err := semver.NewVersion(version)
+		if err != nil {
+			continue
+		}
+		for i := len(versions) - 1; i >= 0; i-- {
+			if versions[i].Prerelease() != "" && tagged.Prerelease() == "" {
+				continue
+			} else if versions[i].LessThan(tagged) {
+				m.DistTags[tag] = m.original(versions[i].Original())
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestBeforeDate(t *testing.T) {
+	is := is.New(t)
+	published := map[string]string{
+		"1.0.0":      "2020-01-01T00:00:00.000Z",
+		"1.1.0":      "2021-01-01T00:00:00.000Z",
+		"2.0.0-beta": "2021-06-01T00:00:00.000Z",
+		"2.0.0":      "2022-01-01T00:00:00.000Z",
+	}
+	tarballs := map[string][]byte{}
+	for version := range published {
+		tarball, err := createTarball(map[string]string{
+			"package.json": `{"name":"uid","version":"` + version + `"}`,
+		})
+		is.NoErr(err)
+		tarballs["/uid/-/uid-"+version+".tgz"] = tarball
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tarball, ok := tarballs[r.URL.Path]; ok {
+			w.Write(tarball)
+			return
+		}
+		versions := map[string]interface{}{}
+		for version := range published {
+			versions[version] = map[string]interface{}{
+				"name":    "uid",
+				"version": version,
+				"dist": map[string]string{
+					"tarball": "http://" + r.Host + "/uid/-/uid-" + version + ".tgz",
+				},
+			}
+		}
+		document := map[string]interface{}{
+			"name":      "uid",
+			"dist-tags": map[string]string{"latest": "2.0.0"},
+			"versions":  versions,
+		}
+		if r.URL.Path == "/uid" {
+			times := map[string]string{"created": "2020-01-01T00:00:00.000Z"}
+			for version, date := range published {
+				times[version] = date
+			}
+			document["time"] = times
+		} else if r.URL.Path != "/untimed" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(document)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	before := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithBeforeDate(before))
+	version, err := installer.Version(ctx, "uid", "*")
+	is.NoErr(err)
+	is.Equal(version, "1.1.0")
+	// Dist-tags fall back to what they pointed to at the time
+	version, err = installer.Version(ctx, "uid", "latest")
+	is.NoErr(err)
+	is.Equal(version, "1.1.0")
+	_, err = installer.Version(ctx, "uid", "^2.0.0")
+	is.True(err != nil)
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@latest"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"1.1.0"}`)
+	// Without a date, everything is available
+	version, err = npm.New(npm.WithRegistry(server.URL)).Version(ctx, "uid", "latest")
+	is.NoErr(err)
+	is.Equal(version, "2.0.0")
+	// Registries without publish times can't be bounded
+	_, err = installer.Version(ctx, "untimed", "*")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "doesn't list publish times"))
+}
@@ -0,0 +1,57 @@
+package npm
+
+import (
+	"errors"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// WithBestEffort keeps installing the rest of the packages when one fails,
+// then Install reports every failure together. The packages that were installed are
+// still written to the lockfile and returned by InstallWithResult. By default
+// the install fails with the first error.
+func WithBestEffort() Option {
+	return func(in *Installer) {
+		in.bestEffort = true
+	}
+}
+
+// group runs installs concurrently
+type group interface {
+	Go(fn func() error)
+	Wait() error
+}
+
+// group returns an errgroup that fails with the first error, or a group that
+// collects every error in best-effort mode
+func (s *session) group() group {
+	if s.in.bestEffort {
+		return new(errorGroup)
+	}
+	return new(errgroup.Group)
+}
+
+// errorGroup waits for every function and joins their errors
+type errorGroup struct {
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+func (g *errorGroup) Go(fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(); err != nil {
+			g.mu.Lock()
+			g.errs = append(g.errs, err)
+			g.mu.Unlock()
+		}
+	}()
+}
+
+func (g *errorGroup) Wait() error {
+	g.wg.Wait()
+	return errors.Join(g.errs...)
+}
@@ -0,0 +1,39 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestBestEffort(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{"name":"a","version":"1.0.0","dependencies":{"b":"^1.0.0","missing-dep":"^1.0.0"}}`,
+		},
+		"b@1.0.0": {},
+		"d@1.0.0": {},
+	}))
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithBestEffort())
+	dir := t.TempDir()
+	result, err := installer.InstallWithResult(context.Background(), dir, "a@1.0.0", "missing@1.0.0", "d@1.0.0")
+	is.True(err != nil)
+	// Every failure is reported
+	is.True(strings.Contains(err.Error(), "resolving version for missing:"))
+	is.True(strings.Contains(err.Error(), "resolving version for missing-dep:"))
+	// The rest are installed
+	is.Equal(len(result.Packages), 3)
+	exists(t, filepath.Join(dir, "node_modules", "a", "package.json"))
+	exists(t, filepath.Join(dir, "node_modules", "b", "package.json"))
+	exists(t, filepath.Join(dir, "node_modules", "d", "package.json"))
+	lock := readLockfile(t, filepath.Join(dir, "node_modules", ".package-lock.json"))
+	_, ok := lock.Packages["node_modules/d"]
+	is.True(ok)
+}
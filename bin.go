@@ -0,0 +1,128 @@
+package npm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// readBins reads the executables from a package.json's bin field, which is
+// either a path named after the package or a map of names to paths
+func readBins(pkgName string, bin json.RawMessage) map[string]string {
+	var single string
+	if json.Unmarshal(bin, &single) == nil && single != "" {
+		_, name := parseScope(pkgName)
+		return map[string]string{name: single}
+	}
+	var bins map[string]string
+	if json.Unmarshal(bin, &bins) == nil {
+		return bins
+	}
+	return nil
+}
+
+// linkBins reconciles dir/node_modules/.bin with the installed packages.
+// Links to packages that are gone are pruned, then every top-level package's
+// executables are linked, replacing links that point elsewhere. When packages
+// have an executable with the same name, the first package by name wins.
+func (in *Installer) linkBins(dir string) error {
+	binDir := filepath.Join(dir, "node_modules", ".bin")
+	if err := pruneBinLinks(binDir); err != nil {
+		return fmt.Errorf("npm: unable to link bins: %w", err)
+	}
+	packages, err := in.List(dir)
+	if err != nil {
+		return err
+	}
+	linked := map[string]bool{}
+	for _, pkg := range packages {
+		manifest, err := os.ReadFile(filepath.Join(pkg.Dir, "package.json"))
+		if err != nil {
+			return fmt.Errorf("npm: unable to link bins: %w", err)
+		}
+		var fields struct {
+			Bin json.RawMessage `json:"bin,omitempty"`
+		}
+		if err := in.unmarshalManifest(manifest, &fields); err != nil {
+			return fmt.Errorf("npm: unable to link bins for %s: %w", pkg.Name, err)
+		}
+		for name, target := range readBins(pkg.Name, fields.Bin) {
+			target = path.Clean(filepath.ToSlash(target))
+			// Never link outside of .bin or the package
+			if linked[name] || !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) || !filepath.IsLocal(target) {
+				continue
+			}
+			linked[name] = true
+			targetPath := filepath.Join(pkg.Dir, filepath.FromSlash(target))
+			if in.binShims {
+				if err := writeShims(binDir, name, targetPath); err != nil {
+					return fmt.Errorf("npm: unable to write shims for %s in %s: %w", name, pkg.Name, err)
+				}
+			} else if err := linkBin(binDir, name, targetPath); err != nil {
+				return fmt.Errorf("npm: unable to link %s for %s: %w", name, pkg.Name, err)
+			}
+			// Executables are often published without the executable bit
+			if info, err := os.Stat(targetPath); err == nil {
+				os.Chmod(targetPath, info.Mode()|0111)
+			}
+		}
+	}
+	return nil
+}
+
+// linkBin links binDir/name to the target path with a relative link, unless
+// it already does
+func linkBin(binDir, name, targetPath string) error {
+	linkPath := filepath.Join(binDir, name)
+	linkTarget, err := filepath.Rel(binDir, targetPath)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.Readlink(linkPath); err == nil && existing == linkTarget {
+		return nil
+	}
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(linkPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(linkTarget, linkPath)
+}
+
+// pruneBinLinks removes the links and shims in binDir whose target doesn't
+// exist
+func pruneBinLinks(binDir string) error {
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if target, ok := shimTarget(filepath.Join(binDir, entry.Name())); ok {
+			if _, err := os.Stat(target); err != nil && errors.Is(err, os.ErrNotExist) {
+				if err := removeShims(filepath.Join(binDir, entry.Name())); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		linkPath := filepath.Join(binDir, entry.Name())
+		if _, err := os.Stat(linkPath); err == nil || !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := os.Remove(linkPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
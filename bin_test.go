@@ -0,0 +1,129 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestBinLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"tool@1.0.0": {
+			"package.json": `{"name":"tool","version":"1.0.0","bin":{"tool":"bin/tool.js","evil":"../../evil.js"}}`,
+			"bin/tool.js":  `console.log("tool")`,
+		},
+		"@scope/cli@1.0.0": {
+			"package.json": `{"name":"@scope/cli","version":"1.0.0","bin":"./cli.js"}`,
+			"cli.js":       `console.log("cli")`,
+		},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	binDir := filepath.Join(dir, "node_modules", ".bin")
+	is.NoErr(writeFiles(dir, map[string]string{
+		"node_modules/old/old.js":  `console.log("old")`,
+		"node_modules/.bin/script": "#!/bin/sh",
+	}))
+	// A stale link to a removed package and a link that's out of sync
+	is.NoErr(os.Symlink(filepath.Join("..", "gone", "gone.js"), filepath.Join(binDir, "gone")))
+	is.NoErr(os.Symlink(filepath.Join("..", "old", "old.js"), filepath.Join(binDir, "tool")))
+	installer := npm.New(npm.WithRegistry(server.URL))
+	is.NoErr(installer.Install(context.Background(), dir, "tool@1.0.0", "@scope/cli@1.0.0"))
+	equals(t, filepath.Join(binDir, "tool"), `console.log("tool")`)
+	equals(t, filepath.Join(binDir, "cli"), `console.log("cli")`)
+	info, err := os.Stat(filepath.Join(binDir, "tool"))
+	is.NoErr(err)
+	is.True(info.Mode()&0111 != 0)
+	_, err = os.Lstat(filepath.Join(binDir, "gone"))
+	is.True(os.IsNotExist(err))
+	_, err = os.Lstat(filepath.Join(binDir, "evil"))
+	is.True(os.IsNotExist(err))
+	// Files that aren't links are kept
+	equals(t, filepath.Join(binDir, "script"), "#!/bin/sh")
+}
+
+func TestBinLinksFlatScopes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"@scope/cli@1.0.0": {
+			"package.json": `{"name":"@scope/cli","version":"1.0.0","bin":"./cli.js"}`,
+			"cli.js":       `console.log("cli")`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	linkPath := filepath.Join(dir, "node_modules", ".bin", "cli")
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithScopedLayout(npm.FlatScopes))
+	is.NoErr(installer.Install(ctx, dir, "@scope/cli@1.0.0"))
+	equals(t, linkPath, `console.log("cli")`)
+	target, err := os.Readlink(linkPath)
+	is.NoErr(err)
+	is.Equal(target, filepath.Join("..", "@scope%2fcli", "cli.js"))
+	// The link isn't pruned and recreated by the next install
+	before, err := os.Lstat(linkPath)
+	is.NoErr(err)
+	is.NoErr(installer.Install(ctx, dir, "@scope/cli@1.0.0"))
+	after, err := os.Lstat(linkPath)
+	is.NoErr(err)
+	is.True(os.SameFile(before, after))
+}
+
+func TestBinShims(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs the shell shim with sh")
+	}
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"tool@1.0.0": {
+			"package.json": `{"name":"tool","version":"1.0.0","bin":{"tool":"bin/tool.sh","tool-node":"bin/tool.js"}}`,
+			"bin/tool.sh":  "#!/usr/bin/env sh\necho \"tool $1\"\n",
+			"bin/tool.js":  "#!/usr/bin/env node\nconsole.log(\"tool\")\n",
+		},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	binDir := filepath.Join(dir, "node_modules", ".bin")
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithBinShims(true))
+	is.NoErr(installer.Install(context.Background(), dir, "tool@1.0.0"))
+	// Shims are files rather than links
+	for _, name := range []string{"tool", "tool.cmd", "tool.ps1", "tool-node", "tool-node.cmd", "tool-node.ps1"} {
+		info, err := os.Lstat(filepath.Join(binDir, name))
+		is.NoErr(err)
+		is.True(info.Mode().IsRegular())
+	}
+	shim, err := os.ReadFile(filepath.Join(binDir, "tool-node"))
+	is.NoErr(err)
+	is.True(strings.Contains(string(shim), `exec node  "$basedir/../tool/bin/tool.js" "$@"`))
+	cmd, err := os.ReadFile(filepath.Join(binDir, "tool-node.cmd"))
+	is.NoErr(err)
+	is.True(strings.Contains(string(cmd), `"%_prog%"  "%dp0%\..\tool\bin\tool.js" %*`))
+	ps1, err := os.ReadFile(filepath.Join(binDir, "tool-node.ps1"))
+	is.NoErr(err)
+	is.True(strings.Contains(string(ps1), `& "node$exe"  "$basedir/../tool/bin/tool.js" $args`))
+	// The shell shim runs the script through its shebang
+	out, err := exec.Command("sh", filepath.Join(binDir, "tool"), "works").Output()
+	is.NoErr(err)
+	is.Equal(string(out), "tool works\n")
+	// Uninstalling removes the shims
+	is.NoErr(installer.Uninstall(context.Background(), dir, "tool"))
+	for _, name := range []string{"tool", "tool.cmd", "tool.ps1", "tool-node", "tool-node.cmd", "tool-node.ps1"} {
+		_, err := os.Lstat(filepath.Join(binDir, name))
+		is.True(os.IsNotExist(err))
+	}
+}
@@ -0,0 +1,64 @@
+package npm
+
+import (
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// BranchPreference is which branch of an OR range (e.g. ^1 || ^2) versions
+// are resolved from. By default the highest version that satisfies any branch
+// is resolved, like npm.
+type BranchPreference int
+
+const (
+	// PreferLowestBranch resolves the highest version of the lowest branch that
+	// has a match, so ^1 || ^2 stays on the older major for stability.
+	PreferLowestBranch BranchPreference = iota + 1
+	// PreferFirstBranch resolves the highest version of the first branch, as
+	// written, that has a match.
+	PreferFirstBranch
+)
+
+// WithBranchPreference sets which branch of an OR range versions are resolved
+// from. Ranges without || are resolved as usual.
+func WithBranchPreference(preference BranchPreference) Option {
+	return func(in *Installer) {
+		in.branchPref = preference
+	}
+}
+
+// resolveRange resolves the constraint, preferring a branch of OR ranges
+func (in *Installer) resolveRange(meta *metadata, constraint string) (string, error) {
+	branches := strings.Split(constraint, "||")
+	if in.branchPref == 0 || len(branches) < 2 {
+		return meta.Resolve(constraint)
+	}
+	var preferred string
+	var lowest *semver.Version
+	for _, branch := range branches {
+		version, err := meta.Resolve(strings.TrimSpace(branch))
+		if err != nil {
+			continue
+		} else if in.branchPref == PreferFirstBranch {
+			return version, nil
+		}
+		// Coerced versions are compared by what they were coerced to
+		compared := version
+		if coerced, ok := coerceVersion(version); ok && meta.original(coerced) == version {
+			compared = coerced
+		}
+		v, err := semver.NewVersion(compared)
+		if err != nil {
+			continue
+		}
+		if lowest == nil || v.LessThan(lowest) {
+			preferred, lowest = version, v
+		}
+	}
+	if preferred == "" {
+		// None of the branches match, so report the whole range
+		return meta.Resolve(constraint)
+	}
+	return preferred, nil
+}
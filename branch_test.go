@@ -0,0 +1,66 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestOrRanges(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0":      {},
+		"uid@1.5.0":      {},
+		"uid@2.0.0":      {},
+		"uid@2.3.0":      {},
+		"uid@3.0.0-beta": {},
+		"uid@4.0.0":      {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	tests := []struct {
+		preference npm.BranchPreference
+		constraint string
+		expect     string
+	}{
+		// The highest version that satisfies any branch by default
+		{0, "^1 || ^2", "2.3.0"},
+		{0, "^2 || ^1", "2.3.0"},
+		{0, "^5 || ^1", "1.5.0"},
+		{0, "1.0.0 || ^4.0.0", "4.0.0"},
+		{0, "<2 || >=4", "4.0.0"},
+		{0, "~1.0.0 || 1.5.0", "1.5.0"},
+		{0, "^3.0.0-0 || ^1", "3.0.0-beta"},
+		{npm.PreferLowestBranch, "^2 || ^1", "1.5.0"},
+		{npm.PreferLowestBranch, "^5 || ^2 || ^4", "2.3.0"},
+		{npm.PreferLowestBranch, "^1", "1.5.0"},
+		{npm.PreferFirstBranch, "^2 || ^1", "2.3.0"},
+		{npm.PreferFirstBranch, "^1 || ^2", "1.5.0"},
+		{npm.PreferFirstBranch, "^5 || ^4 || ^1", "4.0.0"},
+	}
+	for _, test := range tests {
+		installer := npm.New(npm.WithRegistry(server.URL), npm.WithBranchPreference(test.preference))
+		version, err := installer.Version(ctx, "uid", test.constraint)
+		is.NoErr(err)
+		is.Equal(version, test.expect)
+	}
+	// None of the branches match
+	for _, preference := range []npm.BranchPreference{0, npm.PreferLowestBranch, npm.PreferFirstBranch} {
+		installer := npm.New(npm.WithRegistry(server.URL), npm.WithBranchPreference(preference))
+		_, err := installer.Version(ctx, "uid", "^5 || ^6")
+		is.True(err != nil)
+	}
+	// OR ranges work offline too
+	version, err := npm.Match([]string{"1.0.0", "1.5.0", "2.3.0"}, "^1 || ^2")
+	is.NoErr(err)
+	is.Equal(version, "2.3.0")
+	// Installs resolve the preferred branch
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithBranchPreference(npm.PreferLowestBranch))
+	is.NoErr(installer.Install(ctx, dir, "uid@^2 || ^1"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"1.5.0"}`)
+}
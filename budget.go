@@ -0,0 +1,68 @@
+package npm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// WithMaxTotalSize fails Install before anything is downloaded when the
+// packages to install unpack to more than max bytes, using the unpackedSize
+// the registry lists for each version in the resolved tree. The error lists
+// the largest packages. Versions whose metadata doesn't list an unpackedSize
+// aren't counted.
+func WithMaxTotalSize(max int64) Option {
+	return func(in *Installer) {
+		in.maxTotalSize = max
+	}
+}
+
+// largestShown is how many of the largest packages are listed in the error
+const largestShown = 5
+
+// checkTotalSize resolves the tree and fails if it's over the size budget
+func (in *Installer) checkTotalSize(ctx context.Context, dir string, overrides *overrides, packages []string) error {
+	if in.maxTotalSize <= 0 {
+		return nil
+	}
+	// GitHub packages aren't in the registry, so their size isn't known
+	tree, err := in.resolveTree(ctx, dir, overrides, packages...)
+	if err != nil {
+		return fmt.Errorf("npm: unable to check the install size: %w", err)
+	}
+	var total int64
+	nodes := make([]*Node, 0, len(tree.Nodes))
+	for _, node := range tree.Nodes {
+		total += node.UnpackedSize
+		nodes = append(nodes, node)
+	}
+	if total <= in.maxTotalSize {
+		return nil
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].UnpackedSize != nodes[j].UnpackedSize {
+			return nodes[i].UnpackedSize > nodes[j].UnpackedSize
+		}
+		return nodes[i].key() < nodes[j].key()
+	})
+	largest := make([]string, 0, largestShown)
+	for _, node := range nodes[:min(largestShown, len(nodes))] {
+		largest = append(largest, fmt.Sprintf("%s (%s)", node.key(), formatSize(node.UnpackedSize)))
+	}
+	return fmt.Errorf("npm: unable to install because the packages unpack to %s, which is over the %s budget. The largest are %s", formatSize(total), formatSize(in.maxTotalSize), strings.Join(largest, ", "))
+}
+
+// formatSize formats bytes like npm does (e.g. 1.2 MB)
+func formatSize(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,84 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestMaxTotalSize(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"big@1.0.0": {
+			"package.json": `{"name":"big","version":"1.0.0","dependencies":{"dep":"^1.0.0"}}`,
+		},
+		"dep@1.0.0":   {},
+		"small@1.0.0": {},
+		"other@1.0.0": {},
+	})
+	sizes := map[string]float64{
+		"big":   8_000_000,
+		"dep":   3_500_000,
+		"small": 1_000,
+	}
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			downloads.Add(1)
+			registry.ServeHTTP(w, r)
+			return
+		}
+		// List the unpacked size of every version
+		rec := httptest.NewRecorder()
+		registry.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			w.WriteHeader(rec.Code)
+			return
+		}
+		var document map[string]interface{}
+		is.NoErr(json.Unmarshal(rec.Body.Bytes(), &document))
+		for _, version := range document["versions"].(map[string]interface{}) {
+			if size, ok := sizes[document["name"].(string)]; ok {
+				version.(map[string]interface{})["dist"].(map[string]interface{})["unpackedSize"] = size
+			}
+		}
+		json.NewEncoder(w).Encode(document)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithMaxTotalSize(10_000_000))
+	dir := t.TempDir()
+	err := installer.Install(ctx, dir, "big@1.0.0", "small@1.0.0", "other@1.0.0")
+	is.True(err != nil)
+	is.Equal(err.Error(), "npm: unable to install because the packages unpack to 11.5 MB, which is over the 10.0 MB budget. The largest are big@1.0.0 (8.0 MB), dep@1.0.0 (3.5 MB), small@1.0.0 (1.0 kB), other@1.0.0 (0 B)")
+	// Nothing was downloaded
+	is.Equal(downloads.Load(), int32(0))
+	notExists(t, filepath.Join(dir, "node_modules"))
+	// Installs within the budget, counting aliases as the package they alias
+	is.NoErr(installer.Install(ctx, dir, "dep@1.0.0", "small2@npm:small@1.0.0", "other@1.0.0"))
+	is.Equal(downloads.Load(), int32(3))
+	exists(t, filepath.Join(dir, "node_modules", "small2", "package.json"))
+	// The resolved tree lists the sizes
+	tree, err := installer.Resolve(ctx, "big@1.0.0")
+	is.NoErr(err)
+	is.Equal(tree.Nodes["big@1.0.0"].UnpackedSize, int64(8_000_000))
+	// Local globs are checked as the packages they match
+	dir = t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"packages/a/package.json": `{"name":"a","version":"1.0.0","dependencies":{"big":"^1.0.0"}}`,
+		"packages/b/package.json": `{"name":"b","version":"1.0.0","dependencies":{"small":"^1.0.0"}}`,
+	}))
+	err = installer.Install(ctx, dir, "./packages/*")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "over the 10.0 MB budget"))
+	is.NoErr(npm.New(npm.WithRegistry(server.URL), npm.WithMaxTotalSize(20_000_000)).Install(ctx, dir, "./packages/*"))
+	exists(t, filepath.Join(dir, "node_modules", "a", "package.json"))
+}
@@ -0,0 +1,379 @@
+package npm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// WithCache caches registry metadata and tarballs in dir, like npm's
+// ~/.npm/_cacache. Tarballs are addressed by their integrity hash, so they're
+// only downloaded once, and interrupted downloads are resumed. Registries that
+// don't provide integrity have their tarballs addressed by URL and version
+// instead, which is weaker since a tarball republished at the same URL isn't
+// noticed and the cached copy can't be verified. Cached metadata
+// is revalidated with the registry's ETag, so it's only downloaded again when
+// it changed, and used as-is when the registry can't be reached.
+func WithCache(dir string) Option {
+	return func(in *Installer) {
+		in.cache = dir
+	}
+}
+
+// metadataCachePath returns where a package's metadata is cached
+func (in *Installer) metadataCachePath(pkgName string) string {
+	return filepath.Join(in.cache, "metadata", filepath.FromSlash(pkgName)+".json")
+}
+
+// readCachedMetadata reads a package's metadata from the cache
+func (in *Installer) readCachedMetadata(pkgName string) (*metadata, error) {
+	if in.cache == "" {
+		return nil, fmt.Errorf("npm: no cache for %s: %w", pkgName, os.ErrNotExist)
+	}
+	body, err := os.ReadFile(in.metadataCachePath(pkgName))
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to read cached metadata for %s: %w", pkgName, err)
+	}
+	return parseMetadata(pkgName, body)
+}
+
+// readCachedETag reads the ETag of a package's cached metadata, or returns an
+// empty string if there isn't one
+func (in *Installer) readCachedETag(pkgName string) string {
+	if in.cache == "" {
+		return ""
+	}
+	metadataPath := in.metadataCachePath(pkgName)
+	if _, err := os.Stat(metadataPath); err != nil {
+		return ""
+	}
+	etag, err := os.ReadFile(strings.TrimSuffix(metadataPath, ".json") + ".etag")
+	if err != nil {
+		return ""
+	}
+	return string(etag)
+}
+
+// cacheMetadata writes a package's metadata and its ETag into the cache
+func (in *Installer) cacheMetadata(pkgName string, body []byte, etag string) error {
+	if in.cache == "" {
+		return nil
+	}
+	metadataPath := in.metadataCachePath(pkgName)
+	etagPath := strings.TrimSuffix(metadataPath, ".json") + ".etag"
+	// Remove the old ETag first, so it never describes the wrong metadata
+	if err := os.Remove(etagPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("npm: unable to remove cached etag for %s: %w", pkgName, err)
+	}
+	if err := writeCacheFile(metadataPath, func(w io.Writer) error {
+		_, err := w.Write(body)
+		return err
+	}); err != nil {
+		return fmt.Errorf("npm: unable to cache metadata for %s: %w", pkgName, err)
+	}
+	if etag == "" {
+		return nil
+	}
+	if err := writeCacheFile(etagPath, func(w io.Writer) error {
+		_, err := io.WriteString(w, etag)
+		return err
+	}); err != nil {
+		return fmt.Errorf("npm: unable to cache etag for %s: %w", pkgName, err)
+	}
+	return nil
+}
+
+// tarballCachePath returns where a package's tarball is cached. Tarballs
+// without an integrity hash fall back to being cached by their URL and
+// version.
+func (in *Installer) tarballCachePath(p *remotePackage) (string, bool) {
+	if in.cache == "" {
+		return "", false
+	} else if p.Integrity == "" {
+		if p.url() == "" {
+			return "", false
+		}
+		sum := sha256.Sum256([]byte(p.url() + "@" + p.Version))
+		return filepath.Join(in.cache, "tarballs", "url", hex.EncodeToString(sum[:])+".tgz"), true
+	}
+	algorithm, digest, ok := strings.Cut(p.Integrity, "-")
+	if !ok {
+		return "", false
+	}
+	sum, err := base64.StdEncoding.DecodeString(digest)
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(in.cache, "tarballs", algorithm, hex.EncodeToString(sum)+".tgz"), true
+}
+
+// cacheTarball downloads the package's tarball into the cache unless it's
+// already there, returning how many bytes were downloaded. Interrupted
+// downloads are resumed from where they left off. When the resumed tarball
+// doesn't match its integrity, it's downloaded again from the start.
+func (in *Installer) cacheTarball(ctx context.Context, p *remotePackage, cachePath string) (int64, error) {
+	size, err, _ := in.downloads.Do(cachePath, func() (interface{}, error) {
+		if _, err := os.Stat(cachePath); err == nil {
+			return int64(0), nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return int64(0), fmt.Errorf("npm: unable to stat cached tarball for %s: %w", p.Name, err)
+		}
+		partialPath := cachePath + ".partial"
+		size, resumed, err := in.downloadPartial(ctx, p, cachePath, partialPath)
+		if err != nil && resumed && ctx.Err() == nil {
+			if err := os.Remove(partialPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return int64(0), fmt.Errorf("npm: unable to remove partial tarball for %s: %w", p.Name, err)
+			}
+			size, _, err = in.downloadPartial(ctx, p, cachePath, partialPath)
+		}
+		return size, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size.(int64), nil
+}
+
+// downloadPartial downloads the tarball into the partial file, resuming after
+// the bytes that are already there. The partial file is moved into the cache
+// once the whole tarball matches its integrity, and kept to resume later when
+// the download is interrupted. Resumed is true if the download was resumed.
+// Tarballs without integrity can't be verified once combined, so they're
+// always downloaded from the start.
+func (in *Installer) downloadPartial(ctx context.Context, p *remotePackage, cachePath, partialPath string) (size int64, resumed bool, err error) {
+	var verifier *verifier
+	var sum io.Writer = io.Discard
+	if p.Integrity != "" {
+		verifier, err = newVerifier(p.Integrity, "")
+		if err != nil {
+			return 0, false, fmt.Errorf("unable to verify %s: %w", p.Name, err)
+		}
+		sum = verifier
+	} else if err := os.Remove(partialPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, false, fmt.Errorf("unable to remove partial tarball for %s: %w", p.Name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(partialPath), 0755); err != nil {
+		return 0, false, err
+	}
+	file, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to open partial tarball for %s: %w", p.Name, err)
+	}
+	defer file.Close()
+	// Hash what was already downloaded, so the combined tarball is verified
+	offset, err := io.Copy(sum, file)
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to read partial tarball for %s: %w", p.Name, err)
+	}
+	body, err := in.requestTarball(ctx, p, offset)
+	if err != nil {
+		return 0, offset > 0, err
+	}
+	defer body.Close()
+	if _, ok := body.(*resumedBody); !ok && offset > 0 {
+		// The server sent the whole tarball, so start over
+		if err := file.Truncate(0); err != nil {
+			return 0, false, fmt.Errorf("unable to truncate partial tarball for %s: %w", p.Name, err)
+		} else if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return 0, false, fmt.Errorf("unable to truncate partial tarball for %s: %w", p.Name, err)
+		}
+		if verifier != nil {
+			verifier.Reset()
+		}
+		offset = 0
+	}
+	size, err = io.Copy(file, io.TeeReader(body, sum))
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to download %s: %w", p.Name, err)
+	}
+	// Never cache a tarball that doesn't match its integrity
+	if verifier != nil {
+		if err := verifier.Verify(); err != nil {
+			file.Close()
+			os.Remove(partialPath)
+			return 0, offset > 0, fmt.Errorf("unable to verify %s@%s: %w", p.Name, p.Version, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return 0, false, fmt.Errorf("unable to write partial tarball for %s: %w", p.Name, err)
+	}
+	if err := os.Rename(partialPath, cachePath); err != nil {
+		return 0, false, fmt.Errorf("unable to cache tarball for %s: %w", p.Name, err)
+	}
+	return size, offset > 0, nil
+}
+
+// writeCacheFile writes a file into the cache through a temporary file, so
+// readers never see a partially written file.
+func writeCacheFile(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Prefetch downloads the metadata and tarballs for the packages and their
+// dependencies into the cache without installing them, returning how many
+// bytes were cached. Use WithMaxDepth(0) to only prefetch the packages
+// themselves.
+func Prefetch(ctx context.Context, cacheDir string, packages ...string) (int64, error) {
+	return New(WithCache(cacheDir)).Prefetch(ctx, packages...)
+}
+
+// Prefetch downloads the metadata and tarballs for the packages and their
+// dependencies into the cache without installing them.
+func (in *Installer) Prefetch(ctx context.Context, packages ...string) (int64, error) {
+	if in.cache == "" {
+		return 0, fmt.Errorf("npm: unable to prefetch without a cache. Use npm.WithCache(dir)")
+	}
+	tree, err := in.resolveTree(ctx, "", nil, packages...)
+	if err != nil {
+		return 0, fmt.Errorf("npm: unable to prefetch: %w", err)
+	}
+	var cached atomic.Int64
+	for _, size := range tree.metadataSizes {
+		cached.Add(size)
+	}
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, node := range tree.Nodes {
+		if node.Tarball == "" {
+			continue
+		}
+		pkg := tree.packages[node.key()]
+		if _, err := in.newVerifier(pkg); err != nil {
+			return 0, fmt.Errorf("npm: unable to prefetch: %w", err)
+		}
+		cachePath, ok := in.tarballCachePath(pkg)
+		if !ok {
+			continue
+		}
+		eg.Go(func() error {
+			size, err := in.cacheTarball(ctx, pkg, cachePath)
+			if err != nil {
+				return err
+			}
+			cached.Add(size)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return 0, fmt.Errorf("npm: unable to prefetch: %w", err)
+	}
+	return cached.Load(), nil
+}
+
+// WithVendor installs packages from the tarballs in dir when they're there,
+// before downloading them. Tarballs are named like npm pack names them (e.g.
+// uid-2.0.0.tgz or lukeed-uuid-2.0.1.tgz for @lukeed/uuid). Vendored tarballs
+// are still checked against the registry's integrity, but the registry is
+// still needed to resolve versions unless the metadata is cached.
+func WithVendor(dir string) Option {
+	return func(in *Installer) {
+		in.vendor = dir
+	}
+}
+
+// vendorPath returns where the package's tarball is vendored
+func (in *Installer) vendorPath(p *remotePackage) string {
+	name := p.Name
+	if p.Scope != "" {
+		name = strings.TrimPrefix(p.Scope, "@") + "-" + p.Name
+	}
+	return filepath.Join(in.vendor, name+"-"+p.Version+".tgz")
+}
+
+// WithKeepTarballs keeps the original tarball of every downloaded package in
+// dir, so it can be re-verified later. Tarballs are named by the package's
+// name, version and integrity (e.g. @scope/name-1.0.0-sha512-<hex>.tgz). Only
+// tarballs that pass the integrity check are kept.
+func WithKeepTarballs(dir string) Option {
+	return func(in *Installer) {
+		in.keepTarballs = dir
+	}
+}
+
+// keptTarballPath returns where the package's tarball is kept
+func (in *Installer) keptTarballPath(p *remotePackage) string {
+	name := p.Name + "-" + p.Version
+	if algorithm, digest, ok := strings.Cut(p.Integrity, "-"); ok {
+		if sum, err := base64.StdEncoding.DecodeString(digest); err == nil {
+			name += "-" + algorithm + "-" + hex.EncodeToString(sum)
+		}
+	}
+	return filepath.Join(in.keepTarballs, p.Scope, name+".tgz")
+}
+
+// tarballKeeper writes a copy of a tarball while it's being extracted
+type tarballKeeper struct {
+	*os.File
+	path string
+}
+
+// keepTarball returns a keeper for the package's tarball, or nil if tarballs
+// aren't kept or this one was already kept.
+func (in *Installer) keepTarball(p *remotePackage) (*tarballKeeper, error) {
+	if in.keepTarballs == "" {
+		return nil, nil
+	}
+	keptPath := in.keptTarballPath(p)
+	if _, err := os.Stat(keptPath); err == nil {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(keptPath), 0755); err != nil {
+		return nil, fmt.Errorf("npm: unable to make directory to keep %s: %w", p.Name, err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(keptPath), ".tmp-")
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to keep the tarball for %s: %w", p.Name, err)
+	}
+	return &tarballKeeper{file, keptPath}, nil
+}
+
+// Keep the tarball once it's been verified, after copying whatever is left in
+// the reader
+func (k *tarballKeeper) Keep(rest io.Reader) error {
+	if k == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, rest); err != nil {
+		return fmt.Errorf("npm: unable to keep %s: %w", k.path, err)
+	}
+	if err := k.Close(); err != nil {
+		return fmt.Errorf("npm: unable to keep %s: %w", k.path, err)
+	}
+	if err := os.Rename(k.Name(), k.path); err != nil {
+		return fmt.Errorf("npm: unable to keep %s: %w", k.path, err)
+	}
+	return nil
+}
+
+// Discard the temporary copy if it wasn't kept
+func (k *tarballKeeper) Discard() {
+	if k == nil {
+		return
+	}
+	k.Close()
+	os.Remove(k.Name())
+}
@@ -0,0 +1,371 @@
+package npm_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestPrefetch(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"^2.0.0"}}`,
+			"index.js":     `export const uuid = "uuid"`,
+		},
+	})
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			downloads.Add(1)
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	ctx := context.Background()
+	cache := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithCache(cache))
+	cached, err := installer.Prefetch(ctx, "@lukeed/uuid@^2.0.0")
+	is.NoErr(err)
+	is.True(cached > 0)
+	is.Equal(downloads.Load(), int32(2))
+	// Prefetching again only refreshes the metadata
+	recached, err := installer.Prefetch(ctx, "@lukeed/uuid@^2.0.0")
+	is.NoErr(err)
+	is.True(recached < cached)
+	is.Equal(downloads.Load(), int32(2))
+	// Install entirely from the cache once the registry is gone
+	server.Close()
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "@lukeed/uuid@^2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "@lukeed", "uuid", "index.js"), `export const uuid = "uuid"`)
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+}
+
+func TestPrefetchMaxDepth(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"^2.0.0"}}`,
+		},
+	}))
+	defer server.Close()
+	cache := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithCache(cache), npm.WithMaxDepth(0))
+	_, err := installer.Prefetch(context.Background(), "@lukeed/uuid@^2.0.0")
+	is.NoErr(err)
+	exists(t, filepath.Join(cache, "metadata", "@lukeed", "uuid.json"))
+	notExists(t, filepath.Join(cache, "metadata", "uid.json"))
+	tarballs, err := os.ReadDir(filepath.Join(cache, "tarballs", "sha512"))
+	is.NoErr(err)
+	is.Equal(len(tarballs), 1)
+}
+
+func TestPrefetchWithoutCache(t *testing.T) {
+	is := is.New(t)
+	_, err := npm.New().Prefetch(context.Background(), "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "npm.WithCache"))
+}
+
+func TestKeepTarballs(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"^2.0.0"}}`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	keep := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithCache(t.TempDir()), npm.WithKeepTarballs(keep))
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "@lukeed/uuid@^2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	tarballs, err := filepath.Glob(filepath.Join(keep, "uid-2.0.0-sha512-*.tgz"))
+	is.NoErr(err)
+	is.Equal(len(tarballs), 1)
+	scoped, err := filepath.Glob(filepath.Join(keep, "@lukeed", "uuid-2.0.1-sha512-*.tgz"))
+	is.NoErr(err)
+	is.Equal(len(scoped), 1)
+	// The kept tarball is the original artifact
+	res, err := http.Get(server.URL + "/uid/-/uid-2.0.0.tgz")
+	is.NoErr(err)
+	defer res.Body.Close()
+	original, err := io.ReadAll(res.Body)
+	is.NoErr(err)
+	kept, err := os.ReadFile(tarballs[0])
+	is.NoErr(err)
+	is.Equal(kept, original)
+	// Installing from the cache keeps the tarball too
+	os.RemoveAll(keep)
+	is.NoErr(installer.Install(ctx, t.TempDir(), "uid@2.0.0"))
+	tarballs, err = filepath.Glob(filepath.Join(keep, "uid-2.0.0-sha512-*.tgz"))
+	is.NoErr(err)
+	is.Equal(len(tarballs), 1)
+}
+
+func TestCacheETag(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+	})
+	etag := `"v1"`
+	var notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithCache(t.TempDir()))
+	version, err := installer.Version(ctx, "uid", "*")
+	is.NoErr(err)
+	is.Equal(version, "2.0.0")
+	is.Equal(notModified.Load(), int32(0))
+	// Unchanged metadata is read from the cache
+	version, err = installer.Version(ctx, "uid", "*")
+	is.NoErr(err)
+	is.Equal(version, "2.0.0")
+	is.Equal(notModified.Load(), int32(1))
+	// Changed metadata is downloaded again
+	etag = `"v2"`
+	version, err = installer.Version(ctx, "uid", "*")
+	is.NoErr(err)
+	is.Equal(version, "2.0.0")
+	is.Equal(notModified.Load(), int32(1))
+	version, err = installer.Version(ctx, "uid", "*")
+	is.NoErr(err)
+	is.Equal(version, "2.0.0")
+	is.Equal(notModified.Load(), int32(2))
+}
+
+func TestVendor(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"^2.0.0"}}`,
+			"index.js":     `export const uuid = "uuid"`,
+		},
+	})
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			downloads.Add(1)
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	vendor := t.TempDir()
+	for path, name := range map[string]string{
+		"/uid/-/uid-2.0.0.tgz":           "uid-2.0.0.tgz",
+		"/@lukeed/uuid/-/uuid-2.0.1.tgz": "lukeed-uuid-2.0.1.tgz",
+	} {
+		res, err := http.Get(server.URL + path)
+		is.NoErr(err)
+		tarball, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		is.NoErr(err)
+		is.NoErr(os.WriteFile(filepath.Join(vendor, name), tarball, 0644))
+	}
+	downloads.Store(0)
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithVendor(vendor))
+	is.NoErr(installer.Install(context.Background(), dir, "@lukeed/uuid@^2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "@lukeed", "uuid", "index.js"), `export const uuid = "uuid"`)
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	is.Equal(downloads.Load(), int32(0))
+	// Packages that aren't vendored are downloaded
+	is.NoErr(os.Remove(filepath.Join(vendor, "uid-2.0.0.tgz")))
+	is.NoErr(installer.Install(context.Background(), t.TempDir(), "@lukeed/uuid@^2.0.0"))
+	is.Equal(downloads.Load(), int32(1))
+}
+
+func TestCacheResume(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	var mu sync.Mutex
+	var ranges []string
+	// The tarball is served according to the mode
+	mode := "interrupt"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".tgz") {
+			registry.ServeHTTP(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		registry.ServeHTTP(rec, r)
+		tarball := rec.Body.Bytes()
+		mu.Lock()
+		defer mu.Unlock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		var offset int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset); err != nil {
+			offset = 0
+		}
+		switch {
+		case mode == "interrupt":
+			// Cut the connection halfway through
+			w.Header().Set("Content-Length", strconv.Itoa(len(tarball)))
+			w.Write(tarball[:len(tarball)/2])
+		case offset > 0 && mode == "corrupt":
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(bytes.Repeat([]byte{0}, len(tarball)-offset))
+		case offset > 0:
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(tarball[offset:])
+		default:
+			w.Write(tarball)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	setMode := func(m string) {
+		mu.Lock()
+		mode = m
+		ranges = nil
+		mu.Unlock()
+	}
+	// The rest of the tarball is downloaded after an interruption
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithCache(t.TempDir()))
+	is.True(installer.Install(ctx, t.TempDir(), "uid@2.0.0") != nil)
+	setMode("resume")
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	is.Equal(len(ranges), 1)
+	is.True(strings.HasPrefix(ranges[0], "bytes="))
+	// A corrupt resume falls back to downloading the whole tarball
+	installer = npm.New(npm.WithRegistry(server.URL), npm.WithCache(t.TempDir()))
+	setMode("interrupt")
+	is.True(installer.Install(ctx, t.TempDir(), "uid@2.0.0") != nil)
+	setMode("corrupt")
+	dir = t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	is.Equal(len(ranges), 2)
+	is.True(strings.HasPrefix(ranges[0], "bytes="))
+	is.Equal(ranges[1], "")
+}
+
+func TestCacheWithoutIntegrity(t *testing.T) {
+	is := is.New(t)
+	tarball, err := createTarball(map[string]string{
+		"package.json": `{"name":"uid","version":"2.0.0"}`,
+	})
+	is.NoErr(err)
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/uid/-/uid-2.0.0.tgz" {
+			downloads.Add(1)
+			w.Write(tarball)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":      "uid",
+			"dist-tags": map[string]string{"latest": "2.0.0"},
+			"versions": map[string]interface{}{
+				"2.0.0": map[string]interface{}{
+					"name":    "uid",
+					"version": "2.0.0",
+					"dist": map[string]string{
+						"tarball": "http://" + r.Host + "/uid/-/uid-2.0.0.tgz",
+					},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	cache := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithCache(cache))
+	for i := 0; i < 2; i++ {
+		dir := t.TempDir()
+		is.NoErr(installer.Install(ctx, dir, "uid@^2.0.0"))
+		equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"2.0.0"}`)
+	}
+	is.Equal(downloads.Load(), int32(1))
+	tarballs, err := os.ReadDir(filepath.Join(cache, "tarballs", "url"))
+	is.NoErr(err)
+	is.Equal(len(tarballs), 1)
+}
+
+func TestPreferCached(t *testing.T) {
+	is := is.New(t)
+	var registry atomic.Value
+	registry.Store(registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0": {},
+	}))
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".tgz") {
+			requests.Add(1)
+		}
+		registry.Load().(http.Handler).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	cache := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithCache(cache), npm.WithPreferCached())
+	version, err := installer.Version(ctx, "uid", "^1.0.0")
+	is.NoErr(err)
+	is.Equal(version, "1.0.0")
+	is.Equal(requests.Load(), int32(1))
+	// A newer version is published
+	registry.Store(registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0": {},
+		"uid@1.1.0": {},
+	}))
+	// The cached version satisfies the range, so the registry isn't asked
+	version, err = installer.Version(ctx, "uid", "^1.0.0")
+	is.NoErr(err)
+	is.Equal(version, "1.0.0")
+	is.Equal(requests.Load(), int32(1))
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@^1.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"1.0.0"}`)
+	is.Equal(requests.Load(), int32(1))
+	// Otherwise the registry is asked
+	version, err = installer.Version(ctx, "uid", "^1.1.0")
+	is.NoErr(err)
+	is.Equal(version, "1.1.0")
+	is.Equal(requests.Load(), int32(2))
+	// Without the policy, the metadata is always revalidated
+	installer = npm.New(npm.WithRegistry(server.URL), npm.WithCache(cache))
+	version, err = installer.Version(ctx, "uid", "^1.0.0")
+	is.NoErr(err)
+	is.Equal(version, "1.1.0")
+	is.Equal(requests.Load(), int32(3))
+}
@@ -0,0 +1,216 @@
+package npm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+// CI installs the exact tree described by package-lock.json, similar to
+// `npm ci`. The lockfile must exist and agree with package.json. The lockfile
+// is never modified and node_modules is removed before installing.
+func CI(ctx context.Context, dir string) error {
+	return defaultInstaller.CI(ctx, dir)
+}
+
+// CI installs the exact tree described by package-lock.json. The lockfile must
+// exist and agree with package.json.
+func (in *Installer) CI(ctx context.Context, dir string) error {
+	lock, err := readLockfile(filepath.Join(dir, "package-lock.json"))
+	if err != nil {
+		return fmt.Errorf("npm ci: %w", err)
+	}
+	manifestPath := filepath.Join(dir, "package.json")
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("npm ci: unable to read package.json: %w", err)
+	}
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies,omitempty"`
+		DevDependencies map[string]string `json:"devDependencies,omitempty"`
+	}
+	if err := in.unmarshalManifest(manifest, &pkg); err != nil {
+		return fmt.Errorf("npm ci: unable to unmarshal package.json: %w", err)
+	}
+	if err := checkDrift(lock, pkg.Dependencies, pkg.DevDependencies); err != nil {
+		return fmt.Errorf("npm ci: %w", err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "node_modules")); err != nil {
+		return fmt.Errorf("npm ci: unable to remove node_modules: %w", err)
+	}
+	return in.installLocked(ctx, dir, lock)
+}
+
+// checkDrift ensures the ranges in package.json are satisfied by the versions
+// locked in the lockfile.
+func checkDrift(lock *lockfile, depMaps ...map[string]string) error {
+	var problems []string
+	declared := map[string]string{}
+	for _, deps := range depMaps {
+		for name, constraint := range deps {
+			declared[name] = constraint
+		}
+	}
+	// The root entry records the ranges package.json had when the lockfile was
+	// written, so any difference means package.json changed since.
+	if root, ok := lock.Packages[""]; ok {
+		for _, deps := range []map[string]string{root.Dependencies, root.DevDependencies} {
+			for name, constraint := range deps {
+				if declared, ok := declared[name]; !ok {
+					problems = append(problems, fmt.Sprintf("%s is in the lockfile but not in package.json", name))
+				} else if declared != constraint {
+					problems = append(problems, fmt.Sprintf("%s is %q in package.json but %q in the lockfile", name, declared, constraint))
+				}
+			}
+		}
+	}
+	for name, constraint := range declared {
+		locked, ok := lock.Packages["node_modules/"+name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s@%s is missing from the lockfile", name, constraint))
+			continue
+		}
+		// Local packages don't have a version range to check
+		if isLocal(constraint) || isAbsolute(constraint) || locked.Link {
+			continue
+		}
+		spec, err := ParseSpec(name + "@" + constraint)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s has an invalid spec %q", name, constraint))
+			continue
+		}
+		// Only versions and ranges can be checked, which for aliases is the
+		// range of the aliased package. GitHub, workspace and dist-tag specs
+		// don't have one.
+		if spec.Type != SpecVersion && spec.Type != SpecRange {
+			continue
+		}
+		checker, err := semver.NewConstraint(spec.Version)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s has an invalid range %q: %s", name, constraint, err))
+			continue
+		}
+		version, err := semver.NewVersion(locked.Version)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s has an invalid locked version %q: %s", name, locked.Version, err))
+			continue
+		}
+		if !checker.Check(version) {
+			problems = append(problems, fmt.Sprintf("%s@%s doesn't satisfy %q in package.json", name, locked.Version, constraint))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("package.json and package-lock.json are out of sync: %s", strings.Join(problems, ", "))
+}
+
+// installLocked installs every package in the lockfile at its locked version
+// and location without resolving anything.
+func (in *Installer) installLocked(ctx context.Context, dir string, lock *lockfile) error {
+	s := &session{
+		in:     in,
+		dir:    dir,
+		lock:   newLockfile(dir),
+		locked: true,
+	}
+	defer s.removeStagingDir()
+	var production map[string]bool
+	if in.production {
+		production = lock.production()
+	}
+	// Install parents before the packages nested inside them, so moving a
+	// parent into place doesn't race with installing its nested packages.
+	levels := map[int][]string{}
+	maxDepth := 0
+	for key := range lock.Packages {
+		if production != nil && !production[key] {
+			continue
+		}
+		depth := strings.Count(key, "node_modules/")
+		levels[depth] = append(levels[depth], key)
+		maxDepth = max(maxDepth, depth)
+	}
+	for depth := 1; depth <= maxDepth; depth++ {
+		eg := new(errgroup.Group)
+		for _, key := range levels[depth] {
+			pkg, err := s.lockedPackage(key, lock.Packages[key])
+			if err != nil {
+				return err
+			} else if pkg == nil {
+				continue
+			}
+			eg.Go(func() error {
+				_, err, _ := s.sg.Do(pkg.Key(), func() (interface{}, error) {
+					if err := pkg.Install(ctx, s, 0, nil); err != nil {
+						return nil, fmt.Errorf("npm ci %s: %w", key, err)
+					}
+					return nil, nil
+				})
+				return err
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+	}
+	return s.finish(ctx)
+}
+
+// lockedPackage turns a lockfile entry into an installable package. Entries
+// that aren't installed into node_modules (the root and link targets) return
+// nil.
+func (s *session) lockedPackage(key string, locked *lockPackage) (installable, error) {
+	index := strings.LastIndex(key, "node_modules/")
+	if index == -1 {
+		return nil, nil
+	}
+	if locked.Link || strings.HasPrefix(locked.Resolved, "file:") {
+		pkgPath := filepath.FromSlash(strings.TrimPrefix(locked.Resolved, "file:"))
+		if !filepath.IsAbs(pkgPath) {
+			pkgPath = filepath.Join(s.dir, pkgPath)
+		}
+		pkg, err := s.in.readLocalPackage(pkgPath)
+		if err != nil {
+			return nil, err
+		}
+		// Links are installed where the lockfile puts them, like other entries
+		pkg.Dest = path.Clean(key)
+		return pkg, nil
+	} else if strings.HasPrefix(locked.Resolved, githubProtocol) {
+		pkg, _, err := splitGitHub(key[index+len("node_modules/"):] + "@" + locked.Resolved)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Dest = path.Clean(key)
+		return pkg, nil
+	}
+	pkgName := key[index+len("node_modules/"):]
+	if locked.Name != "" {
+		pkgName = locked.Name
+	}
+	if locked.Version == "" {
+		return nil, fmt.Errorf("npm ci: lockfile entry %q is missing a version", key)
+	}
+	scope, name := parseScope(pkgName)
+	tarball := locked.Resolved
+	if tarball == "" {
+		tarball = s.in.tarballURL(scope, name, locked.Version)
+	}
+	return &remotePackage{
+		Scope:     scope,
+		Name:      name,
+		Version:   locked.Version,
+		Tarball:   tarball,
+		Integrity: locked.Integrity,
+		Path:      path.Clean(key),
+	}, nil
+}
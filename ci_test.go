@@ -0,0 +1,296 @@
+package npm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestCIMissingLockfile(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{
+			"dependencies": {
+				"preact": "^10.19.4"
+			}
+		}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	ctx := context.Background()
+	err := npm.CI(ctx, dir)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "unable to read lockfile"))
+}
+
+func TestCIDrift(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{
+			"dependencies": {
+				"preact": "^10.19.4",
+				"uid": "2.0.0"
+			}
+		}`,
+		"package-lock.json": `{
+			"name": "app",
+			"lockfileVersion": 3,
+			"requires": true,
+			"packages": {
+				"": {
+					"dependencies": {
+						"preact": "^10.19.4",
+						"uid": "2.0.0",
+						"svelte": "^3.0.0"
+					}
+				},
+				"node_modules/preact": {
+					"version": "9.0.0"
+				},
+				"node_modules/svelte": {
+					"version": "3.42.3"
+				}
+			}
+		}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	ctx := context.Background()
+	err := npm.CI(ctx, dir)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "out of sync"))
+	is.True(strings.Contains(err.Error(), `preact@9.0.0 doesn't satisfy "^10.19.4"`))
+	is.True(strings.Contains(err.Error(), "uid@2.0.0 is missing from the lockfile"))
+	is.True(strings.Contains(err.Error(), "svelte is in the lockfile but not in package.json"))
+}
+
+func TestCILocal(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{
+			"dependencies": {
+				"bud": "./local"
+			}
+		}`,
+		"package-lock.json": `{
+			"name": "app",
+			"lockfileVersion": 3,
+			"requires": true,
+			"packages": {
+				"": {
+					"dependencies": {
+						"bud": "./local"
+					}
+				},
+				"node_modules/bud": {
+					"version": "1.0.0",
+					"resolved": "file:local"
+				}
+			}
+		}`,
+		"local/main.ts": `export const main = "main"`,
+		"local/package.json": `{
+			"name": "bud",
+			"version": "1.0.0",
+			"main": "./main.ts"
+		}`,
+		"node_modules/stale/package.json": `{}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	ctx := context.Background()
+	err := npm.CI(ctx, dir)
+	is.NoErr(err)
+	equals(t, filepath.Join(dir, "node_modules", "bud", "main.ts"), files["local/main.ts"])
+	notExists(t, filepath.Join(dir, "node_modules", "stale"))
+	// The lockfile is never modified
+	lock, err := os.ReadFile(filepath.Join(dir, "package-lock.json"))
+	is.NoErr(err)
+	is.Equal(string(lock), files["package-lock.json"])
+}
+
+func TestCINestedLink(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{
+			"dependencies": {
+				"a": "./a"
+			}
+		}`,
+		"package-lock.json": `{
+			"name": "app",
+			"lockfileVersion": 3,
+			"requires": true,
+			"packages": {
+				"": {
+					"dependencies": {
+						"a": "./a"
+					}
+				},
+				"a": {
+					"version": "1.0.0"
+				},
+				"b": {
+					"version": "1.0.0"
+				},
+				"node_modules/a": {
+					"resolved": "a",
+					"link": true
+				},
+				"node_modules/a/node_modules/b": {
+					"resolved": "b",
+					"link": true
+				}
+			}
+		}`,
+		"a/package.json": `{"name":"a","version":"1.0.0","dependencies":{"b":"file:../b"}}`,
+		"b/package.json": `{"name":"b","version":"1.0.0"}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	ctx := context.Background()
+	is.NoErr(npm.CI(ctx, dir))
+	exists(t, filepath.Join(dir, "node_modules", "a", "package.json"))
+	// Nested links are installed at their own path
+	exists(t, filepath.Join(dir, "node_modules", "a", "node_modules", "b", "package.json"))
+	notExists(t, filepath.Join(dir, "node_modules", "b"))
+}
+
+func TestCIProduction(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{
+			"dependencies": {
+				"bud": "./local"
+			},
+			"devDependencies": {
+				"tester": "./tester"
+			}
+		}`,
+		"package-lock.json": `{
+			"name": "app",
+			"lockfileVersion": 3,
+			"requires": true,
+			"packages": {
+				"": {
+					"dependencies": {
+						"bud": "./local"
+					},
+					"devDependencies": {
+						"tester": "./tester"
+					}
+				},
+				"node_modules/bud": {
+					"version": "1.0.0",
+					"resolved": "file:local",
+					"dependencies": {
+						"helper": "./helper"
+					}
+				},
+				"node_modules/helper": {
+					"version": "1.0.0",
+					"resolved": "file:helper"
+				},
+				"node_modules/tester": {
+					"version": "1.0.0",
+					"resolved": "file:tester",
+					"dev": true
+				}
+			}
+		}`,
+		"local/package.json":  `{"name": "bud", "version": "1.0.0"}`,
+		"helper/package.json": `{"name": "helper", "version": "1.0.0"}`,
+		"tester/package.json": `{"name": "tester", "version": "1.0.0"}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	ctx := context.Background()
+	installer := npm.New(npm.WithProduction())
+	err := installer.CI(ctx, dir)
+	is.NoErr(err)
+	exists(t, filepath.Join(dir, "node_modules", "bud", "package.json"))
+	exists(t, filepath.Join(dir, "node_modules", "helper", "package.json"))
+	notExists(t, filepath.Join(dir, "node_modules", "tester"))
+	// Everything is installed without the production flag
+	err = npm.CI(ctx, dir)
+	is.NoErr(err)
+	exists(t, filepath.Join(dir, "node_modules", "tester", "package.json"))
+}
+
+func TestCISpecs(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"react@17.0.2":   {},
+		"preact@10.19.4": {},
+		"a@1.0.0": {
+			"package.json": `{"name":"a","version":"1.0.0","dependencies":{"gh":"github:user/repo"}}`,
+		},
+	})
+	repo, err := createTarball(map[string]string{
+		"package.json": `{"name":"gh","version":"1.0.0"}`,
+	})
+	is.NoErr(err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/user/repo/tarball" {
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(repo)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{
+			"dependencies": {
+				"react17": "npm:react@^17.0.0",
+				"preact": "latest",
+				"a": "1.0.0"
+			}
+		}`,
+		"package-lock.json": `{
+			"name": "app",
+			"lockfileVersion": 3,
+			"requires": true,
+			"packages": {
+				"": {
+					"dependencies": {
+						"react17": "npm:react@^17.0.0",
+						"preact": "latest",
+						"a": "1.0.0"
+					}
+				},
+				"node_modules/react17": {
+					"name": "react",
+					"version": "17.0.2"
+				},
+				"node_modules/preact": {
+					"version": "10.19.4"
+				},
+				"node_modules/a": {
+					"version": "1.0.0"
+				},
+				"node_modules/a/node_modules/gh": {
+					"version": "1.0.0",
+					"resolved": "github:user/repo"
+				}
+			}
+		}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	ctx := context.Background()
+	// Aliases are checked against their range and dist-tags aren't checked
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithGitHubAPI(server.URL))
+	is.NoErr(installer.CI(ctx, dir))
+	exists(t, filepath.Join(dir, "node_modules", "react17", "package.json"))
+	// GitHub packages are installed where the lockfile puts them
+	exists(t, filepath.Join(dir, "node_modules", "a", "node_modules", "gh", "package.json"))
+	notExists(t, filepath.Join(dir, "node_modules", "gh"))
+}
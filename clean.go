@@ -0,0 +1,156 @@
+package npm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CleanScope is what's removed before installing
+type CleanScope int
+
+const (
+	// CleanPackages removes each package's directory before it's installed,
+	// including the packages nested within it.
+	CleanPackages CleanScope = iota + 1
+	// CleanNodeModules removes the whole node_modules directory before
+	// installing, like `rm -rf node_modules && npm install`.
+	CleanNodeModules
+)
+
+// WithCleanInstall removes the existing files before installing, so no stale
+// files are left from a previous version. Packages are otherwise moved into
+// place over their previous version, keeping the packages nested within them.
+func WithCleanInstall(scope CleanScope) Option {
+	return func(in *Installer) {
+		in.clean = scope
+	}
+}
+
+// cleanNodeModules removes dir/node_modules if the whole directory is cleaned
+func (in *Installer) cleanNodeModules(dir string) error {
+	if in.clean != CleanNodeModules {
+		return nil
+	}
+	nodeModules := filepath.Join(dir, "node_modules")
+	if err := os.RemoveAll(nodeModules); err != nil {
+		return fmt.Errorf("npm: unable to remove %s: %w", nodeModules, err)
+	}
+	return nil
+}
+
+// cleanPackage removes the package's directory if packages are cleaned. Parents
+// are always installed before the packages nested in them, so this never
+// removes a package installed in the same session.
+func (s *session) cleanPackage(pkgDir string) error {
+	if s.in.clean != CleanPackages {
+		return nil
+	}
+	if err := os.RemoveAll(pkgDir); err != nil {
+		return fmt.Errorf("unable to remove %s: %w", pkgDir, err)
+	}
+	return nil
+}
+
+// Clean removes the packages in dir/node_modules that an interrupted install
+// left broken, so the next install fetches them again. Packages are broken
+// when their package.json is missing or invalid, names another package, or
+// has a different version than the hidden lockfile says was installed.
+// Leftover staging directories are removed too. Clean returns the paths of
+// the removed packages relative to dir (e.g. node_modules/@scope/name).
+func Clean(dir string) ([]string, error) {
+	return defaultInstaller.Clean(dir)
+}
+
+// Clean removes the packages in dir/node_modules that an interrupted install
+// left broken.
+func (in *Installer) Clean(dir string) ([]string, error) {
+	lock, err := readLockfile(filepath.Join(dir, "node_modules", ".package-lock.json"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("npm: unable to clean %s: %w", dir, err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "node_modules", ".staging")); err != nil {
+		return nil, fmt.Errorf("npm: unable to clean %s: %w", dir, err)
+	}
+	removed, err := in.cleanBroken(dir, "node_modules", lock)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to clean %s: %w", dir, err)
+	}
+	if err := unlockKeys(dir, removed); err != nil {
+		return nil, fmt.Errorf("npm: unable to clean %s: %w", dir, err)
+	}
+	return removed, nil
+}
+
+// cleanBroken removes the broken packages in the node_modules directory at
+// nodeModules, which is relative to dir, along with the broken packages nested
+// within them
+func (in *Installer) cleanBroken(dir, nodeModules string, lock *lockfile) (removed []string, err error) {
+	entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(nodeModules)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		// Skip files, links and hidden directories like .bin
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		// Scoped packages may be flattened with WithScopedLayout
+		if !strings.HasPrefix(entry.Name(), "@") || fileExists(filepath.Join(dir, filepath.FromSlash(nodeModules)), entry.Name()+"/package.json") {
+			names = append(names, entry.Name())
+			continue
+		}
+		scoped, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(nodeModules), entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range scoped {
+			if pkg.IsDir() && !strings.HasPrefix(pkg.Name(), ".") {
+				names = append(names, entry.Name()+"/"+pkg.Name())
+			}
+		}
+	}
+	for _, name := range names {
+		key := path.Join(nodeModules, name)
+		pkgDir := filepath.Join(dir, filepath.FromSlash(key))
+		var locked *lockPackage
+		if lock != nil {
+			locked = lock.Packages[key]
+		}
+		if in.brokenPackage(pkgDir, name, locked) {
+			if err := os.RemoveAll(pkgDir); err != nil {
+				return nil, err
+			}
+			removed = append(removed, key)
+			continue
+		}
+		nested, err := in.cleanBroken(dir, path.Join(key, "node_modules"), lock)
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, nested...)
+	}
+	return removed, nil
+}
+
+// brokenPackage returns true if the package's package.json is missing, invalid
+// or doesn't match what the lockfile says was installed
+func (in *Installer) brokenPackage(pkgDir, name string, locked *lockPackage) bool {
+	manifest, err := readManifest(filepath.Join(pkgDir, "package.json"), in.lenientJSON)
+	if err != nil {
+		return true
+	} else if locked != nil && locked.Name != "" {
+		// Aliased packages are locked with their real name
+		return manifest.Name != locked.Name || manifest.Version != locked.Version
+	} else if in.moduleDir(manifest.Name) != name {
+		return true
+	}
+	return locked != nil && manifest.Version != locked.Version
+}
@@ -0,0 +1,119 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestCleanInstall(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	root := t.TempDir()
+	is.NoErr(writeFiles(root, map[string]string{
+		"bud/package.json": `{"name":"bud","version":"1.0.0","main":"index.js"}`,
+		"bud/index.js":     `export const bud = "bud"`,
+	}))
+	pkgDir := filepath.Join(root, "bud")
+	stale := map[string]string{
+		"node_modules/bud/old.js":                           `export const old = "old"`,
+		"node_modules/bud/node_modules/nested/package.json": `{"name":"nested"}`,
+		"node_modules/other/package.json":                   `{"name":"other"}`,
+	}
+	// Packages are moved into place over the previous version by default
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, stale))
+	is.NoErr(npm.Install(ctx, dir, pkgDir))
+	_, err := os.Stat(filepath.Join(dir, "node_modules", "bud", "node_modules", "nested", "package.json"))
+	is.NoErr(err)
+	// Only the installed packages are removed
+	dir = t.TempDir()
+	is.NoErr(writeFiles(dir, stale))
+	is.NoErr(npm.New(npm.WithCleanInstall(npm.CleanPackages)).Install(ctx, dir, pkgDir))
+	_, err = os.Stat(filepath.Join(dir, "node_modules", "bud", "index.js"))
+	is.NoErr(err)
+	_, err = os.Stat(filepath.Join(dir, "node_modules", "bud", "old.js"))
+	is.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "node_modules", "bud", "node_modules"))
+	is.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "node_modules", "other", "package.json"))
+	is.NoErr(err)
+	// The whole node_modules is removed
+	dir = t.TempDir()
+	is.NoErr(writeFiles(dir, stale))
+	is.NoErr(npm.New(npm.WithCleanInstall(npm.CleanNodeModules)).Install(ctx, dir, pkgDir))
+	_, err = os.Stat(filepath.Join(dir, "node_modules", "bud", "index.js"))
+	is.NoErr(err)
+	_, err = os.Stat(filepath.Join(dir, "node_modules", "other"))
+	is.True(os.IsNotExist(err))
+}
+
+func TestClean(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{"name": "a", "version": "1.0.0", "dependencies": {"uid": "^2.0.0"}}`,
+		},
+		"uid@2.0.0":          {},
+		"@lukeed/uuid@2.0.1": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	is.NoErr(installer.Install(ctx, dir, "a@1.0.0", "@lukeed/uuid@2.0.1"))
+	// Break packages like an interrupted install would
+	nodeModules := filepath.Join(dir, "node_modules")
+	is.NoErr(os.Remove(filepath.Join(nodeModules, "uid", "package.json")))
+	is.NoErr(writeFiles(nodeModules, map[string]string{
+		"@lukeed/uuid/package.json":      `{"name":"@lukeed/uuid","version":"2.0.0"}`,
+		"a/node_modules/b/index.js":      `export const b = "b"`,
+		".staging/uid-123/package.json":  `{"name":"uid"}`,
+		".bin/keep":                      `#!/bin/sh`,
+		"a/node_modules/ok/package.json": `{"name":"ok","version":"1.0.0"}`,
+		"@lukeed/.uuid-456/package.json": `{}`,
+	}))
+	removed, err := installer.Clean(dir)
+	is.NoErr(err)
+	is.Equal(removed, []string{"node_modules/@lukeed/uuid", "node_modules/a/node_modules/b", "node_modules/uid"})
+	for _, path := range []string{"a/package.json", "a/node_modules/ok/package.json", ".bin/keep"} {
+		_, err := os.Stat(filepath.Join(nodeModules, path))
+		is.NoErr(err)
+	}
+	_, err = os.Stat(filepath.Join(nodeModules, ".staging"))
+	is.True(os.IsNotExist(err))
+	// The removed packages are unlocked
+	lock, err := os.ReadFile(filepath.Join(nodeModules, ".package-lock.json"))
+	is.NoErr(err)
+	is.True(strings.Contains(string(lock), `"node_modules/a"`))
+	is.True(!strings.Contains(string(lock), `"node_modules/uid"`))
+	// Cleaning again removes nothing
+	removed, err = installer.Clean(dir)
+	is.NoErr(err)
+	is.Equal(len(removed), 0)
+}
+
+func TestCleanFlatScopes(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"@lukeed/uuid@2.0.1": {
+			"lib/index.js": `export const uuid = "uuid"`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithScopedLayout(npm.FlatScopes))
+	is.NoErr(installer.Install(ctx, dir, "@lukeed/uuid@2.0.1"))
+	// Flattened scoped packages are checked as packages, not as scopes
+	removed, err := installer.Clean(dir)
+	is.NoErr(err)
+	is.Equal(len(removed), 0)
+	exists(t, filepath.Join(dir, "node_modules", "@lukeed%2fuuid", "lib", "index.js"))
+}
@@ -0,0 +1,67 @@
+package npm
+
+import (
+	"regexp"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// WithVersionCoercion makes versions in the registry that aren't valid
+// semantic versions (e.g. 1.2.3.4 or 2.0.0rc1) selectable by coercing them
+// like node-semver's coerce, which keeps the first major.minor.patch in the
+// version. They're otherwise ignored. Valid versions win over coerced ones, so
+// 1.2.3.4 is only selectable as 1.2.3 when there's no real 1.2.3. Packages
+// are still installed with their original version.
+func WithVersionCoercion() Option {
+	return func(in *Installer) {
+		in.coerceVersions = true
+	}
+}
+
+var coercible = regexp.MustCompile(`(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// coerceVersion returns the major.minor.patch in the version, if any
+func coerceVersion(version string) (string, bool) {
+	match := coercible.FindStringSubmatch(version)
+	if match == nil {
+		return "", false
+	}
+	for i := 2; i <= 3; i++ {
+		if match[i] == "" {
+			match[i] = "0"
+		}
+	}
+	return match[1] + "." + match[2] + "." + match[3], true
+}
+
+// coerce adds the invalid versions under their coerced version
+func (m *metadata) coerce() {
+	for version, meta := range m.Versions {
+		if _, err := semver.NewVersion(version); err == nil {
+			continue
+		}
+		coerced, ok := coerceVersion(version)
+		if !ok {
+			continue
+		}
+		// Valid versions win, otherwise the first original version by name
+		if _, ok := m.Versions[coerced]; ok && m.coerced[coerced] == "" {
+			continue
+		} else if original, ok := m.coerced[coerced]; ok && original < version {
+			continue
+		}
+		if m.coerced == nil {
+			m.coerced = map[string]string{}
+		}
+		m.Versions[coerced] = meta
+		m.coerced[coerced] = version
+	}
+}
+
+// original returns the version a coerced version was coerced from
+func (m *metadata) original(version string) string {
+	if original, ok := m.coerced[version]; ok {
+		return original
+	}
+	return version
+}
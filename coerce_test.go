@@ -0,0 +1,84 @@
+package npm_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestVersionCoercion(t *testing.T) {
+	is := is.New(t)
+	versions := []string{"1.0.0", "1.2.3.4", "2.0.0rc1"}
+	tarballs := map[string][]byte{}
+	for _, version := range versions {
+		tarball, err := createTarball(map[string]string{
+			"package.json": `{"name":"legacy","version":"` + version + `"}`,
+		})
+		is.NoErr(err)
+		tarballs["/legacy/-/legacy-"+version+".tgz"] = tarball
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tarball, ok := tarballs[r.URL.Path]; ok {
+			w.Write(tarball)
+			return
+		} else if r.URL.Path != "/legacy" {
+			http.NotFound(w, r)
+			return
+		}
+		docVersions := map[string]interface{}{}
+		for _, version := range versions {
+			docVersions[version] = map[string]interface{}{
+				"name":    "legacy",
+				"version": version,
+				"dist": map[string]string{
+					"tarball": "http://" + r.Host + "/legacy/-/legacy-" + version + ".tgz",
+				},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":      "legacy",
+			"dist-tags": map[string]string{"latest": "1.0.0"},
+			"versions":  docVersions,
+		})
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	// Invalid versions are ignored by default
+	installer := npm.New(npm.WithRegistry(server.URL))
+	_, err := installer.Version(ctx, "legacy", "^1.2.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "no matching version"))
+	// They're selectable once coerced, but installed as-is
+	installer = npm.New(npm.WithRegistry(server.URL), npm.WithVersionCoercion())
+	version, err := installer.Version(ctx, "legacy", "^1.2.0")
+	is.NoErr(err)
+	is.Equal(version, "1.2.3.4")
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "legacy@^2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "legacy", "package.json"), `{"name":"legacy","version":"2.0.0rc1"}`)
+	// Invalid versions can be logged
+	logs := new(bytes.Buffer)
+	installer = npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithInvalidVersions(npm.WarnInvalidVersions),
+		npm.WithLogger(slog.New(slog.NewTextHandler(logs, nil))),
+	)
+	version, err = installer.Version(ctx, "legacy", "*")
+	is.NoErr(err)
+	is.Equal(version, "1.0.0")
+	is.True(strings.Contains(logs.String(), `level=WARN msg="npm: skipping versions of legacy that aren't valid semantic versions" package=legacy versions="[1.2.3.4 2.0.0rc1]"`))
+	// Or rejected
+	installer = npm.New(npm.WithRegistry(server.URL), npm.WithInvalidVersions(npm.RejectInvalidVersions))
+	_, err = installer.Version(ctx, "legacy", "*")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "legacy has versions that aren't valid semantic versions: 1.2.3.4, 2.0.0rc1"))
+}
@@ -0,0 +1,42 @@
+package npm
+
+import (
+	"io"
+	"sync"
+)
+
+// WithCopyBufferSize sets the size of the buffer used to write each file when
+// extracting tarballs and copying local packages. Bigger buffers mean fewer
+// syscalls for packages with large files. Defaults to io.Copy's 32KB buffer,
+// which also lets the kernel copy between files directly where it can.
+func WithCopyBufferSize(size int) Option {
+	return func(in *Installer) {
+		if size <= 0 {
+			in.copier = nil
+			return
+		}
+		in.copier = &copier{size: size}
+	}
+}
+
+// copier copies files through pooled buffers of the same size. A nil copier
+// uses io.Copy.
+type copier struct {
+	size int
+	pool sync.Pool
+}
+
+// Copy src into dst through a buffer
+func (c *copier) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	if c == nil {
+		return io.Copy(dst, src)
+	}
+	buf, ok := c.pool.Get().(*[]byte)
+	if !ok {
+		b := make([]byte, c.size)
+		buf = &b
+	}
+	defer c.pool.Put(buf)
+	// Hide ReadFrom and WriteTo, otherwise io.CopyBuffer ignores the buffer
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
@@ -0,0 +1,63 @@
+package npm_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestCopyBufferSize(t *testing.T) {
+	is := is.New(t)
+	large := strings.Repeat("export const a = 1\n", 100_000)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"big@1.0.0": {
+			"index.js": large,
+		},
+	}))
+	defer server.Close()
+	root := t.TempDir()
+	is.NoErr(writeFiles(root, map[string]string{
+		"local/package.json": `{"name":"local","version":"1.0.0","main":"index.js"}`,
+		"local/index.js":     large,
+	}))
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithCopyBufferSize(1<<20))
+	is.NoErr(installer.Install(context.Background(), dir, "big@1.0.0", filepath.Join(root, "local")))
+	equals(t, filepath.Join(dir, "node_modules", "big", "index.js"), large)
+	equals(t, filepath.Join(dir, "node_modules", "local", "index.js"), large)
+}
+
+func BenchmarkCopyBufferSize(b *testing.B) {
+	root := b.TempDir()
+	files := map[string]string{
+		"local/package.json": `{"name":"local","version":"1.0.0","files":["lib"]}`,
+	}
+	chunk := bytes.Repeat([]byte("x"), 8<<20)
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("local/lib/%d.js", i)] = string(chunk)
+	}
+	if err := writeFiles(root, files); err != nil {
+		b.Fatal(err)
+	}
+	pkgDir := filepath.Join(root, "local")
+	for _, size := range []int{0, 32 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			installer := npm.New(npm.WithCopyBufferSize(size))
+			for i := 0; i < b.N; i++ {
+				dir := b.TempDir()
+				if err := installer.Install(context.Background(), dir, pkgDir); err != nil {
+					b.Fatal(err)
+				}
+				os.RemoveAll(dir)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package npm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// download is a tarball download shared by everyone installing the same URL at
+// the same time (e.g. an alias and the package it aliases). It isn't tied to
+// any one caller's context, so it's only cancelled once every caller has given
+// up on it.
+type download struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// callers is guarded by the installer's sharedMu
+	callers int
+	body    io.ReadCloser
+	once    sync.Once
+	done    chan struct{}
+	data    []byte
+	err     error
+}
+
+// requestShared requests the package's tarball, sharing the download with
+// concurrent requests for the same URL. A download with one caller is streamed
+// to it, while a shared download is read into memory for each of its callers.
+func (in *Installer) requestShared(ctx context.Context, p *remotePackage) (io.ReadCloser, error) {
+	url := p.url()
+	if url == "" {
+		return in.requestTarball(ctx, p, 0)
+	}
+	in.sharedMu.Lock()
+	d, ok := in.shared[url]
+	if !ok {
+		downloadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		d = &download{ctx: downloadCtx, cancel: cancel, done: make(chan struct{})}
+		if in.shared == nil {
+			in.shared = map[string]*download{}
+		}
+		in.shared[url] = d
+	}
+	d.callers++
+	flight := in.downloads.DoChan(url, func() (interface{}, error) {
+		body, err := in.requestTarball(d.ctx, p, 0)
+		// Callers that come after the response start a new download
+		in.sharedMu.Lock()
+		delete(in.shared, url)
+		in.downloads.Forget(url)
+		in.sharedMu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		d.body = body
+		return d, nil
+	})
+	in.sharedMu.Unlock()
+	select {
+	case <-ctx.Done():
+		in.leaveDownload(d)
+		// Release the response once it arrives
+		go func() {
+			if res := <-flight; res.Err == nil {
+				d.abandon(res.Shared)
+			}
+		}()
+		return nil, fmt.Errorf("unable to download %s: %w", p.Name, ctx.Err())
+	case res := <-flight:
+		if res.Err != nil {
+			in.leaveDownload(d)
+			return nil, res.Err
+		}
+		if !res.Shared {
+			stop := context.AfterFunc(ctx, d.cancel)
+			return &downloadBody{ReadCloser: d.body, release: func() {
+				stop()
+				in.leaveDownload(d)
+			}}, nil
+		}
+	}
+	go d.once.Do(d.buffer)
+	select {
+	case <-ctx.Done():
+		in.leaveDownload(d)
+		return nil, fmt.Errorf("unable to download %s: %w", p.Name, ctx.Err())
+	case <-d.done:
+	}
+	in.leaveDownload(d)
+	if d.err != nil {
+		return nil, fmt.Errorf("unable to download %s: %w", p.Name, d.err)
+	}
+	return io.NopCloser(bytes.NewReader(d.data)), nil
+}
+
+// leaveDownload removes a caller from the download, cancelling it once every
+// caller has left
+func (in *Installer) leaveDownload(d *download) {
+	in.sharedMu.Lock()
+	d.callers--
+	last := d.callers == 0
+	in.sharedMu.Unlock()
+	if last {
+		d.cancel()
+	}
+}
+
+// buffer reads the whole tarball into memory for the callers sharing it
+func (d *download) buffer() {
+	d.data, d.err = io.ReadAll(d.body)
+	d.body.Close()
+	close(d.done)
+}
+
+// abandon releases a response that its caller gave up on. Shared responses
+// are still read for the other callers.
+func (d *download) abandon(shared bool) {
+	if shared {
+		d.once.Do(d.buffer)
+		return
+	}
+	d.body.Close()
+}
+
+// downloadBody is the body of a download that's streamed to its only caller
+type downloadBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *downloadBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
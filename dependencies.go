@@ -0,0 +1,75 @@
+package npm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// WithDependencyFields sets which fields of an installed package's
+// package.json are installed transitively (e.g. "dependencies" and
+// "optionalDependencies"). Failures installing optionalDependencies are
+// ignored like npm does. Defaults to "dependencies".
+func WithDependencyFields(fields ...string) Option {
+	return func(in *Installer) {
+		in.depFields = fields
+	}
+}
+
+// dependencies of an installed package that are installed transitively
+type dependencies struct {
+	Required map[string]string
+	Optional map[string]string
+}
+
+// readDependencies reads the configured dependency fields from a package.json.
+// Later fields win when a dependency is listed in several, except that
+// optional dependencies always win like in npm.
+func (in *Installer) readDependencies(manifest []byte) (*dependencies, error) {
+	var fields map[string]json.RawMessage
+	if err := in.unmarshalManifest(manifest, &fields); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal package.json: %w", err)
+	}
+	deps := &dependencies{
+		Required: map[string]string{},
+		Optional: map[string]string{},
+	}
+	for _, field := range in.depFields {
+		value, ok := fields[field]
+		if !ok {
+			continue
+		}
+		var specs map[string]string
+		if err := json.Unmarshal(value, &specs); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal %s in package.json: %w", field, err)
+		}
+		for name, spec := range specs {
+			if field == "optionalDependencies" {
+				deps.Optional[name] = spec
+				continue
+			}
+			deps.Required[name] = spec
+		}
+	}
+	for name := range deps.Optional {
+		delete(deps.Required, name)
+	}
+	return deps, nil
+}
+
+// installTransitive installs the dependencies of the package at parent, which
+// is at depth
+func (s *session) installTransitive(ctx context.Context, parent string, deps *dependencies, depth int, overrides *overrides) error {
+	eg := s.group()
+	eg.Go(func() error {
+		return s.installDependencies(ctx, parent, deps.Required, depth, overrides)
+	})
+	for name, spec := range deps.Optional {
+		eg.Go(func() error {
+			// Optional dependencies that fail to install are skipped
+			s.installDependencies(ctx, parent, map[string]string{name: spec}, depth, overrides)
+			return nil
+		})
+	}
+	return eg.Wait()
+}
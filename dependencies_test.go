@@ -0,0 +1,51 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestDependencyFields(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{
+				"name": "a",
+				"version": "1.0.0",
+				"dependencies": {"b": "^1.0.0"},
+				"optionalDependencies": {"c": "^1.0.0", "missing": "^1.0.0"},
+				"devDependencies": {"d": "^1.0.0"}
+			}`,
+		},
+		"b@1.0.0": {},
+		"c@1.0.0": {},
+		"d@1.0.0": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	// Only dependencies are installed by default
+	dir := t.TempDir()
+	is.NoErr(npm.New(npm.WithRegistry(server.URL)).Install(ctx, dir, "a@1.0.0"))
+	exists(t, filepath.Join(dir, "node_modules", "b", "package.json"))
+	notExists(t, filepath.Join(dir, "node_modules", "c"))
+	notExists(t, filepath.Join(dir, "node_modules", "d"))
+	// Optional dependencies that can't be installed are skipped
+	dir = t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithDependencyFields("dependencies", "optionalDependencies"))
+	is.NoErr(installer.Install(ctx, dir, "a@1.0.0"))
+	exists(t, filepath.Join(dir, "node_modules", "b", "package.json"))
+	exists(t, filepath.Join(dir, "node_modules", "c", "package.json"))
+	notExists(t, filepath.Join(dir, "node_modules", "missing"))
+	notExists(t, filepath.Join(dir, "node_modules", "d"))
+	// Fields can be excluded too
+	dir = t.TempDir()
+	installer = npm.New(npm.WithRegistry(server.URL), npm.WithDependencyFields("devDependencies"))
+	is.NoErr(installer.Install(ctx, dir, "a@1.0.0"))
+	notExists(t, filepath.Join(dir, "node_modules", "b"))
+	exists(t, filepath.Join(dir, "node_modules", "d", "package.json"))
+}
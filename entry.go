@@ -0,0 +1,273 @@
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// EntryPoint returns the path to the entry file of an installed package in
+// dir/node_modules. The package name may include a subpath (e.g.
+// react/jsx-runtime). The condition (e.g. "import", "require" or "browser") is
+// applied to the package's exports, falling back to the "browser", "module"
+// and "main" fields for packages without exports. The "types" condition
+// resolves the type declarations instead, like TypeScript does.
+func EntryPoint(dir, pkgName, condition string) (string, error) {
+	info, err := Info(dir, pkgName, condition)
+	if err != nil {
+		return "", err
+	}
+	return info.EntryPoint, nil
+}
+
+// PackageInfo describes an installed package for bundlers
+type PackageInfo struct {
+	Name    string
+	Version string
+	// EntryPoint is the path to the entry file, resolved like EntryPoint
+	EntryPoint string
+	// SideEffects is the package's sideEffects field. It's nil when the field is
+	// missing, in which case every file should be assumed to have side effects.
+	SideEffects *SideEffects
+}
+
+// SideEffects is the sideEffects field of a package.json, which tells bundlers
+// which files can be dropped when their exports aren't used. It's either a
+// boolean or a list of globs matching the files with side effects.
+type SideEffects struct {
+	// All is true when every file has side effects
+	All bool
+	// Files are the globs matching the files with side effects
+	Files []string
+}
+
+func (s *SideEffects) UnmarshalJSON(data []byte) error {
+	s.All, s.Files = false, nil
+	if err := json.Unmarshal(data, &s.All); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &s.Files); err == nil {
+		return nil
+	}
+	// Bundlers assume side effects for any other value
+	s.All = true
+	return nil
+}
+
+func (s *SideEffects) MarshalJSON() ([]byte, error) {
+	if s.Files != nil {
+		return json.Marshal(s.Files)
+	}
+	return json.Marshal(s.All)
+}
+
+// Browser is the browser field of a package.json. It's either the entry file
+// for browsers or a map of files to replace in browser builds, where false
+// ignores the file.
+// Based on: https://github.com/defunctzombie/package-browser-field-spec
+type Browser struct {
+	// Entry is the entry file for browsers
+	Entry string
+	// Files maps files (e.g. ./node.js) to their replacements. Ignored files map
+	// to an empty string.
+	Files map[string]string
+}
+
+func (b *Browser) UnmarshalJSON(data []byte) error {
+	b.Entry, b.Files = "", nil
+	if err := json.Unmarshal(data, &b.Entry); err == nil {
+		return nil
+	}
+	var files map[string]json.RawMessage
+	if err := json.Unmarshal(data, &files); err != nil {
+		// Bundlers ignore any other value
+		return nil
+	}
+	b.Files = make(map[string]string, len(files))
+	for file, replacement := range files {
+		var to string
+		// False and any other value ignores the file
+		json.Unmarshal(replacement, &to)
+		b.Files[file] = to
+	}
+	return nil
+}
+
+func (b *Browser) MarshalJSON() ([]byte, error) {
+	if b.Files == nil {
+		return json.Marshal(b.Entry)
+	}
+	files := make(map[string]interface{}, len(b.Files))
+	for file, to := range b.Files {
+		if to == "" {
+			files[file] = false
+			continue
+		}
+		files[file] = to
+	}
+	return json.Marshal(files)
+}
+
+// entry returns the browser entry file of a package whose main file is main,
+// or an empty string when browsers use main
+func (b *Browser) entry(main string) string {
+	if b == nil {
+		return ""
+	} else if b.Entry != "" {
+		return b.Entry
+	}
+	for file, to := range b.Files {
+		if to != "" && cleanExport(file) == cleanExport(main) {
+			return to
+		}
+	}
+	return ""
+}
+
+// paths returns the files within the package that browsers use
+func (b *Browser) paths() (paths []string) {
+	if b == nil {
+		return nil
+	} else if b.Entry != "" {
+		return []string{b.Entry}
+	}
+	for _, to := range b.Files {
+		if strings.HasPrefix(to, "./") {
+			paths = append(paths, to)
+		}
+	}
+	return paths
+}
+
+// Info returns the entry point and the bundler-related fields of an installed
+// package in dir/node_modules. The package name and condition are the same as
+// EntryPoint's.
+func Info(dir, pkgName, condition string) (*PackageInfo, error) {
+	name, subpath := splitSubpath(pkgName)
+	pkgDir := filepath.Join(dir, "node_modules", filepath.FromSlash(name))
+	manifest, err := readManifest(filepath.Join(pkgDir, "package.json"), false)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := entryPoint(pkgDir, name, subpath, condition, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &PackageInfo{
+		Name:        manifest.Name,
+		Version:     manifest.Version,
+		EntryPoint:  entry,
+		SideEffects: manifest.SideEffects,
+	}, nil
+}
+
+// entryPoint resolves the path to the entry file of the package in pkgDir
+func entryPoint(pkgDir, name, subpath, condition string, manifest *Manifest) (string, error) {
+	if condition == "types" {
+		return typesEntry(pkgDir, name, subpath, manifest)
+	}
+	if manifest.Exports != nil {
+		target, ok := manifest.Exports.Resolve(subpath, condition)
+		if !ok {
+			return "", fmt.Errorf("npm: %s doesn't export %q for the %q condition", name, subpath, condition)
+		}
+		return filepath.Join(pkgDir, filepath.FromSlash(cleanExport(target))), nil
+	}
+	if subpath != "." {
+		return filepath.Join(pkgDir, filepath.FromSlash(cleanExport(subpath))), nil
+	}
+	entry := "index.js"
+	if manifest.Main != "" {
+		entry = manifest.Main
+	}
+	switch browser := manifest.Browser.entry(entry); {
+	case condition == "browser" && browser != "":
+		entry = browser
+	case condition == "import" && manifest.Module != "":
+		entry = manifest.Module
+	}
+	return filepath.Join(pkgDir, filepath.FromSlash(cleanExport(entry))), nil
+}
+
+// typesConditions are the conditions TypeScript matches when resolving type
+// declarations through exports
+var typesConditions = []string{"types", "import", "require"}
+
+// typesEntry resolves the path to the type declarations of the package in
+// pkgDir. JavaScript targets are resolved to the declaration next to them
+// (e.g. index.d.mts for index.mjs), falling back to the legacy "types" and
+// "typings" fields for packages without exports.
+func typesEntry(pkgDir, name, subpath string, manifest *Manifest) (string, error) {
+	var entry string
+	switch {
+	case manifest.Exports != nil:
+		target, ok := manifest.Exports.Resolve(subpath, typesConditions...)
+		if !ok {
+			return "", fmt.Errorf("npm: %s doesn't export types for %q", name, subpath)
+		}
+		entry = target
+	case subpath != ".":
+		entry = subpath
+	case manifest.Types != "":
+		entry = manifest.Types
+	case manifest.Typings != "":
+		entry = manifest.Typings
+	case manifest.Main != "":
+		entry = manifest.Main
+	default:
+		entry = "index.d.ts"
+	}
+	return filepath.Join(pkgDir, filepath.FromSlash(cleanExport(declarationPath(entry)))), nil
+}
+
+// declarationPath returns the path of the declaration file for a JavaScript
+// file, or the path itself when it's already a declaration file
+func declarationPath(entry string) string {
+	for _, ext := range []string{".d.ts", ".d.mts", ".d.cts"} {
+		if strings.HasSuffix(entry, ext) {
+			return entry
+		}
+	}
+	switch ext := path.Ext(entry); ext {
+	case ".js", ".ts":
+		return strings.TrimSuffix(entry, ext) + ".d.ts"
+	case ".mjs", ".mts":
+		return strings.TrimSuffix(entry, ext) + ".d.mts"
+	case ".cjs", ".cts":
+		return strings.TrimSuffix(entry, ext) + ".d.cts"
+	default:
+		return entry + ".d.ts"
+	}
+}
+
+// splitSubpath splits a specifier like @scope/name/feature into the package
+// name and the subpath relative to the package (e.g. ./feature)
+func splitSubpath(specifier string) (name, subpath string) {
+	parts := strings.Split(specifier, "/")
+	n := 1
+	if strings.HasPrefix(specifier, "@") {
+		n = 2
+	}
+	if len(parts) <= n {
+		return specifier, "."
+	}
+	return path.Join(parts[:n]...), "./" + path.Join(parts[n:]...)
+}
+
+func readManifest(manifestPath string, lenient bool) (*Manifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to read %s: %w", manifestPath, err)
+	}
+	if lenient {
+		data = stripJSON(data)
+	}
+	manifest := new(Manifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("npm: unable to unmarshal %s: %w", manifestPath, err)
+	}
+	return manifest, nil
+}
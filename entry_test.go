@@ -0,0 +1,155 @@
+package npm_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestEntryPoint(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"node_modules/exported/package.json": `{
+			"name": "exported",
+			"main": "./main.cjs",
+			"exports": {
+				".": {
+					"browser": "./browser.js",
+					"import": "./index.mjs",
+					"require": "./index.cjs",
+					"default": "./index.js"
+				},
+				"./jsx-runtime": {
+					"import": "./jsx.mjs",
+					"default": "./jsx.js"
+				},
+				"./features/*": "./src/features/*.js"
+			}
+		}`,
+		"node_modules/@scope/fields/package.json": `{
+			"name": "@scope/fields",
+			"main": "./main.js",
+			"module": "./module.js",
+			"browser": "./browser.js"
+		}`,
+		"node_modules/swapped/package.json": `{
+			"name": "swapped",
+			"main": "./node.js",
+			"browser": {
+				"./node.js": "./browser.js",
+				"fs": false
+			}
+		}`,
+		"node_modules/sugar/package.json": `{
+			"name": "sugar",
+			"exports": {
+				"import": "./index.mjs",
+				"default": "./index.cjs"
+			}
+		}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	tests := []struct {
+		pkg       string
+		condition string
+		expect    string
+	}{
+		{"exported", "import", "node_modules/exported/index.mjs"},
+		{"exported", "require", "node_modules/exported/index.cjs"},
+		{"exported", "browser", "node_modules/exported/browser.js"},
+		{"exported", "default", "node_modules/exported/index.js"},
+		{"exported/jsx-runtime", "import", "node_modules/exported/jsx.mjs"},
+		{"exported/jsx-runtime", "require", "node_modules/exported/jsx.js"},
+		{"exported/features/a", "import", "node_modules/exported/src/features/a.js"},
+		{"@scope/fields", "import", "node_modules/@scope/fields/module.js"},
+		{"@scope/fields", "browser", "node_modules/@scope/fields/browser.js"},
+		{"@scope/fields", "require", "node_modules/@scope/fields/main.js"},
+		{"swapped", "browser", "node_modules/swapped/browser.js"},
+		{"swapped", "require", "node_modules/swapped/node.js"},
+		{"sugar", "import", "node_modules/sugar/index.mjs"},
+		{"sugar", "require", "node_modules/sugar/index.cjs"},
+	}
+	for _, test := range tests {
+		entry, err := npm.EntryPoint(dir, test.pkg, test.condition)
+		is.NoErr(err)
+		is.Equal(entry, filepath.Join(dir, filepath.FromSlash(test.expect)))
+	}
+	_, err := npm.EntryPoint(dir, "exported/missing", "import")
+	is.True(err != nil)
+}
+
+func TestInfoSideEffects(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"node_modules/pure/package.json":    `{"name":"pure","version":"1.0.0","module":"./index.mjs","sideEffects":false}`,
+		"node_modules/impure/package.json":  `{"name":"impure","version":"1.0.0","sideEffects":true}`,
+		"node_modules/globs/package.json":   `{"name":"globs","version":"1.0.0","sideEffects":["*.css","./src/polyfill.js"]}`,
+		"node_modules/missing/package.json": `{"name":"missing","version":"1.0.0"}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	info, err := npm.Info(dir, "pure", "import")
+	is.NoErr(err)
+	is.Equal(info.Name, "pure")
+	is.Equal(info.Version, "1.0.0")
+	is.Equal(info.EntryPoint, filepath.Join(dir, "node_modules", "pure", "index.mjs"))
+	is.Equal(info.SideEffects, &npm.SideEffects{All: false})
+	info, err = npm.Info(dir, "impure", "import")
+	is.NoErr(err)
+	is.Equal(info.SideEffects, &npm.SideEffects{All: true})
+	info, err = npm.Info(dir, "globs", "import")
+	is.NoErr(err)
+	is.Equal(info.SideEffects, &npm.SideEffects{Files: []string{"*.css", "./src/polyfill.js"}})
+	info, err = npm.Info(dir, "missing", "import")
+	is.NoErr(err)
+	is.Equal(info.SideEffects, nil)
+}
+
+func TestEntryPointTypes(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		// types is listed last, but still matched first
+		"node_modules/modern/package.json": `{
+			"name": "modern",
+			"types": "./legacy.d.ts",
+			"exports": {
+				".": {
+					"import": "./index.mjs",
+					"default": "./index.js",
+					"types": "./index.d.ts"
+				},
+				"./nested": {
+					"import": {"types": "./nested.d.mts", "default": "./nested.mjs"},
+					"require": {"types": "./nested.d.cts", "default": "./nested.cjs"}
+				},
+				"./untyped": {
+					"require": "./untyped.cjs"
+				}
+			}
+		}`,
+		"node_modules/legacy/package.json": `{"name": "legacy", "main": "./lib/main.js", "typings": "./types/main.d.ts"}`,
+		"node_modules/plain/package.json":  `{"name": "plain", "main": "./lib/main.js"}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	tests := []struct {
+		pkg    string
+		expect string
+	}{
+		{"modern", "node_modules/modern/index.d.ts"},
+		{"modern/nested", "node_modules/modern/nested.d.mts"},
+		{"modern/untyped", "node_modules/modern/untyped.d.cts"},
+		{"legacy", "node_modules/legacy/types/main.d.ts"},
+		{"plain", "node_modules/plain/lib/main.d.ts"},
+	}
+	for _, test := range tests {
+		entry, err := npm.EntryPoint(dir, test.pkg, "types")
+		is.NoErr(err)
+		is.Equal(entry, filepath.Join(dir, filepath.FromSlash(test.expect)))
+	}
+	_, err := npm.EntryPoint(dir, "modern/missing", "types")
+	is.True(err != nil)
+}
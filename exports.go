@@ -0,0 +1,226 @@
+package npm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Exports is the "exports" field in package.json. It maps subpaths (e.g. "."
+// or "./feature") to their targets. The shorthand forms that export a path,
+// a list of fallbacks or a set of conditions are expanded to the "." subpath.
+// Based on: https://nodejs.org/api/packages.html#package-entry-points
+type Exports map[string]*Export
+
+func (e *Exports) UnmarshalJSON(data []byte) error {
+	exports := Exports{}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		export := new(Export)
+		if err := json.Unmarshal(data, export); err != nil {
+			return err
+		}
+		exports["."] = export
+		*e = exports
+		return nil
+	}
+	object := new(jsonObject)
+	if err := json.Unmarshal(data, object); err != nil {
+		return err
+	}
+	// Keys are either all subpaths or all conditions
+	if len(object.keys) > 0 && !strings.HasPrefix(object.keys[0], ".") {
+		export := new(Export)
+		if err := json.Unmarshal(data, export); err != nil {
+			return err
+		}
+		exports["."] = export
+		*e = exports
+		return nil
+	}
+	for _, subpath := range object.keys {
+		export := new(Export)
+		if err := json.Unmarshal(object.values[subpath], export); err != nil {
+			return fmt.Errorf("unable to unmarshal export %q: %w", subpath, err)
+		}
+		exports[subpath] = export
+	}
+	*e = exports
+	return nil
+}
+
+// Resolve the subpath (e.g. "." or "./feature") to a path within the package
+// using the given conditions. Subpath patterns with a "*" are supported.
+func (e Exports) Resolve(subpath string, conditions ...string) (string, bool) {
+	if export, ok := e[subpath]; ok {
+		return export.Resolve(conditions...)
+	}
+	// Find the pattern with the longest prefix that matches
+	patterns := make([]string, 0, len(e))
+	for pattern := range e {
+		if strings.Contains(pattern, "*") {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		return len(patterns[i]) > len(patterns[j])
+	})
+	for _, pattern := range patterns {
+		prefix, suffix, _ := strings.Cut(pattern, "*")
+		if !strings.HasPrefix(subpath, prefix) || !strings.HasSuffix(subpath, suffix) || len(subpath) < len(prefix)+len(suffix) {
+			continue
+		}
+		match := subpath[len(prefix) : len(subpath)-len(suffix)]
+		target, ok := e[pattern].Resolve(conditions...)
+		if !ok {
+			return "", false
+		}
+		return strings.ReplaceAll(target, "*", match), true
+	}
+	return "", false
+}
+
+// Imports is the "imports" field in package.json. It maps private specifiers
+// (e.g. "#internal") to their targets, which take the same forms as exports.
+// Based on: https://nodejs.org/api/packages.html#subpath-imports
+type Imports map[string]*Export
+
+// Resolve the specifier (e.g. "#internal") to its target using the given
+// conditions. Patterns with a "*" are supported.
+func (i Imports) Resolve(specifier string, conditions ...string) (string, bool) {
+	return Exports(i).Resolve(specifier, conditions...)
+}
+
+// Export is the target of an export. It's either a path, a list of fallbacks or
+// a set of conditions. Null targets have none of these.
+type Export struct {
+	Path       string
+	Fallbacks  []*Export
+	Conditions []*Condition
+}
+
+// Condition is a conditional export (e.g. "import" or "require"). Conditions
+// are matched in the order they appear in package.json.
+type Condition struct {
+	Name   string
+	Export *Export
+}
+
+func (e *Export) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return fmt.Errorf("empty export")
+	}
+	switch data[0] {
+	case 'n':
+		return nil
+	case '"':
+		return json.Unmarshal(data, &e.Path)
+	case '[':
+		return json.Unmarshal(data, &e.Fallbacks)
+	case '{':
+		object := new(jsonObject)
+		if err := json.Unmarshal(data, object); err != nil {
+			return err
+		}
+		for _, name := range object.keys {
+			export := new(Export)
+			if err := json.Unmarshal(object.values[name], export); err != nil {
+				return fmt.Errorf("unable to unmarshal %q condition: %w", name, err)
+			}
+			e.Conditions = append(e.Conditions, &Condition{name, export})
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected export %s", data)
+	}
+}
+
+func (e *Export) MarshalJSON() ([]byte, error) {
+	switch {
+	case e.Path != "":
+		return marshalJSON(e.Path)
+	case e.Fallbacks != nil:
+		return marshalJSON(e.Fallbacks)
+	case e.Conditions != nil:
+		object := new(jsonObject)
+		for _, condition := range e.Conditions {
+			value, err := marshalJSON(condition.Export)
+			if err != nil {
+				return nil, err
+			}
+			object.Set(condition.Name, value)
+		}
+		return marshalJSON(object)
+	default:
+		return []byte("null"), nil
+	}
+}
+
+// Resolve the export to a path using the given conditions. The "default"
+// condition always matches. When resolving "types", it's matched before the
+// other conditions, wherever it's listed, like TypeScript expects.
+func (e *Export) Resolve(conditions ...string) (string, bool) {
+	if e == nil {
+		return "", false
+	} else if e.Path != "" {
+		return e.Path, true
+	}
+	for _, fallback := range e.Fallbacks {
+		if target, ok := fallback.Resolve(conditions...); ok {
+			return target, true
+		}
+	}
+	if contains(conditions, "types") {
+		for _, condition := range e.Conditions {
+			if condition.Name != "types" {
+				continue
+			}
+			if target, ok := condition.Export.Resolve(conditions...); ok {
+				return target, true
+			}
+		}
+	}
+	for _, condition := range e.Conditions {
+		if condition.Name != "default" && !contains(conditions, condition.Name) {
+			continue
+		}
+		if target, ok := condition.Export.Resolve(conditions...); ok {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// Paths returns every path the export could resolve to
+func (e *Export) Paths() (paths []string) {
+	if e == nil {
+		return nil
+	} else if e.Path != "" {
+		return []string{e.Path}
+	}
+	for _, fallback := range e.Fallbacks {
+		paths = append(paths, fallback.Paths()...)
+	}
+	for _, condition := range e.Conditions {
+		paths = append(paths, condition.Export.Paths()...)
+	}
+	return paths
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanExport turns an export target like ./index.js into index.js
+func cleanExport(target string) string {
+	return path.Clean(strings.TrimPrefix(target, "./"))
+}
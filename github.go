@@ -0,0 +1,244 @@
+package npm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// githubProtocol prefixes specs that install a package from a GitHub
+// repository (e.g. github:user/repo#main)
+const githubProtocol = "github:"
+
+// WithGitHubAPI sets the GitHub API that repository tarballs are downloaded
+// from, for GitHub Enterprise. Defaults to https://api.github.com.
+func WithGitHubAPI(url string) Option {
+	return func(in *Installer) {
+		in.githubAPI = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithGitHubToken sends the token as a bearer token with requests to the
+// GitHub API, for private repositories. Registry credentials are never sent
+// to GitHub.
+func WithGitHubToken(token string) Option {
+	return func(in *Installer) {
+		in.githubToken = "Bearer " + token
+	}
+}
+
+// githubPackage is a package in a GitHub repository. Monorepos can install a
+// package from a subdirectory with a path modifier, like
+// github:user/repo#main::path:packages/foo or github:user/repo#path:packages/foo.
+type githubPackage struct {
+	// Alias is the name to install the package under. It defaults to the name
+	// in the package's package.json.
+	Alias string
+	// Repo is the user/repo
+	Repo string
+	// Ref is the branch, tag or commit. It defaults to the default branch.
+	Ref string
+	// Subdir is the slash-separated directory of the package in the repository
+	Subdir string
+	// Dest is the path relative to the root directory to install into. Defaults
+	// to node_modules/<name>.
+	Dest string
+
+	// name is the name the package was installed as
+	name string
+}
+
+var _ installable = (*githubPackage)(nil)
+
+// splitGitHub parses a GitHub spec, which is optionally prefixed by the name
+// to install the package under (e.g. foo@github:user/repo)
+func splitGitHub(pkgname string) (*githubPackage, bool, error) {
+	index := strings.Index(pkgname, githubProtocol)
+	if index < 0 || (index > 0 && pkgname[index-1] != '@') {
+		return nil, false, nil
+	}
+	pkg := new(githubPackage)
+	if index > 0 {
+		pkg.Alias = pkgname[:index-1]
+	}
+	repo, fragment, _ := strings.Cut(pkgname[index+len(githubProtocol):], "#")
+	if user, name, ok := strings.Cut(repo, "/"); !ok || user == "" || name == "" || strings.Contains(name, "/") {
+		return nil, true, fmt.Errorf("npm: unable to install %s because the repository isn't user/repo", pkgname)
+	}
+	pkg.Repo = repo
+	for _, modifier := range strings.Split(fragment, "::") {
+		if subdir, ok := strings.CutPrefix(modifier, "path:"); ok {
+			pkg.Subdir = strings.Trim(subdir, "/")
+		} else if modifier != "" {
+			pkg.Ref = modifier
+		}
+	}
+	if pkg.Subdir != "" && !filepath.IsLocal(filepath.FromSlash(pkg.Subdir)) {
+		return nil, true, fmt.Errorf("npm: unable to install %s because the path is outside of the repository", pkgname)
+	}
+	return pkg, true, nil
+}
+
+// Key is where the package is installed or its name when it's known, so it's
+// only installed once
+func (p *githubPackage) Key() string {
+	if p.Dest != "" {
+		return p.Dest
+	} else if p.Alias != "" {
+		return p.Alias
+	}
+	return p.String()
+}
+
+// String returns the package's spec
+func (p *githubPackage) String() string {
+	var modifiers []string
+	if p.Ref != "" {
+		modifiers = append(modifiers, p.Ref)
+	}
+	if p.Subdir != "" {
+		modifiers = append(modifiers, "path:"+p.Subdir)
+	}
+	if len(modifiers) == 0 {
+		return githubProtocol + p.Repo
+	}
+	return githubProtocol + p.Repo + "#" + strings.Join(modifiers, "::")
+}
+
+// tarballURL returns where the repository's tarball is downloaded from
+func (p *githubPackage) tarballURL(api string) string {
+	tarballURL := api + "/repos/" + p.Repo + "/tarball"
+	if p.Ref != "" {
+		tarballURL += "/" + url.PathEscape(p.Ref)
+	}
+	return tarballURL
+}
+
+// Install downloads the repository, then installs the package in its
+// subdirectory like a local package
+func (p *githubPackage) Install(ctx context.Context, s *session, depth int, overrides *overrides) error {
+	if err := os.MkdirAll(s.stagingDir(), 0755); err != nil {
+		return fmt.Errorf("unable to make staging directory: %w", err)
+	}
+	repoDir, err := os.MkdirTemp(s.stagingDir(), "github-")
+	if err != nil {
+		return fmt.Errorf("unable to make temporary directory for %s: %w", p, err)
+	}
+	defer os.RemoveAll(repoDir)
+	if err := s.in.downloadGitHub(ctx, p, repoDir); err != nil {
+		return err
+	}
+	pkgDir := filepath.Join(repoDir, filepath.FromSlash(p.Subdir))
+	manifestJSON, err := os.ReadFile(filepath.Join(pkgDir, "package.json"))
+	if err != nil {
+		return fmt.Errorf("unable to read package.json for %s: %w", p, err)
+	}
+	var manifest Manifest
+	if err := s.in.unmarshalManifest(manifestJSON, &manifest); err != nil {
+		return fmt.Errorf("unable to unmarshal package.json for %s: %w", p, err)
+	}
+	name := p.Alias
+	if name == "" {
+		name = manifest.Name
+	}
+	if name == "" {
+		return fmt.Errorf("unable to install %s because its package.json is missing a name", p)
+	}
+	p.name = name
+	// Unaliased packages are keyed by their spec, so they're also keyed by
+	// their name to only install into the package's directory once
+	if p.Alias == "" && p.Dest == "" {
+		_, err, _ := s.sg.Do(name, func() (interface{}, error) {
+			return nil, p.installDir(ctx, s, name, pkgDir, manifestJSON, &manifest, depth, overrides)
+		})
+		return err
+	}
+	return p.installDir(ctx, s, name, pkgDir, manifestJSON, &manifest, depth, overrides)
+}
+
+// installDir installs the package in pkgDir under name, along with its
+// dependencies
+func (p *githubPackage) installDir(ctx context.Context, s *session, name, pkgDir string, manifestJSON []byte, manifest *Manifest, depth int, overrides *overrides) error {
+	deps, err := s.in.readDependencies(manifestJSON)
+	if err != nil {
+		return fmt.Errorf("unable to read dependencies for %s: %w", p, err)
+	}
+	s.checkLicense(name, manifest.Version, manifestJSON)
+	relDir := path.Join("node_modules", s.in.moduleDir(name))
+	if p.Dest != "" {
+		relDir = p.Dest
+	}
+	nodeDir := filepath.Join(s.dir, filepath.FromSlash(relDir))
+	if err := s.cleanPackage(nodeDir); err != nil {
+		return err
+	}
+	err = replaceDir(s.stagingDir(), nodeDir, s.in.copier, func(tmpDir string) error {
+		return linkFiles(pkgDir, tmpDir, s.in.filter, s.in.copier)
+	})
+	if err != nil {
+		return err
+	}
+	scripts, err := s.in.readScripts(nodeDir, manifestJSON)
+	if err != nil {
+		return err
+	} else if err := s.approveScripts(name, manifest.Version, scripts); err != nil {
+		return err
+	}
+	installed := &InstalledPackage{
+		Name:    name,
+		Version: manifest.Version,
+		Dir:     nodeDir,
+		Scripts: scripts,
+	}
+	s.record(installed)
+	lockName := ""
+	if manifest.Name != name {
+		lockName = manifest.Name
+	}
+	s.lock.Add(nodeDir, &lockPackage{
+		Name:                 lockName,
+		Version:              manifest.Version,
+		Resolved:             p.String(),
+		Dependencies:         manifest.Dependencies,
+		OptionalDependencies: manifest.OptionalDependencies,
+		PeerDependencies:     manifest.PeerDependencies,
+		PeerDependenciesMeta: manifest.PeerDependenciesMeta,
+	})
+	if err := s.installTransitive(ctx, relDir, deps, depth, overrides); err != nil {
+		return err
+	} else if err := s.installPeers(ctx, name, manifest.PeerDependencies, manifest.PeerDependenciesMeta, depth, overrides); err != nil {
+		return err
+	}
+	s.subtreeInstalled(installed)
+	return nil
+}
+
+// downloadGitHub downloads the repository's tarball and extracts it into dir
+func (in *Installer) downloadGitHub(ctx context.Context, p *githubPackage, dir string) error {
+	location, err := url.Parse(p.tarballURL(in.githubAPI))
+	if err != nil {
+		return fmt.Errorf("unable to parse the tarball url for %s: %w", p, err)
+	}
+	// GitHub redirects to signed URLs on another host, which don't need the
+	// token
+	noAuth := func(*url.URL, string) string { return "" }
+	body, _, err := in.fetchTarball(ctx, p.String(), location, in.githubToken, 0, noAuth)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	buffered := bufio.NewReader(body)
+	if err := checkGzip(buffered); err != nil {
+		return fmt.Errorf("unable to extract %s: %w", p, err)
+	}
+	// Repository tarballs are nested in a user-repo-commit directory
+	if err := in.extractTarball(buffered, dir, 1, nil); err != nil {
+		return fmt.Errorf("unable to extract %s: %w", p, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package npm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestGitHubSubdir(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+	})
+	repo, err := createTarball(map[string]string{
+		"package.json":              `{"name":"mono","private":true}`,
+		"packages/foo/package.json": `{"name":"foo","version":"1.0.0","dependencies":{"uid":"^2.0.0"}}`,
+		"packages/foo/index.js":     `export const foo = "foo"`,
+		"packages/bar/package.json": `{"name":"bar","version":"1.0.0"}`,
+	})
+	is.NoErr(err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/user/mono/tarball/main" {
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(repo)
+			return
+		} else if strings.HasPrefix(r.URL.Path, "/repos/") {
+			http.NotFound(w, r)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithGitHubAPI(server.URL))
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "github:user/mono#main::path:packages/foo", "baz@github:user/mono#main::path:/packages/bar/"))
+	equals(t, filepath.Join(dir, "node_modules", "foo", "index.js"), `export const foo = "foo"`)
+	exists(t, filepath.Join(dir, "node_modules", "uid", "package.json"))
+	// Aliased packages are installed under the alias
+	equals(t, filepath.Join(dir, "node_modules", "baz", "package.json"), `{"name":"bar","version":"1.0.0"}`)
+	notExists(t, filepath.Join(dir, "node_modules", "mono"))
+	notExists(t, filepath.Join(dir, "node_modules", "foo", "packages"))
+	// Paths outside of the repository are refused
+	err = installer.Install(ctx, t.TempDir(), "github:user/mono#main::path:../etc")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "outside of the repository"))
+	// Missing refs fail
+	err = installer.Install(ctx, t.TempDir(), "github:user/mono#nope")
+	is.True(err != nil)
+}
+
+func TestGitHubAuth(t *testing.T) {
+	is := is.New(t)
+	repo, err := createTarball(map[string]string{
+		"package.json": `{"name":"foo","version":"1.0.0"}`,
+	})
+	is.NoErr(err)
+	var auths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/x-gzip")
+		w.Write(repo)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	// Registry credentials aren't sent to GitHub, even with always-auth
+	installer := npm.New(
+		npm.WithRegistry("https://registry.example.com"),
+		npm.WithAuthToken("npm-default"),
+		npm.WithRegistryAuthToken("https://registry.example.com", "npm-secret"),
+		npm.WithRegistryAuthToken(server.URL, "npm-secret"),
+		npm.WithAlwaysAuth(),
+		npm.WithGitHubAPI(server.URL),
+	)
+	is.NoErr(installer.Install(ctx, t.TempDir(), "github:user/foo"))
+	is.Equal(auths, []string{""})
+	// GitHub credentials are sent instead
+	auths = nil
+	installer = npm.New(
+		npm.WithRegistryAuthToken(server.URL, "npm-secret"),
+		npm.WithAlwaysAuth(),
+		npm.WithGitHubAPI(server.URL),
+		npm.WithGitHubToken("gh-token"),
+	)
+	is.NoErr(installer.Install(ctx, t.TempDir(), "github:user/foo"))
+	is.Equal(auths, []string{"Bearer gh-token"})
+}
+
+func TestGitHubSameDirectory(t *testing.T) {
+	is := is.New(t)
+	repo, err := createTarball(map[string]string{
+		"package.json": `{"name":"foo","version":"1.0.0"}`,
+		"index.js":     `export const foo = "foo"`,
+	})
+	is.NoErr(err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/user/foo/tarball" && r.URL.Path != "/repos/user/foo/tarball/main" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-gzip")
+		w.Write(repo)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithGitHubAPI(server.URL))
+	// The same package reached by different specs is installed once at a time
+	for i := 0; i < 10; i++ {
+		dir := t.TempDir()
+		is.NoErr(installer.Install(ctx, dir, "github:user/foo", "github:user/foo#main", "foo@github:user/foo"))
+		equals(t, filepath.Join(dir, "node_modules", "foo", "index.js"), `export const foo = "foo"`)
+	}
+}
@@ -0,0 +1,68 @@
+package npm
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// WithMaxCompressionRatio aborts extracting a tarball once it decompresses to
+// more than ratio times the compressed bytes read so far, which stops gzip
+// bombs from filling the disk or memory. Package tarballs rarely compress
+// better than 20x. The first megabyte is always allowed. Defaults to no limit.
+func WithMaxCompressionRatio(ratio int) Option {
+	return func(in *Installer) {
+		in.maxRatio = ratio
+	}
+}
+
+// ratioSlack is how many bytes can be decompressed regardless of the ratio,
+// since a small file of zeros compresses very well
+const ratioSlack = 1 << 20
+
+// gunzip decompresses a gzipped tarball, enforcing the compression ratio
+func (in *Installer) gunzip(r io.Reader) (io.ReadCloser, error) {
+	if in.maxRatio <= 0 {
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create gzip reader: %w", err)
+		}
+		return gzipReader, nil
+	}
+	compressed := &countingReader{r: r}
+	gzipReader, err := gzip.NewReader(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create gzip reader: %w", err)
+	}
+	return &ratioReader{gzipReader, compressed, 0, int64(in.maxRatio)}, nil
+}
+
+// countingReader counts the bytes read
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ratioReader fails once more than ratio times the compressed bytes have been
+// decompressed
+type ratioReader struct {
+	*gzip.Reader
+	compressed   *countingReader
+	decompressed int64
+	ratio        int64
+}
+
+func (r *ratioReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.decompressed += int64(n)
+	if r.decompressed > ratioSlack && r.decompressed > r.ratio*r.compressed.n {
+		return n, fmt.Errorf("refusing to decompress %d bytes from %d compressed bytes because it's over the %dx compression ratio limit", r.decompressed, r.compressed.n, r.ratio)
+	}
+	return n, err
+}
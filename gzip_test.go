@@ -0,0 +1,38 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestMaxCompressionRatio(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"bomb@1.0.0": {
+			"zeros.bin": strings.Repeat("\x00", 8<<20),
+		},
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithMaxCompressionRatio(100))
+	dir := t.TempDir()
+	err := installer.Install(ctx, dir, "bomb@1.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "compression ratio limit"))
+	notExists(t, filepath.Join(dir, "node_modules", "bomb"))
+	// Regular packages are fine
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	// There's no limit by default
+	is.NoErr(npm.New(npm.WithRegistry(server.URL)).Install(ctx, dir, "bomb@1.0.0"))
+	exists(t, filepath.Join(dir, "node_modules", "bomb", "zeros.bin"))
+}
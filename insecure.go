@@ -0,0 +1,73 @@
+package npm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sort"
+)
+
+// WithLogger logs what the installer does, like the version each range
+// resolved to at info level and warnings about insecure registries. Defaults
+// to not logging.
+func WithLogger(log *slog.Logger) Option {
+	return func(in *Installer) {
+		in.log = log
+	}
+}
+
+// discardHandler drops every log record
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// WithInsecureHTTP allows registries, mirrors and tarballs served over plain
+// http. They're otherwise refused, unless they're on the local machine (e.g.
+// http://localhost:4873), since anyone on the network can read the
+// credentials and change the metadata on the way. Plain http registries are
+// used as-is, never upgraded to https, and a warning is logged for each one.
+func WithInsecureHTTP() Option {
+	return func(in *Installer) {
+		in.insecureHTTP = true
+	}
+}
+
+// warnInsecure logs a warning for every plain http registry
+func (in *Installer) warnInsecure() {
+	registries := append([]string{in.registry}, in.mirrors...)
+	for _, registry := range in.scopes {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries[1:])
+	for _, registry := range registries {
+		u, err := url.Parse(registry)
+		if err != nil || u.Scheme != "http" || isLoopback(u) {
+			continue
+		}
+		in.log.Warn("npm: installing from an insecure http registry, anyone on the network can read and change what's installed", "registry", u.Redacted())
+	}
+}
+
+// checkTransport refuses plain http URLs that aren't on the local machine,
+// unless insecure http is allowed
+func (in *Installer) checkTransport(u *url.URL) error {
+	if u.Scheme != "http" || in.insecureHTTP || isLoopback(u) {
+		return nil
+	}
+	return fmt.Errorf("npm: refusing to request %s over insecure http. Use npm.WithInsecureHTTP() to allow it", u.Redacted())
+}
+
+// isLoopback returns true if the URL is on the local machine
+func isLoopback(u *url.URL) bool {
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
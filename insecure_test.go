@@ -0,0 +1,62 @@
+package npm_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestInsecureHTTP(t *testing.T) {
+	is := is.New(t)
+	var requests atomic.Int64
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	// Route the plain http registry to the test server
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return new(net.Dialer).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		},
+	}
+	ctx := context.Background()
+	// Plain http registries are refused by default
+	installer := npm.New(npm.WithClient(client), npm.WithRegistry("http://registry.internal"))
+	err := installer.Install(ctx, t.TempDir(), "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "npm.WithInsecureHTTP()"))
+	is.Equal(requests.Load(), int64(0))
+	// They're allowed with a warning
+	logs := new(bytes.Buffer)
+	log := slog.New(slog.NewTextHandler(logs, nil))
+	installer = npm.New(
+		npm.WithClient(client),
+		npm.WithRegistry("http://registry.internal"),
+		npm.WithLogger(log),
+		npm.WithInsecureHTTP(),
+	)
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	is.Equal(requests.Load(), int64(2))
+	is.True(strings.Contains(logs.String(), "level=WARN"))
+	is.True(strings.Contains(logs.String(), "registry=http://registry.internal"))
+}
@@ -0,0 +1,28 @@
+package npm
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+// InstallDependencies installs the dependencies in manifestDir/package.json
+// into dir/node_modules, without installing the package in manifestDir itself.
+// This is useful for a package that's already unpacked and managed separately.
+func InstallDependencies(ctx context.Context, dir, manifestDir string) error {
+	return defaultInstaller.InstallDependencies(ctx, dir, manifestDir)
+}
+
+// InstallDependencies installs the dependencies in manifestDir/package.json
+// into dir/node_modules.
+func (in *Installer) InstallDependencies(ctx context.Context, dir, manifestDir string) error {
+	deps, err := in.readRootDependencies(dir, filepath.Join(manifestDir, "package.json"))
+	if err != nil {
+		return fmt.Errorf("npm: unable to install the dependencies of %s: %w", manifestDir, err)
+	}
+	// Install would fall back to dir/package.json without packages
+	if len(deps) == 0 {
+		return nil
+	}
+	return in.Install(ctx, dir, dependencySpecs(deps)...)
+}
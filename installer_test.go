@@ -0,0 +1,103 @@
+package npm_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestInstallerReuse(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	}))
+	defer server.Close()
+	transport := new(countingTransport)
+	installer := npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithClient(&http.Client{Transport: transport}),
+	)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		dir := t.TempDir()
+		is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+		equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	}
+	// Every request went through the client
+	is.Equal(transport.requests.Load(), int32(6))
+}
+
+func TestConcurrency(t *testing.T) {
+	is := is.New(t)
+	packages := map[string]map[string]string{}
+	specs := []string{}
+	for i := 0; i < 10; i++ {
+		packages[fmt.Sprintf("pkg%d@1.0.0", i)] = map[string]string{}
+		specs = append(specs, fmt.Sprintf("pkg%d@1.0.0", i))
+	}
+	registry := registryHandler(t, packages)
+	var inflight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			current := peak.Load()
+			if n <= current || peak.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithConcurrency(2))
+	is.NoErr(installer.Install(context.Background(), t.TempDir(), specs...))
+	is.True(peak.Load() <= 2)
+}
+
+func TestConcurrencyPerHost(t *testing.T) {
+	is := is.New(t)
+	packages := map[string]map[string]string{}
+	specs := []string{}
+	for i := 0; i < 10; i++ {
+		packages[fmt.Sprintf("pkg%d@1.0.0", i)] = map[string]string{}
+		specs = append(specs, fmt.Sprintf("pkg%d@1.0.0", i))
+	}
+	registry := registryHandler(t, packages)
+	var inflight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			current := peak.Load()
+			if n <= current || peak.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithConcurrency(4), npm.WithConcurrencyPerHost(1))
+	is.NoErr(installer.Install(context.Background(), t.TempDir(), specs...))
+	is.Equal(peak.Load(), int32(1))
+}
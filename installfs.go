@@ -0,0 +1,167 @@
+package npm
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// InstallFS resolves the packages and their dependencies like Resolve, then
+// builds node_modules in memory instead of writing it to disk, which suits
+// serverless and edge builds. The filesystem's root contains node_modules.
+// Each package is hoisted at the version that was requested or the newest one,
+// with other versions nested under the packages that depend on them. Only
+// registry packages are supported, and only regular files and directories are
+// kept. Nothing is written unless WithCache is used.
+func InstallFS(ctx context.Context, packages ...string) (fs.FS, error) {
+	return defaultInstaller.InstallFS(ctx, packages...)
+}
+
+// InstallFS resolves the packages and their dependencies, then builds
+// node_modules in memory.
+func (in *Installer) InstallFS(ctx context.Context, packages ...string) (fs.FS, error) {
+	tree, err := in.resolveTree(ctx, "", nil, packages...)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to install in memory: %w", err)
+	}
+	for _, node := range tree.Nodes {
+		if node.Tarball == "" {
+			return nil, fmt.Errorf("npm: unable to install %s in memory because only registry packages are supported", node.Name)
+		}
+	}
+	// Lay out the tree, then extract each package into its directories
+	hoisted := desiredNodes(tree)
+	dirs := map[string][]string{}
+	var place func(key, dir string, chain map[string]bool)
+	place = func(key, dir string, chain map[string]bool) {
+		node := tree.Nodes[key]
+		dirs[key] = append(dirs[key], dir)
+		chain[key] = true
+		defer delete(chain, key)
+		for name, depKey := range node.Dependencies {
+			if hoisted[name] == depKey || chain[depKey] {
+				continue
+			}
+			place(depKey, path.Join(dir, "node_modules", name), chain)
+		}
+	}
+	for name, key := range hoisted {
+		place(key, path.Join("node_modules", name), map[string]bool{})
+	}
+	fsys := memFS{}
+	var mu sync.Mutex
+	eg, ctx := errgroup.WithContext(ctx)
+	for key, pkgDirs := range dirs {
+		pkg := tree.packages[key]
+		eg.Go(func() error {
+			files, err := in.downloadFiles(ctx, pkg)
+			if err != nil {
+				return fmt.Errorf("npm: unable to install %s in memory: %w", key, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, dir := range pkgDirs {
+				for name, file := range files {
+					fsys[path.Join(dir, name)] = file
+				}
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// downloadFiles downloads the package's tarball and reads its files into
+// memory, keyed by their path within the package
+func (in *Installer) downloadFiles(ctx context.Context, p *remotePackage) (map[string]*memFile, error) {
+	verifier, err := in.newVerifier(p)
+	if err != nil {
+		return nil, err
+	}
+	body, err := in.openTarball(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	buffered := bufio.NewReader(body)
+	if err := checkGzip(buffered); err != nil {
+		return nil, err
+	}
+	var reader io.Reader = buffered
+	if verifier != nil {
+		reader = io.TeeReader(buffered, verifier)
+	}
+	files, err := in.readTarball(reader)
+	if err != nil {
+		return nil, err
+	}
+	if verifier == nil {
+		return files, nil
+	}
+	// Hash anything left after the end of the archive
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", p.Name, err)
+	}
+	if err := verifier.Verify(); err != nil {
+		return nil, fmt.Errorf("unable to verify %s@%s: %w", p.Name, p.Version, err)
+	}
+	return files, nil
+}
+
+// readTarball reads the regular files and directories in a gzipped tarball,
+// stripping and filtering them like extractTarball
+func (in *Installer) readTarball(r io.Reader) (map[string]*memFile, error) {
+	gzipReader, err := in.gunzip(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	files := map[string]*memFile{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to get next header: %w", err)
+		}
+		name := path.Clean(header.Name)
+		if path.IsAbs(header.Name) || strings.HasPrefix(header.Name, `\`) || !fs.ValidPath(name) {
+			return nil, fmt.Errorf("refusing to read %q from tarball because it's outside of the package", header.Name)
+		}
+		isDir := header.Typeflag == tar.TypeDir
+		if header.Typeflag != tar.TypeReg && !isDir {
+			continue
+		}
+		rel, ok := stripComponents(name, in.strip)
+		if !ok || rel == "" {
+			continue
+		} else if in.filter != nil && isDir {
+			// Directories are made as needed for the files that pass the filter
+			continue
+		} else if !keepFile(rel, in.filter) {
+			continue
+		}
+		file := &memFile{
+			mode:    header.FileInfo().Mode(),
+			modTime: header.ModTime,
+		}
+		if !isDir {
+			if file.data, err = io.ReadAll(tarReader); err != nil {
+				return nil, fmt.Errorf("unable to read %q from tarball: %w", header.Name, err)
+			}
+		}
+		files[rel] = file
+	}
+}
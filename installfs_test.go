@@ -0,0 +1,55 @@
+package npm_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestInstallFS(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{"name":"a","version":"1.0.0","dependencies":{"uid":"^1.0.0"}}`,
+			"lib/index.js": `export const a = "a"`,
+		},
+		"uid@1.0.0": {},
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithTempDir(dir))
+	fsys, err := installer.InstallFS(ctx, "a@^1.0.0", "uid@^2.0.0")
+	is.NoErr(err)
+	code, err := fs.ReadFile(fsys, "node_modules/a/lib/index.js")
+	is.NoErr(err)
+	is.Equal(string(code), `export const a = "a"`)
+	code, err = fs.ReadFile(fsys, "node_modules/uid/index.js")
+	is.NoErr(err)
+	is.Equal(string(code), `export const uid = "uid"`)
+	// Other versions are nested under their dependents
+	code, err = fs.ReadFile(fsys, "node_modules/a/node_modules/uid/package.json")
+	is.NoErr(err)
+	is.Equal(string(code), `{"name":"uid","version":"1.0.0"}`)
+	entries, err := fs.ReadDir(fsys, "node_modules")
+	is.NoErr(err)
+	is.Equal(len(entries), 2)
+	// The filesystem behaves like any other fs.FS
+	is.NoErr(fstest.TestFS(fsys, "node_modules/a/lib/index.js", "node_modules/uid/index.js", "node_modules/a/node_modules/uid/package.json"))
+	_, err = fsys.Open("node_modules/missing")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	// Nothing was written to disk
+	written, err := os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(written), 0)
+}
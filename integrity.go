@@ -0,0 +1,191 @@
+package npm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+)
+
+// Supported integrity algorithms from strongest to weakest
+var integrityAlgorithms = []string{"sha512", "sha384", "sha256", "sha1"}
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "sha512":
+		return sha512.New()
+	case "sha384":
+		return sha512.New384()
+	case "sha256":
+		return sha256.New()
+	case "sha1":
+		return sha1.New()
+	default:
+		return nil
+	}
+}
+
+// verifier hashes a tarball as it's read to check it against the subresource
+// integrity string from the registry.
+type verifier struct {
+	hash.Hash
+	algorithm string
+	expect    []byte
+}
+
+// newVerifier picks the strongest supported hash out of an integrity string,
+// which may contain several space-separated hashes. The preferred algorithm
+// is picked instead when it's there.
+func newVerifier(integrity, prefer string) (*verifier, error) {
+	digests := map[string]string{}
+	for _, field := range strings.Fields(integrity) {
+		algorithm, digest, ok := strings.Cut(field, "-")
+		if !ok {
+			continue
+		}
+		// Strip any options (e.g. sha512-abc?foo)
+		digest, _, _ = strings.Cut(digest, "?")
+		digests[algorithm] = digest
+	}
+	for _, algorithm := range append([]string{prefer}, integrityAlgorithms...) {
+		digest, ok := digests[algorithm]
+		if !ok {
+			continue
+		}
+		expect, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode %s integrity %q: %w", algorithm, digest, err)
+		}
+		hash := newHash(algorithm)
+		if hash == nil {
+			continue
+		}
+		return &verifier{hash, algorithm, expect}, nil
+	}
+	return nil, fmt.Errorf("unsupported integrity %q", integrity)
+}
+
+// errIntegrityMismatch is returned when a tarball doesn't match its integrity
+var errIntegrityMismatch = errors.New("integrity mismatch")
+
+// Verify the bytes written so far match the expected digest
+func (v *verifier) Verify() error {
+	actual := v.Sum(nil)
+	if !bytes.Equal(actual, v.expect) {
+		return fmt.Errorf("%w: expected %s-%s but got %s-%s", errIntegrityMismatch, v.algorithm, base64.StdEncoding.EncodeToString(v.expect), v.algorithm, base64.StdEncoding.EncodeToString(actual))
+	}
+	return nil
+}
+
+// IntegrityPolicy controls which integrity hashes are used to verify tarballs.
+// Registries provide sha512 for newer packages, while older packages may only
+// have a sha1 shasum.
+type IntegrityPolicy struct {
+	// Prefer is the algorithm to verify with when a package has several (e.g.
+	// sha512). Defaults to the strongest one.
+	Prefer string
+	// Minimum is the weakest algorithm that's trusted (e.g. sha256). Packages
+	// without integrity count as weaker than sha1.
+	Minimum string
+	// Reject fails the install when a package only has weaker hashes than the
+	// minimum, otherwise they're accepted after calling OnWeak
+	Reject bool
+	// OnWeak is called for every package that only has weaker hashes than the
+	// minimum. The algorithm is empty when the package has no integrity. It
+	// may be called concurrently.
+	OnWeak func(name, version, algorithm string)
+}
+
+// WithIntegrityPolicy sets how tarballs are verified
+func WithIntegrityPolicy(policy *IntegrityPolicy) Option {
+	return func(in *Installer) {
+		in.integrityPolicy = policy
+	}
+}
+
+// newVerifier returns a verifier for the package's tarball, or nil when it has
+// no integrity. Weak hashes are checked against the policy first.
+func (in *Installer) newVerifier(p *remotePackage) (*verifier, error) {
+	policy := in.integrityPolicy
+	if policy == nil {
+		policy = new(IntegrityPolicy)
+	}
+	var v *verifier
+	if p.Integrity != "" {
+		var err error
+		v, err = newVerifier(p.Integrity, policy.Prefer)
+		if err != nil {
+			return nil, fmt.Errorf("unable to verify %s: %w", p.Name, err)
+		}
+	}
+	if policy.Minimum == "" {
+		return v, nil
+	}
+	minimum := integrityStrength(policy.Minimum)
+	if minimum < 0 {
+		return nil, fmt.Errorf("npm: unsupported minimum integrity algorithm %q", policy.Minimum)
+	}
+	algorithm := ""
+	if v != nil {
+		algorithm = v.algorithm
+	}
+	if algorithm != "" && integrityStrength(algorithm) >= minimum {
+		return v, nil
+	}
+	if policy.Reject {
+		if algorithm == "" {
+			return nil, fmt.Errorf("npm: refusing to install %s@%s without integrity, at least %s is required", p.Name, p.Version, policy.Minimum)
+		}
+		return nil, fmt.Errorf("npm: refusing to install %s@%s with only %s integrity, at least %s is required", p.Name, p.Version, algorithm, policy.Minimum)
+	}
+	if policy.OnWeak != nil {
+		policy.OnWeak(p.Name, p.Version, algorithm)
+	}
+	return v, nil
+}
+
+// integrityStrength ranks the algorithm, with higher being stronger, or -1 if
+// it's not supported
+func integrityStrength(algorithm string) int {
+	for i, supported := range integrityAlgorithms {
+		if supported == algorithm {
+			return len(integrityAlgorithms) - i
+		}
+	}
+	return -1
+}
+
+// WithIntegrityRetries sets how many times a tarball that doesn't match its
+// integrity is downloaded again before failing, since a mismatch is usually a
+// corrupted transfer on a flaky network. Tarballs are still never installed
+// unless they match. Defaults to 1.
+func WithIntegrityRetries(retries int) Option {
+	return func(in *Installer) {
+		in.verifyRetries = retries
+	}
+}
+
+// downloadVerified downloads the package into dir like download, downloading
+// it again when it doesn't match its integrity
+func (in *Installer) downloadVerified(ctx context.Context, p *remotePackage, dir string, filter func(path string) bool) error {
+	for attempt := 1; ; attempt++ {
+		err := in.download(ctx, p, dir, filter)
+		if err == nil || !errors.Is(err, errIntegrityMismatch) || attempt > in.verifyRetries || ctx.Err() != nil {
+			return err
+		}
+		in.log.Warn("npm: downloading again after an integrity mismatch", "package", p.name(), "version", p.Version, "attempt", attempt, "error", err)
+		// Start over from an empty directory
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("unable to clear %s: %w", dir, err)
+		} else if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("unable to make directory %s: %w", dir, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package npm_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+// sha1Registry serves uid@2.0.0 with only a sha1 shasum like older packages
+func sha1Registry(t testing.TB) *httptest.Server {
+	t.Helper()
+	tarball, err := createTarball(map[string]string{
+		"package.json": `{"name":"uid","version":"2.0.0"}`,
+		"index.js":     `export const uid = "uid"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(tarball)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			w.Write(tarball)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":      "uid",
+			"dist-tags": map[string]string{"latest": "2.0.0"},
+			"versions": map[string]interface{}{
+				"2.0.0": map[string]interface{}{
+					"name":    "uid",
+					"version": "2.0.0",
+					"dist": map[string]string{
+						"tarball": fmt.Sprintf("http://%s/uid/-/uid-2.0.0.tgz", r.Host),
+						"shasum":  hex.EncodeToString(sum[:]),
+					},
+				},
+			},
+		})
+	}))
+}
+
+func TestIntegrityPolicyReject(t *testing.T) {
+	is := is.New(t)
+	server := sha1Registry(t)
+	defer server.Close()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithIntegrityPolicy(&npm.IntegrityPolicy{
+		Minimum: "sha512",
+		Reject:  true,
+	}))
+	err := installer.Install(context.Background(), dir, "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "only sha1 integrity"))
+	notExists(t, filepath.Join(dir, "node_modules", "uid"))
+}
+
+func TestIntegrityPolicyWarn(t *testing.T) {
+	is := is.New(t)
+	server := sha1Registry(t)
+	defer server.Close()
+	dir := t.TempDir()
+	var weak []string
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithIntegrityPolicy(&npm.IntegrityPolicy{
+		Minimum: "sha512",
+		OnWeak: func(name, version, algorithm string) {
+			weak = append(weak, name+"@"+version+" "+algorithm)
+		},
+	}))
+	is.NoErr(installer.Install(context.Background(), dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	is.Equal(weak, []string{"uid@2.0.0 sha1"})
+}
@@ -0,0 +1,54 @@
+package npm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// InvalidVersions is what happens to versions in the registry that aren't
+// valid semantic versions. They're skipped by default.
+type InvalidVersions int
+
+const (
+	// WarnInvalidVersions logs a warning listing the invalid versions of a
+	// package, then skips them.
+	WarnInvalidVersions InvalidVersions = iota + 1
+	// RejectInvalidVersions fails to resolve packages with invalid versions,
+	// listing them in the error.
+	RejectInvalidVersions
+)
+
+// WithInvalidVersions surfaces versions in the registry that aren't valid
+// semantic versions, which are otherwise silently skipped. This gives
+// visibility into data quality issues in private registries. Versions are
+// checked as published, before WithVersionCoercion.
+func WithInvalidVersions(mode InvalidVersions) Option {
+	return func(in *Installer) {
+		in.invalidVersions = mode
+	}
+}
+
+// checkVersions warns about or rejects the invalid versions in the metadata
+func (in *Installer) checkVersions(meta *metadata) error {
+	if in.invalidVersions == 0 {
+		return nil
+	}
+	var invalid []string
+	for version := range meta.Versions {
+		if _, err := semver.NewVersion(version); err != nil {
+			invalid = append(invalid, version)
+		}
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	sort.Strings(invalid)
+	if in.invalidVersions == RejectInvalidVersions {
+		return fmt.Errorf("%s has versions that aren't valid semantic versions: %s", meta.Name, strings.Join(invalid, ", "))
+	}
+	in.log.Warn(fmt.Sprintf("npm: skipping versions of %s that aren't valid semantic versions", meta.Name), "package", meta.Name, "versions", invalid)
+	return nil
+}
@@ -0,0 +1,28 @@
+package npm
+
+// WithScopedLayout sets where scoped packages are installed within
+// node_modules. Layout is passed the scope (e.g. @lukeed) and the name (e.g.
+// uuid) and returns a slash-separated path relative to node_modules. Defaults
+// to the standard nested layout, @lukeed/uuid. Node only resolves the nested
+// layout, so this is for older tooling that reads node_modules itself.
+func WithScopedLayout(layout func(scope, name string) string) Option {
+	return func(in *Installer) {
+		in.scopedLayout = layout
+	}
+}
+
+// FlatScopes is a scoped layout that installs scoped packages into
+// node_modules/@scope%2fname, like the escaped name in registry URLs
+func FlatScopes(scope, name string) string {
+	return scope + "%2f" + name
+}
+
+// moduleDir returns the slash-separated directory within node_modules that
+// the package name is installed into
+func (in *Installer) moduleDir(name string) string {
+	scope, base := parseScope(name)
+	if scope == "" || in.scopedLayout == nil {
+		return name
+	}
+	return in.scopedLayout(scope, base)
+}
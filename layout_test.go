@@ -0,0 +1,37 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestScopedLayout(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"@lukeed/csprng":"^1.0.0"}}`,
+		},
+		"@lukeed/csprng@1.0.1": {},
+		"uid@2.0.0":            {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithScopedLayout(npm.FlatScopes))
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "@lukeed/uuid@^2.0.0", "uid@^2.0.0"))
+	exists(t, filepath.Join(dir, "node_modules", "@lukeed%2fuuid", "package.json"))
+	exists(t, filepath.Join(dir, "node_modules", "@lukeed%2fcsprng", "package.json"))
+	exists(t, filepath.Join(dir, "node_modules", "uid", "package.json"))
+	notExists(t, filepath.Join(dir, "node_modules", "@lukeed"))
+	lock, err := os.ReadFile(filepath.Join(dir, "node_modules", ".package-lock.json"))
+	is.NoErr(err)
+	is.True(strings.Contains(string(lock), `"node_modules/@lukeed%2fuuid": {
+      "name": "@lukeed/uuid",`))
+}
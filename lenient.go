@@ -0,0 +1,82 @@
+package npm
+
+import (
+	"encoding/json"
+)
+
+// WithLenientJSON parses package.json files leniently, ignoring comments and
+// trailing commas that some tools leave behind. Add and Uninstall drop them
+// when they rewrite the package.json.
+func WithLenientJSON() Option {
+	return func(in *Installer) {
+		in.lenientJSON = true
+	}
+}
+
+// unmarshalManifest unmarshals a package.json, leniently if enabled
+func (in *Installer) unmarshalManifest(data []byte, v interface{}) error {
+	if in.lenientJSON {
+		data = stripJSON(data)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// stripJSON removes // and /* */ comments and trailing commas from JSON
+func stripJSON(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '"':
+			// Copy strings as-is
+			start := i
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+			end := min(i+1, len(data))
+			out = append(out, data[start:end]...)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			i += 2
+			for i+1 < len(data) && !(data[i] == '*' && data[i+1] == '/') {
+				i++
+			}
+			i++
+		case c == ',' && trailingComma(data[i+1:]):
+			// Drop commas before a closing } or ]
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// trailingComma returns true if the rest only has whitespace or comments
+// before closing an object or array
+func trailingComma(rest []byte) bool {
+	for i := 0; i < len(rest); i++ {
+		switch c := rest[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		case c == '/' && i+1 < len(rest) && rest[i+1] == '/':
+			for i < len(rest) && rest[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(rest) && rest[i+1] == '*':
+			i += 2
+			for i+1 < len(rest) && !(rest[i] == '*' && rest[i+1] == '/') {
+				i++
+			}
+			i++
+		default:
+			return c == '}' || c == ']'
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestLenientJSON(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{
+			// Generated by a tool
+			"name": "app",
+			/* The dependencies */
+			"dependencies": {
+				"uid": "2.0.0", // pinned
+				"local": "./local",
+			},
+		}`,
+		"local/package.json": `{
+			"name": "local",
+			"homepage": "https://example.com/*not-a-comment*/,]",
+			"main": "index.js", /* trailing comma */
+		}`,
+		"local/index.js": `export const local = "local"`,
+	}))
+	ctx := context.Background()
+	// Strict by default
+	err := npm.New(npm.WithRegistry(server.URL)).Install(ctx, dir)
+	is.True(err != nil)
+	is.NoErr(npm.New(npm.WithRegistry(server.URL), npm.WithLenientJSON()).Install(ctx, dir))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	equals(t, filepath.Join(dir, "node_modules", "local", "index.js"), `export const local = "local"`)
+	// Add and Uninstall rewrite the package.json without the comments
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithLenientJSON())
+	is.NoErr(installer.Uninstall(ctx, dir, "uid"))
+	manifest, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	is.NoErr(err)
+	is.True(!strings.Contains(string(manifest), "uid"))
+	is.NoErr(installer.Add(ctx, dir, "uid@2.0.0"))
+	manifest, err = os.ReadFile(filepath.Join(dir, "package.json"))
+	is.NoErr(err)
+	is.True(json.Valid(manifest))
+	is.True(strings.Contains(string(manifest), `"uid": "^2.0.0"`))
+	is.True(strings.Contains(string(manifest), `"local": "./local"`))
+}
@@ -0,0 +1,206 @@
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LicensePolicy checks the license of every installed package
+type LicensePolicy struct {
+	// Allow is the list of allowed SPDX license identifiers (e.g. MIT)
+	Allow []string
+	// Strict fails the install when any package's license isn't allowed
+	Strict bool
+	// OnViolation is called after installing for every package whose license
+	// isn't allowed
+	OnViolation func(violation *LicenseViolation)
+}
+
+// LicenseViolation is an installed package whose license isn't allowed
+type LicenseViolation struct {
+	Name    string
+	Version string
+	// License is the package's license expression. It's empty when the package
+	// doesn't have one.
+	License string
+}
+
+func (v *LicenseViolation) String() string {
+	license := v.License
+	if license == "" {
+		license = "no license"
+	}
+	return fmt.Sprintf("%s@%s (%s)", v.Name, v.Version, license)
+}
+
+// WithLicensePolicy checks the license of every installed package against the
+// policy. SPDX expressions like "(MIT OR GPL-3.0)" are allowed when either
+// license is allowed, while "MIT AND GPL-3.0" needs both.
+func WithLicensePolicy(policy *LicensePolicy) Option {
+	return func(in *Installer) {
+		in.licensePolicy = policy
+	}
+}
+
+// checkLicense records a violation if the package's license isn't allowed
+func (s *session) checkLicense(name, version string, manifest []byte) {
+	policy := s.in.licensePolicy
+	if policy == nil {
+		return
+	}
+	if s.in.lenientJSON {
+		manifest = stripJSON(manifest)
+	}
+	license := readLicense(manifest)
+	if allowedLicense(license, policy.Allow) {
+		return
+	}
+	s.mu.Lock()
+	s.licenseViolations = append(s.licenseViolations, &LicenseViolation{
+		Name:    name,
+		Version: version,
+		License: license,
+	})
+	s.mu.Unlock()
+}
+
+// reportLicenses reports the violations to the policy
+func (s *session) reportLicenses() error {
+	policy := s.in.licensePolicy
+	if policy == nil || len(s.licenseViolations) == 0 {
+		return nil
+	}
+	violations := s.licenseViolations
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Name < violations[j].Name
+	})
+	if policy.OnViolation != nil {
+		for _, violation := range violations {
+			policy.OnViolation(violation)
+		}
+	}
+	if !policy.Strict {
+		return nil
+	}
+	list := make([]string, len(violations))
+	for i, violation := range violations {
+		list[i] = violation.String()
+	}
+	return fmt.Errorf("npm: packages with disallowed licenses: %s", strings.Join(list, ", "))
+}
+
+// readLicense reads the license expression from a package.json. Older
+// packages use a {"type": "MIT"} object or a "licenses" list, which are
+// turned into an expression.
+func readLicense(manifest []byte) string {
+	var pkg struct {
+		License  json.RawMessage `json:"license,omitempty"`
+		Licenses []struct {
+			Type string `json:"type,omitempty"`
+		} `json:"licenses,omitempty"`
+	}
+	if err := json.Unmarshal(manifest, &pkg); err != nil {
+		return ""
+	}
+	var license string
+	if err := json.Unmarshal(pkg.License, &license); err == nil && license != "" {
+		return license
+	}
+	var object struct {
+		Type string `json:"type,omitempty"`
+	}
+	if err := json.Unmarshal(pkg.License, &object); err == nil && object.Type != "" {
+		return object.Type
+	}
+	var types []string
+	for _, license := range pkg.Licenses {
+		if license.Type != "" {
+			types = append(types, license.Type)
+		}
+	}
+	if len(types) > 1 {
+		return "(" + strings.Join(types, " OR ") + ")"
+	}
+	return strings.Join(types, "")
+}
+
+// allowedLicense evaluates a simple SPDX expression against the allowlist
+func allowedLicense(expression string, allow []string) bool {
+	expression = unwrapLicense(expression)
+	if expression == "" {
+		return false
+	}
+	if operands := splitLicense(expression, " OR "); len(operands) > 1 {
+		for _, operand := range operands {
+			if allowedLicense(operand, allow) {
+				return true
+			}
+		}
+		return false
+	}
+	if operands := splitLicense(expression, " AND "); len(operands) > 1 {
+		for _, operand := range operands {
+			if !allowedLicense(operand, allow) {
+				return false
+			}
+		}
+		return true
+	}
+	// Ignore exceptions (e.g. GPL-2.0 WITH Classpath-exception-2.0)
+	license, _, _ := strings.Cut(expression, " WITH ")
+	for _, allowed := range allow {
+		if strings.EqualFold(strings.TrimSuffix(license, "+"), allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// unwrapLicense removes the parentheses that wrap the whole expression, but
+// not the ones in expressions like (MIT) OR (ISC)
+func unwrapLicense(expression string) string {
+	expression = strings.TrimSpace(expression)
+	for strings.HasPrefix(expression, "(") && closingParen(expression) == len(expression)-1 {
+		expression = strings.TrimSpace(expression[1 : len(expression)-1])
+	}
+	return expression
+}
+
+// closingParen returns the index of the parenthesis that closes the one the
+// expression starts with, or -1
+func closingParen(expression string) int {
+	depth := 0
+	for i, char := range expression {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitLicense splits the expression by the operator, ignoring operators
+// within parentheses
+func splitLicense(expression, operator string) (operands []string) {
+	depth, start := 0, 0
+	for i := 0; i < len(expression); i++ {
+		switch {
+		case expression[i] == '(':
+			depth++
+		case expression[i] == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(expression[i:], operator):
+			operands = append(operands, expression[start:i])
+			i += len(operator) - 1
+			start = i + 1
+		}
+	}
+	return append(operands, expression[start:])
+}
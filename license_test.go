@@ -0,0 +1,66 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func licenseRegistry(t testing.TB) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"app@1.0.0": {
+			"package.json": `{"name":"app","version":"1.0.0","license":"MIT","dependencies":{"dual":"*","gpl":"*","legacy":"*","mixed":"*","unlicensed":"*"}}`,
+		},
+		"dual@1.0.0": {
+			"package.json": `{"name":"dual","version":"1.0.0","license":"(MIT OR GPL-3.0)"}`,
+		},
+		"gpl@1.0.0": {
+			"package.json": `{"name":"gpl","version":"1.0.0","license":"GPL-3.0-only"}`,
+		},
+		"legacy@1.0.0": {
+			"package.json": `{"name":"legacy","version":"1.0.0","licenses":[{"type":"BSD-3-Clause"},{"type":"GPL-2.0"}]}`,
+		},
+		"mixed@1.0.0": {
+			"package.json": `{"name":"mixed","version":"1.0.0","license":"(Apache-2.0) AND (GPL-2.0 OR MIT)"}`,
+		},
+		"unlicensed@1.0.0": {
+			"package.json": `{"name":"unlicensed","version":"1.0.0"}`,
+		},
+	}))
+}
+
+func TestLicensePolicy(t *testing.T) {
+	is := is.New(t)
+	server := licenseRegistry(t)
+	defer server.Close()
+	var violations []string
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithLicensePolicy(&npm.LicensePolicy{
+		Allow: []string{"MIT", "Apache-2.0", "BSD-3-Clause"},
+		OnViolation: func(violation *npm.LicenseViolation) {
+			violations = append(violations, violation.String())
+		},
+	}))
+	is.NoErr(installer.Install(context.Background(), t.TempDir(), "app@1.0.0"))
+	is.Equal(violations, []string{
+		"gpl@1.0.0 (GPL-3.0-only)",
+		"unlicensed@1.0.0 (no license)",
+	})
+}
+
+func TestLicensePolicyStrict(t *testing.T) {
+	is := is.New(t)
+	server := licenseRegistry(t)
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithLicensePolicy(&npm.LicensePolicy{
+		Allow:  []string{"MIT"},
+		Strict: true,
+	}))
+	err := installer.Install(context.Background(), t.TempDir(), "app@1.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "packages with disallowed licenses: gpl@1.0.0 (GPL-3.0-only), legacy@1.0.0 ((BSD-3-Clause OR GPL-2.0)), mixed@1.0.0 ((Apache-2.0) AND (GPL-2.0 OR MIT)), unlicensed@1.0.0 (no license)"))
+}
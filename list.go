@@ -0,0 +1,207 @@
+package npm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// List the packages installed in dir/node_modules, sorted by name. Packages
+// nested in other packages' node_modules aren't listed, and neither are
+// directories without a package.json.
+func List(dir string) ([]*InstalledPackage, error) {
+	return defaultInstaller.List(dir)
+}
+
+// List the packages installed in dir/node_modules, sorted by name.
+func (in *Installer) List(dir string) ([]*InstalledPackage, error) {
+	nodeModules := filepath.Join(dir, "node_modules")
+	var packages []*InstalledPackage
+	entries, err := os.ReadDir(nodeModules)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("npm: unable to list %s: %w", nodeModules, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if hiddenPath(name) {
+			continue
+		}
+		// Scoped packages may be flattened with WithScopedLayout
+		if !strings.HasPrefix(name, "@") || fileExists(nodeModules, name+"/package.json") {
+			pkg, err := in.listPackage(nodeModules, name)
+			if err != nil {
+				return nil, err
+			} else if pkg != nil {
+				packages = append(packages, pkg)
+			}
+			continue
+		}
+		scoped, err := os.ReadDir(filepath.Join(nodeModules, name))
+		if err != nil {
+			return nil, fmt.Errorf("npm: unable to list %s: %w", filepath.Join(nodeModules, name), err)
+		}
+		for _, entry := range scoped {
+			pkg, err := in.listPackage(nodeModules, name+"/"+entry.Name())
+			if err != nil {
+				return nil, err
+			} else if pkg != nil {
+				packages = append(packages, pkg)
+			}
+		}
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Name < packages[j].Name
+	})
+	return packages, nil
+}
+
+// listPackage reads an installed package, or returns nil if it's not a package
+func (in *Installer) listPackage(nodeModules, name string) (*InstalledPackage, error) {
+	pkgDir := filepath.Join(nodeModules, filepath.FromSlash(name))
+	manifestPath := filepath.Join(pkgDir, "package.json")
+	if _, err := os.Stat(manifestPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("npm: unable to stat %s: %w", manifestPath, err)
+	}
+	manifest, err := readManifest(manifestPath, in.lenientJSON)
+	if err != nil {
+		return nil, err
+	}
+	// Packages laid out under their own name are listed by it, while aliased
+	// packages are listed by their alias
+	if manifest.Name != "" && in.moduleDir(manifest.Name) == name {
+		name = manifest.Name
+	}
+	return &InstalledPackage{
+		Name:    name,
+		Version: manifest.Version,
+		Dir:     pkgDir,
+	}, nil
+}
+
+// DiffResult is what needs to change in node_modules to match the specs
+type DiffResult struct {
+	// Add are the packages that aren't installed yet
+	Add []*PackageDiff
+	// Remove are the installed packages that aren't needed
+	Remove []*PackageDiff
+	// Change are the installed packages that need another version
+	Change []*PackageDiff
+}
+
+// Empty returns true if node_modules already matches
+func (d *DiffResult) Empty() bool {
+	return len(d.Add) == 0 && len(d.Remove) == 0 && len(d.Change) == 0
+}
+
+// PackageDiff is a package whose installed version differs from the desired
+// one
+type PackageDiff struct {
+	Name string
+	// From is the installed version. It's empty for packages to add.
+	From string
+	// To is the desired version. It's empty for packages to remove.
+	To string
+}
+
+// Diff compares the packages installed in dir/node_modules against the tree
+// the specs resolve to, like ResolveTree resolves them. When no specs are
+// passed in, the dependencies in dir/package.json are used. When the tree has
+// several versions of a package, the requested one is desired, otherwise the
+// newest.
+func Diff(ctx context.Context, dir string, specs ...string) (*DiffResult, error) {
+	return defaultInstaller.Diff(ctx, dir, specs...)
+}
+
+// Diff compares the packages installed in dir/node_modules against the tree
+// the specs resolve to.
+func (in *Installer) Diff(ctx context.Context, dir string, specs ...string) (*DiffResult, error) {
+	installed, err := in.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(specs) == 0 {
+		if specs, err = in.rootDependencies(dir); err != nil {
+			return nil, fmt.Errorf("npm: unable to diff: %w", err)
+		}
+	}
+	tree, err := in.ResolveTree(ctx, dir, specs...)
+	if err != nil {
+		return nil, err
+	}
+	desired := desiredNodes(tree)
+	result := new(DiffResult)
+	seen := map[string]bool{}
+	for _, pkg := range installed {
+		seen[pkg.Name] = true
+		key, ok := desired[pkg.Name]
+		if !ok {
+			result.Remove = append(result.Remove, &PackageDiff{Name: pkg.Name, From: pkg.Version})
+		} else if version := tree.Nodes[key].Version; version != pkg.Version {
+			result.Change = append(result.Change, &PackageDiff{Name: pkg.Name, From: pkg.Version, To: version})
+		}
+	}
+	for name, key := range desired {
+		if !seen[name] {
+			result.Add = append(result.Add, &PackageDiff{Name: name, To: tree.Nodes[key].Version})
+		}
+	}
+	sort.Slice(result.Add, func(i, j int) bool {
+		return result.Add[i].Name < result.Add[j].Name
+	})
+	return result, nil
+}
+
+// desiredNodes returns the key of each package's node in the tree by the name
+// it's installed under, which is the alias for aliased packages. Requested
+// packages win, then the newest version.
+func desiredNodes(tree *Tree) map[string]string {
+	desired := map[string]string{}
+	for _, node := range tree.Nodes {
+		for name, key := range node.Dependencies {
+			dep, ok := tree.Nodes[key]
+			if !ok {
+				continue
+			}
+			if current, ok := desired[name]; !ok || newerVersion(dep.Version, tree.Nodes[current].Version) {
+				desired[name] = key
+			}
+		}
+	}
+	for i, key := range tree.Roots {
+		node, ok := tree.Nodes[key]
+		if !ok {
+			continue
+		}
+		name := node.Name
+		if spec, err := ParseSpec(tree.specs[i]); err == nil && spec.Alias != "" {
+			name = spec.Alias
+		}
+		desired[name] = key
+	}
+	return desired
+}
+
+// newerVersion returns true if a is newer than b
+func newerVersion(a, b string) bool {
+	va, err := semver.NewVersion(a)
+	if err != nil {
+		return false
+	}
+	vb, err := semver.NewVersion(b)
+	if err != nil {
+		return true
+	}
+	return va.GreaterThan(vb)
+}
@@ -0,0 +1,88 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestList(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"node_modules/uid/package.json":                `{"name":"uid","version":"2.0.2"}`,
+		"node_modules/@lukeed/uuid/package.json":       `{"name":"@lukeed/uuid","version":"2.0.1"}`,
+		"node_modules/uid/node_modules/a/package.json": `{"name":"a","version":"1.0.0"}`,
+		"node_modules/.bin/uid":                        ``,
+		"node_modules/not-a-package/index.js":          ``,
+	}))
+	packages, err := npm.List(dir)
+	is.NoErr(err)
+	is.Equal(packages, []*npm.InstalledPackage{
+		{Name: "@lukeed/uuid", Version: "2.0.1", Dir: filepath.Join(dir, "node_modules", "@lukeed", "uuid")},
+		{Name: "uid", Version: "2.0.2", Dir: filepath.Join(dir, "node_modules", "uid")},
+	})
+	// Nothing is installed yet
+	packages, err = npm.List(t.TempDir())
+	is.NoErr(err)
+	is.Equal(len(packages), 0)
+}
+
+func TestDiff(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{"name":"a","version":"1.0.0","dependencies":{"b":"^1.0.0"}}`,
+		},
+		"b@1.0.0": {},
+		"b@1.1.0": {},
+		"c@1.0.0": {},
+	}))
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	ctx := context.Background()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"node_modules/a/package.json":     `{"name":"a","version":"1.0.0"}`,
+		"node_modules/b/package.json":     `{"name":"b","version":"1.0.0"}`,
+		"node_modules/stale/package.json": `{"name":"stale","version":"1.0.0"}`,
+	}))
+	diff, err := installer.Diff(ctx, dir, "a@1.0.0", "c@1.0.0")
+	is.NoErr(err)
+	is.Equal(diff.Add, []*npm.PackageDiff{{Name: "c", To: "1.0.0"}})
+	is.Equal(diff.Remove, []*npm.PackageDiff{{Name: "stale", From: "1.0.0"}})
+	is.Equal(diff.Change, []*npm.PackageDiff{{Name: "b", From: "1.0.0", To: "1.1.0"}})
+	// Nothing changes once it's installed
+	dir = t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "a@1.0.0", "c@1.0.0"))
+	diff, err = installer.Diff(ctx, dir, "a@1.0.0", "c@1.0.0")
+	is.NoErr(err)
+	is.True(diff.Empty())
+}
+
+func TestDiffAliasAndLayout(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0":          {},
+		"@lukeed/uuid@2.0.1": {},
+	}))
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithScopedLayout(npm.FlatScopes))
+	ctx := context.Background()
+	dir := t.TempDir()
+	specs := []string{"uid2@npm:uid@2.0.0", "@lukeed/uuid@2.0.1"}
+	is.NoErr(installer.Install(ctx, dir, specs...))
+	packages, err := installer.List(dir)
+	is.NoErr(err)
+	is.Equal(len(packages), 2)
+	is.Equal(packages[0].Name, "@lukeed/uuid")
+	is.Equal(packages[1].Name, "uid2")
+	// Aliased and flattened packages match what's installed
+	diff, err := installer.Diff(ctx, dir, specs...)
+	is.NoErr(err)
+	is.True(diff.Empty())
+}
@@ -0,0 +1,196 @@
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// lockfile is the hidden lockfile that npm 7+ writes to
+// node_modules/.package-lock.json to describe the installed tree.
+// Based on: https://docs.npmjs.com/cli/v10/configuring-npm/package-lock-json
+type lockfile struct {
+	Name            string                  `json:"name"`
+	Version         string                  `json:"version,omitempty"`
+	LockfileVersion int                     `json:"lockfileVersion"`
+	Requires        bool                    `json:"requires"`
+	Packages        map[string]*lockPackage `json:"packages"`
+
+	dir string
+	mu  sync.Mutex
+}
+
+type lockPackage struct {
+	Name                 string               `json:"name,omitempty"`
+	Version              string               `json:"version,omitempty"`
+	Resolved             string               `json:"resolved,omitempty"`
+	Integrity            string               `json:"integrity,omitempty"`
+	Link                 bool                 `json:"link,omitempty"`
+	Dev                  bool                 `json:"dev,omitempty"`
+	Dependencies         map[string]string    `json:"dependencies,omitempty"`
+	OptionalDependencies map[string]string    `json:"optionalDependencies,omitempty"`
+	PeerDependencies     map[string]string    `json:"peerDependencies,omitempty"`
+	PeerDependenciesMeta map[string]*PeerMeta `json:"peerDependenciesMeta,omitempty"`
+	DevDependencies      map[string]string    `json:"devDependencies,omitempty"`
+}
+
+func newLockfile(dir string) *lockfile {
+	lock := &lockfile{
+		Name:            filepath.Base(dir),
+		LockfileVersion: 3,
+		Requires:        true,
+		Packages:        map[string]*lockPackage{},
+		dir:             dir,
+	}
+	// Prefer the name and version from the root package.json if there is one
+	if manifest, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		var pkg struct {
+			Name    string `json:"name,omitempty"`
+			Version string `json:"version,omitempty"`
+		}
+		if err := json.Unmarshal(manifest, &pkg); err == nil && pkg.Name != "" {
+			lock.Name = pkg.Name
+			lock.Version = pkg.Version
+		}
+	}
+	return lock
+}
+
+// readLockfile reads a package-lock.json or node_modules/.package-lock.json.
+// Only lockfileVersion 2 and 3 are supported since they contain the "packages"
+// section.
+func readLockfile(lockPath string) (*lockfile, error) {
+	lockJSON, err := os.ReadFile(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read lockfile: %w", err)
+	}
+	lock := &lockfile{
+		dir: filepath.Dir(lockPath),
+	}
+	if err := json.Unmarshal(lockJSON, lock); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal lockfile %s: %w", lockPath, err)
+	}
+	if lock.LockfileVersion < 2 {
+		return nil, fmt.Errorf("unsupported lockfileVersion %d in %s", lock.LockfileVersion, lockPath)
+	}
+	if lock.Packages == nil {
+		lock.Packages = map[string]*lockPackage{}
+	}
+	return lock, nil
+}
+
+// production returns the keys of the packages reachable from the root's
+// production dependencies. Lockfiles without a root entry fall back to the dev
+// flag npm sets on dev-only packages.
+func (l *lockfile) production() map[string]bool {
+	reachable := map[string]bool{}
+	root, ok := l.Packages[""]
+	if !ok {
+		for key, pkg := range l.Packages {
+			if !pkg.Dev {
+				reachable[key] = true
+			}
+		}
+		return reachable
+	}
+	var visit func(from string, pkg *lockPackage)
+	visit = func(from string, pkg *lockPackage) {
+		for _, deps := range []map[string]string{pkg.Dependencies, pkg.OptionalDependencies, pkg.PeerDependencies} {
+			for name := range deps {
+				key := l.resolve(from, name)
+				if key == "" || reachable[key] {
+					continue
+				}
+				reachable[key] = true
+				dep := l.Packages[key]
+				// Links point to the entry that has the dependencies
+				if target, ok := l.Packages[dep.Resolved]; dep.Link && ok {
+					visit(key, target)
+					continue
+				}
+				visit(key, dep)
+			}
+		}
+	}
+	visit("", root)
+	return reachable
+}
+
+// resolve the key of a dependency from the package at the given key, using
+// Node's lookup algorithm of walking up the node_modules directories.
+func (l *lockfile) resolve(from, name string) string {
+	dir := from
+	for {
+		key := path.Join(dir, "node_modules", name)
+		if _, ok := l.Packages[key]; ok {
+			return key
+		} else if dir == "" {
+			return ""
+		}
+		index := strings.LastIndex(dir, "node_modules/")
+		if index == -1 {
+			dir = ""
+			continue
+		}
+		dir = strings.TrimSuffix(dir[:index], "/")
+	}
+}
+
+// Add an installed package to the lockfile. Packages are keyed by their path
+// relative to the root directory (e.g. node_modules/@lukeed/uuid).
+func (l *lockfile) Add(pkgDir string, pkg *lockPackage) {
+	key := pkgDir
+	if rel, err := filepath.Rel(l.dir, pkgDir); err == nil {
+		key = rel
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Packages[filepath.ToSlash(key)] = pkg
+}
+
+// keepInstalled carries over the entries in the existing hidden lockfile for
+// packages that are still in node_modules, so the lockfile describes the whole
+// tree instead of only what was just installed. Unreadable lockfiles are
+// replaced.
+func (l *lockfile) keepInstalled() {
+	previous, err := readLockfile(filepath.Join(l.dir, "node_modules", ".package-lock.json"))
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, pkg := range previous.Packages {
+		if _, ok := l.Packages[key]; ok || key == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(l.dir, filepath.FromSlash(key), "package.json")); err != nil {
+			continue
+		}
+		l.Packages[key] = pkg
+	}
+}
+
+// Write the lockfile out to node_modules/.package-lock.json
+func (l *lockfile) Write() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.Packages) == 0 {
+		return nil
+	}
+	lockJSON, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal lockfile: %w", err)
+	}
+	lockPath := filepath.Join(l.dir, "node_modules", ".package-lock.json")
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return fmt.Errorf("unable to make directory for lockfile: %w", err)
+	}
+	if err := os.WriteFile(lockPath, append(lockJSON, '\n'), 0644); err != nil {
+		return fmt.Errorf("unable to write lockfile: %w", err)
+	}
+	return nil
+}
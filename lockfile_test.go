@@ -0,0 +1,91 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+type lockfile struct {
+	Name            string `json:"name"`
+	LockfileVersion int    `json:"lockfileVersion"`
+	Packages        map[string]struct {
+		Version      string            `json:"version"`
+		Resolved     string            `json:"resolved"`
+		Integrity    string            `json:"integrity"`
+		Dependencies map[string]string `json:"dependencies"`
+	} `json:"packages"`
+}
+
+func readLockfile(t testing.TB, path string) *lockfile {
+	t.Helper()
+	code, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read lockfile %q: %s", path, err)
+	}
+	lock := new(lockfile)
+	if err := json.Unmarshal(code, lock); err != nil {
+		t.Fatalf("unable to unmarshal lockfile %q: %s", path, err)
+	}
+	return lock
+}
+
+func TestHiddenLockfile(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{
+			"name": "app",
+			"version": "0.0.1"
+		}`,
+		"local/main.ts": `export const main = "main"`,
+		"local/package.json": `{
+			"name": "bud",
+			"version": "1.2.3",
+			"main": "./main.ts"
+		}`,
+	}
+	is.NoErr(writeFiles(dir, files))
+	ctx := context.Background()
+	err := npm.Install(ctx, dir, "./local")
+	is.NoErr(err)
+	lock := readLockfile(t, filepath.Join(dir, "node_modules", ".package-lock.json"))
+	is.Equal(lock.Name, "app")
+	is.Equal(lock.LockfileVersion, 3)
+	is.Equal(len(lock.Packages), 1)
+	bud, ok := lock.Packages["node_modules/bud"]
+	is.True(ok)
+	is.Equal(bud.Version, "1.2.3")
+	is.Equal(bud.Resolved, "file:local")
+}
+
+func TestHiddenLockfileAcrossInstalls(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.2":    {},
+		"dequal@2.0.3": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.2"))
+	is.NoErr(installer.Install(ctx, dir, "dequal@2.0.3"))
+	lock := readLockfile(t, filepath.Join(dir, "node_modules", ".package-lock.json"))
+	is.Equal(len(lock.Packages), 2)
+	is.Equal(lock.Packages["node_modules/uid"].Version, "2.0.2")
+	is.Equal(lock.Packages["node_modules/dequal"].Version, "2.0.3")
+	// Packages that are no longer in node_modules are dropped
+	is.NoErr(os.RemoveAll(filepath.Join(dir, "node_modules", "uid")))
+	is.NoErr(installer.Install(ctx, dir, "dequal@2.0.3"))
+	lock = readLockfile(t, filepath.Join(dir, "node_modules", ".package-lock.json"))
+	is.Equal(len(lock.Packages), 1)
+	_, ok := lock.Packages["node_modules/dequal"]
+	is.True(ok)
+}
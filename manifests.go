@@ -0,0 +1,108 @@
+package npm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// WithManifests installs the union of the dependencies in these package.json
+// files along with dir/package.json when Install is called without packages,
+// for setups with several manifests that share one node_modules. Relative
+// paths are relative to dir. When manifests depend on different ranges of a
+// package, the ranges are combined so the highest version that satisfies all
+// of them is installed. Dir/package.json is optional when manifests are set.
+func WithManifests(paths []string) Option {
+	return func(in *Installer) {
+		in.manifests = paths
+	}
+}
+
+// readRootDependencies reads the dependencies of a root package.json. Local
+// dependencies are made relative to dir.
+func (in *Installer) readRootDependencies(dir, manifestPath string) (map[string]string, error) {
+	rel, err := filepath.Rel(dir, manifestPath)
+	if err != nil {
+		rel = manifestPath
+	}
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", rel, err)
+	}
+	var pkg struct {
+		Dependencies         map[string]string    `json:"dependencies,omitempty"`
+		PeerDependencies     map[string]string    `json:"peerDependencies,omitempty"`
+		PeerDependenciesMeta map[string]*PeerMeta `json:"peerDependenciesMeta,omitempty"`
+	}
+	if err := in.unmarshalManifest(manifest, &pkg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal %s: %w", rel, err)
+	}
+	if in.rootPeers {
+		pkg.Dependencies = rootPeers(pkg.Dependencies, pkg.PeerDependencies, pkg.PeerDependenciesMeta)
+	}
+	manifestDir := filepath.Dir(manifestPath)
+	if manifestDir == filepath.Clean(dir) {
+		return pkg.Dependencies, nil
+	}
+	for name, version := range pkg.Dependencies {
+		if isLocal(version) {
+			pkg.Dependencies[name] = localSpec(dir, filepath.Join(manifestDir, version))
+		}
+	}
+	return pkg.Dependencies, nil
+}
+
+// mergeManifests merges the dependencies of the extra manifests into deps
+func (in *Installer) mergeManifests(dir string, deps map[string]string) (map[string]string, error) {
+	merged := make(map[string]string, len(deps))
+	for name, version := range deps {
+		merged[name] = version
+	}
+	for _, manifestPath := range in.manifests {
+		if !filepath.IsAbs(manifestPath) {
+			manifestPath = filepath.Join(dir, manifestPath)
+		}
+		manifestDeps, err := in.readRootDependencies(dir, manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		for name, version := range manifestDeps {
+			existing, ok := merged[name]
+			if !ok {
+				merged[name] = version
+				continue
+			}
+			combined, err := combineRanges(existing, version)
+			if err != nil {
+				return nil, fmt.Errorf("npm: unable to combine the dependencies on %s in %s: %w", name, manifestPath, err)
+			}
+			merged[name] = combined
+		}
+	}
+	return merged, nil
+}
+
+// combineRanges combines two version ranges into one that only matches the
+// versions both of them match. Every pair of alternatives is combined, since
+// || binds looser than the implicit and (e.g. ^1.0.0 || ^2.0.0 and >=1.5.0
+// becomes ^1.0.0 >=1.5.0 || ^2.0.0 >=1.5.0).
+func combineRanges(a, b string) (string, error) {
+	if a == b {
+		return a, nil
+	}
+	if _, err := semver.NewConstraint(a); err != nil {
+		return "", fmt.Errorf("%s conflicts with %s", a, b)
+	} else if _, err := semver.NewConstraint(b); err != nil {
+		return "", fmt.Errorf("%s conflicts with %s", a, b)
+	}
+	var alternatives []string
+	for _, left := range strings.Split(a, "||") {
+		for _, right := range strings.Split(b, "||") {
+			alternatives = append(alternatives, strings.TrimSpace(left)+" "+strings.TrimSpace(right))
+		}
+	}
+	return strings.Join(alternatives, " || "), nil
+}
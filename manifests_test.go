@@ -0,0 +1,77 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestManifests(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0": {},
+		"uid@1.5.0": {},
+		"uid@2.0.0": {},
+		"a@1.0.0":   {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json":                `{"dependencies":{"uid":"^1.0.0"}}`,
+		"web/package.json":            `{"dependencies":{"uid":"<1.5.0 || >=2.0.0","local":"../packages/local"}}`,
+		"api/package.json":            `{"dependencies":{"a":"1.0.0"}}`,
+		"packages/local/package.json": `{"name":"local","version":"0.0.0"}`,
+	}))
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithManifests([]string{"web/package.json", filepath.Join(dir, "api", "package.json")}))
+	is.NoErr(installer.Install(ctx, dir))
+	// The highest version that satisfies both ranges
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"1.0.0"}`)
+	exists(t, filepath.Join(dir, "node_modules", "a", "package.json"))
+	// Local dependencies are relative to their manifest
+	exists(t, filepath.Join(dir, "node_modules", "local", "package.json"))
+	// Ranges that aren't semver can't be combined
+	is.NoErr(writeFiles(dir, map[string]string{
+		"web/package.json": `{"dependencies":{"uid":"latest"}}`,
+	}))
+	err := installer.Install(ctx, dir)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "^1.0.0 conflicts with latest"))
+}
+
+func TestInstallDependencies(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0": {},
+		"uid@2.0.0": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json":              `{"dependencies":{"uid":"^2.0.0"}}`,
+		"vendor/app/package.json":   `{"name":"app","version":"1.0.0","dependencies":{"uid":"^1.0.0","util":"../util"}}`,
+		"vendor/app/index.js":       `require("uid")`,
+		"vendor/util/package.json":  `{"name":"util","version":"0.0.0"}`,
+		"vendor/empty/package.json": `{"name":"empty","version":"1.0.0"}`,
+	}))
+	installer := npm.New(npm.WithRegistry(server.URL))
+	is.NoErr(installer.InstallDependencies(ctx, dir, filepath.Join(dir, "vendor", "app")))
+	// The dependencies are installed, but not the package itself
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"1.0.0"}`)
+	exists(t, filepath.Join(dir, "node_modules", "util", "package.json"))
+	notExists(t, filepath.Join(dir, "node_modules", "app"))
+	// Without dependencies, nothing is installed from dir/package.json
+	dir2 := t.TempDir()
+	is.NoErr(writeFiles(dir2, map[string]string{"package.json": `{"dependencies":{"uid":"^2.0.0"}}`}))
+	is.NoErr(installer.InstallDependencies(ctx, dir2, filepath.Join(dir, "vendor", "empty")))
+	notExists(t, filepath.Join(dir2, "node_modules"))
+	err := installer.InstallDependencies(ctx, dir, filepath.Join(dir, "vendor", "missing"))
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "unable to install the dependencies of"))
+}
@@ -0,0 +1,141 @@
+package npm
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memFS is a read-only filesystem held in memory, keyed by slash-separated
+// paths. Directories are implied by the files inside them.
+type memFS map[string]*memFile
+
+// memFile is a file or directory in a memFS
+type memFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+var _ fs.FS = memFS(nil)
+
+// Open the file or directory at name
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, ok := m[name]
+	if ok && !file.mode.IsDir() {
+		return &memReader{
+			info:   &memInfo{path.Base(name), file},
+			Reader: bytes.NewReader(file.data),
+		}, nil
+	}
+	// List what's directly inside the directory
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	children := map[string]*memInfo{}
+	for filePath, child := range m {
+		rest, found := strings.CutPrefix(filePath, prefix)
+		if !found || rest == "" {
+			continue
+		}
+		childName, _, nested := strings.Cut(rest, "/")
+		if nested {
+			if _, ok := children[childName]; !ok {
+				children[childName] = &memInfo{childName, impliedDir(m[prefix+childName])}
+			}
+			continue
+		}
+		children[childName] = &memInfo{childName, child}
+	}
+	if !ok && len(children) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, child)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return &memDir{
+		path:    name,
+		info:    &memInfo{path.Base(name), impliedDir(file)},
+		entries: entries,
+	}, nil
+}
+
+// impliedDir returns the directory, or a directory for the files inside it
+// when it isn't listed itself
+func impliedDir(file *memFile) *memFile {
+	if file == nil {
+		return &memFile{mode: fs.ModeDir | 0555}
+	}
+	return file
+}
+
+// memInfo describes a file or directory in a memFS
+type memInfo struct {
+	name string
+	file *memFile
+}
+
+var (
+	_ fs.FileInfo = (*memInfo)(nil)
+	_ fs.DirEntry = (*memInfo)(nil)
+)
+
+func (i *memInfo) Name() string               { return i.name }
+func (i *memInfo) Size() int64                { return int64(len(i.file.data)) }
+func (i *memInfo) Mode() fs.FileMode          { return i.file.mode }
+func (i *memInfo) Type() fs.FileMode          { return i.file.mode.Type() }
+func (i *memInfo) ModTime() time.Time         { return i.file.modTime }
+func (i *memInfo) IsDir() bool                { return i.file.mode.IsDir() }
+func (i *memInfo) Sys() interface{}           { return nil }
+func (i *memInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// memReader is an open file in a memFS
+type memReader struct {
+	info *memInfo
+	*bytes.Reader
+}
+
+func (r *memReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+func (r *memReader) Close() error               { return nil }
+
+// memDir is an open directory in a memFS
+type memDir struct {
+	path    string
+	info    *memInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+var _ fs.ReadDirFile = (*memDir)(nil)
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: fs.ErrInvalid}
+}
+
+// ReadDir reads the next n entries, or all of the remaining ones when n <= 0
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		entries = entries[:min(n, len(entries))]
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
@@ -0,0 +1,26 @@
+package npm
+
+import "strings"
+
+// WithMirrors sets registries to fall back to, in order, when the registry
+// set by WithRegistry can't be reached or has a server error (5xx). Both the
+// metadata and the tarballs fall back. Tarballs from a mirror are still
+// verified against the integrity from the metadata. Scoped registries don't
+// fall back to the mirrors.
+func WithMirrors(mirrors ...string) Option {
+	return func(in *Installer) {
+		for _, mirror := range mirrors {
+			in.mirrors = append(in.mirrors, strings.TrimSuffix(mirror, "/"))
+		}
+	}
+}
+
+// registriesFor returns the registries to try in order for packages in the
+// scope
+func (in *Installer) registriesFor(scope string) []string {
+	registry := in.registryFor(scope)
+	if registry != in.registry {
+		return []string{registry}
+	}
+	return append([]string{registry}, in.mirrors...)
+}
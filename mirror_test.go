@@ -0,0 +1,86 @@
+package npm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestMirrors(t *testing.T) {
+	is := is.New(t)
+	packages := map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	}
+	registry := registryHandler(t, packages)
+	// The primary registry serves metadata, but its tarballs are down
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer primary.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer down.Close()
+	mirror := httptest.NewServer(registryHandler(t, packages))
+	defer mirror.Close()
+	ctx := context.Background()
+	// Tarballs fall back to the mirrors in order
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(primary.URL), npm.WithMirrors(down.URL, mirror.URL))
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	// Metadata falls back to the mirrors too
+	dir = t.TempDir()
+	installer = npm.New(npm.WithRegistry(down.URL), npm.WithMirrors(mirror.URL))
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	// Client errors don't fall back
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	installer = npm.New(npm.WithRegistry(missing.URL), npm.WithMirrors(mirror.URL))
+	err := installer.Install(ctx, t.TempDir(), "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "404"))
+}
+
+func TestMirrorsIntegrity(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer primary.Close()
+	// The mirror serves a tampered tarball
+	mirror := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "evil"`,
+		},
+	}))
+	defer mirror.Close()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(primary.URL), npm.WithMirrors(mirror.URL))
+	err := installer.Install(context.Background(), dir, "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "unable to verify"))
+	notExists(t, filepath.Join(dir, "node_modules", "uid"))
+}
@@ -0,0 +1,37 @@
+package npm
+
+import (
+	"path"
+)
+
+// WithNoHoist keeps the packages matching the patterns nested under the
+// packages that depend on them (e.g. node_modules/a/node_modules/react),
+// instead of hoisting them to the top of node_modules. Patterns match package
+// names like path.Match (e.g. react or @types/*). Packages that are installed
+// directly or as peer dependencies are always hoisted.
+func WithNoHoist(patterns []string) Option {
+	return func(in *Installer) {
+		in.noHoist = patterns
+	}
+}
+
+// nested returns true if the package stays nested under its dependents
+func (in *Installer) nested(name string) bool {
+	for _, pattern := range in.noHoist {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// nest the package under the parent's node_modules, where parent is the
+// parent's path relative to the root (e.g. node_modules/a). Packages without
+// a parent are hoisted.
+func (in *Installer) nest(pkg installable, parent string) {
+	remote, ok := pkg.(*remotePackage)
+	if !ok || parent == "" || !in.nested(remote.name()) {
+		return
+	}
+	remote.Path = path.Join(parent, "node_modules", remote.moduleDir())
+}
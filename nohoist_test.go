@@ -0,0 +1,39 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestNoHoist(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{"dependencies": {"react": "^1.0.0", "uid": "^2.0.0"}}`,
+		},
+		"b@1.0.0": {
+			"package.json": `{"dependencies": {"react": "^2.0.0"}}`,
+		},
+		"react@1.0.0": {},
+		"react@2.0.0": {},
+		"uid@2.0.0":   {},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithNoHoist([]string{"re*"}))
+	is.NoErr(installer.Install(context.Background(), dir, "a@1.0.0", "b@1.0.0"))
+	nodeModules := filepath.Join(dir, "node_modules")
+	// Each dependent gets its own copy
+	equals(t, filepath.Join(nodeModules, "a", "node_modules", "react", "package.json"), `{"name":"react","version":"1.0.0"}`)
+	equals(t, filepath.Join(nodeModules, "b", "node_modules", "react", "package.json"), `{"name":"react","version":"2.0.0"}`)
+	_, err := os.Stat(filepath.Join(nodeModules, "react"))
+	is.True(os.IsNotExist(err))
+	// Other packages are still hoisted
+	equals(t, filepath.Join(nodeModules, "uid", "package.json"), `{"name":"uid","version":"2.0.0"}`)
+}
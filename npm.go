@@ -2,9 +2,13 @@ package npm
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -13,7 +17,10 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/matthewmueller/glob"
@@ -22,60 +29,181 @@ import (
 )
 
 type Manifest struct {
-	Name    string                       `json:"name,omitempty"`
-	Main    string                       `json:"main,omitempty"`
-	Browser string                       `json:"browser,omitempty"`
-	Files   []string                     `json:"files,omitempty"`
-	Imports map[string]map[string]string `json:"imports,omitempty"`
-	// TODO: this can also be a string or list
-	Exports      map[string]string `json:"exports,omitempty"`
-	Dependencies map[string]string `json:"dependencies,omitempty"`
+	Name                 string               `json:"name,omitempty"`
+	Version              string               `json:"version,omitempty"`
+	Main                 string               `json:"main,omitempty"`
+	Browser              *Browser             `json:"browser,omitempty"`
+	Module               string               `json:"module,omitempty"`
+	Types                string               `json:"types,omitempty"`
+	Typings              string               `json:"typings,omitempty"`
+	Files                []string             `json:"files,omitempty"`
+	Imports              Imports              `json:"imports,omitempty"`
+	Exports              Exports              `json:"exports,omitempty"`
+	Dependencies         map[string]string    `json:"dependencies,omitempty"`
+	OptionalDependencies map[string]string    `json:"optionalDependencies,omitempty"`
+	PeerDependencies     map[string]string    `json:"peerDependencies,omitempty"`
+	PeerDependenciesMeta map[string]*PeerMeta `json:"peerDependenciesMeta,omitempty"`
+	SideEffects          *SideEffects         `json:"sideEffects,omitempty"`
 }
 
+// Install packages into dir/node_modules. When no packages are passed in, the
+// dependencies in dir/package.json are installed. Packages are specified like
+// ParseSpec accepts.
 func Install(ctx context.Context, dir string, packages ...string) error {
-	eg := new(errgroup.Group)
-	sg := new(singleflight.Group)
+	return defaultInstaller.Install(ctx, dir, packages...)
+}
+
+// Install packages into dir/node_modules. When no packages are passed in, the
+// dependencies in dir/package.json are installed.
+func (in *Installer) Install(ctx context.Context, dir string, packages ...string) error {
+	_, err := in.InstallWithResult(ctx, dir, packages...)
+	return err
+}
 
+// InstallWithResult installs packages like Install, returning what was
+// installed. With WithBestEffort, the result is returned along with the error
+// when only some of the packages failed.
+func (in *Installer) InstallWithResult(ctx context.Context, dir string, packages ...string) (*InstallResult, error) {
 	if len(packages) == 0 {
-		manifestPath := filepath.Join(dir, "package.json")
-		manifest, err := os.ReadFile(manifestPath)
+		deps, err := in.rootDependencies(dir)
 		if err != nil {
-			return fmt.Errorf("unable to read package.json: %w", err)
-		}
-		var pkg struct {
-			Dependencies map[string]string `json:"dependencies,omitempty"`
-		}
-		if err := json.Unmarshal(manifest, &pkg); err != nil {
-			return fmt.Errorf("unable to unmarshal package.json: %w", err)
-		}
-		for dep, version := range pkg.Dependencies {
-			if isLocal(version) || isAbsolute(version) {
-				packages = append(packages, version)
-				continue
-			}
-			pkgname := fmt.Sprintf("%s@%s", dep, version)
-			packages = append(packages, pkgname)
+			return nil, err
 		}
+		packages = deps
 	}
-
+	overrides, err := in.readOverrides(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.checkTotalSize(ctx, dir, overrides, packages); err != nil {
+		return nil, err
+	}
+	if err := in.cleanNodeModules(dir); err != nil {
+		return nil, err
+	}
+	s := &session{
+		in:   in,
+		dir:  dir,
+		lock: newLockfile(dir),
+	}
+	defer s.removeStagingDir()
+	eg := s.group()
 	for _, pkg := range packages {
 		pkg := pkg
 		eg.Go(func() error {
-			return install(ctx, sg, dir, pkg)
+			return s.install(ctx, pkg, "", 0, overrides)
 		})
 	}
-	return eg.Wait()
+	installErr := eg.Wait()
+	if installErr != nil && !in.bestEffort {
+		return nil, installErr
+	}
+	if err := s.finish(ctx); err != nil {
+		return nil, errors.Join(installErr, err)
+	}
+	if installErr != nil {
+		return s.result(), fmt.Errorf("npm: unable to install every package:\n%w", installErr)
+	}
+	return s.result(), nil
 }
 
-func install(ctx context.Context, sg *singleflight.Group, dir string, pkgname string) error {
-	pkg, err := resolvePackage(dir, pkgname)
+// rootDependencies returns the dependencies in dir/package.json and the
+// manifests from WithManifests as package specs
+func (in *Installer) rootDependencies(dir string) ([]string, error) {
+	deps, err := in.readRootDependencies(dir, filepath.Join(dir, "package.json"))
+	if err != nil {
+		if len(in.manifests) == 0 || !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		deps = map[string]string{}
+	}
+	if len(in.manifests) > 0 {
+		if deps, err = in.mergeManifests(dir, deps); err != nil {
+			return nil, err
+		}
+	}
+	return dependencySpecs(deps), nil
+}
+
+// dependencySpecs turns the dependencies of a package.json into package specs
+func dependencySpecs(deps map[string]string) []string {
+	var packages []string
+	for dep, version := range deps {
+		if isLocal(version) || isAbsolute(version) {
+			packages = append(packages, version)
+			continue
+		}
+		pkgname := fmt.Sprintf("%s@%s", dep, version)
+		packages = append(packages, pkgname)
+	}
+	return packages
+}
+
+// session holds the state of a single install
+type session struct {
+	in   *Installer
+	dir  string
+	sg   singleflight.Group
+	lock *lockfile
+	// locked is true when installing from a lockfile, which already lists the
+	// entire tree, so dependencies aren't installed transitively.
+	locked bool
+
+	mu         sync.Mutex
+	advisories []*Advisory
+	peers      []*peerRequirement
+
+	licenseViolations []*LicenseViolation
+	installed         []*InstalledPackage
+	// subtrees are the directories reported to WithSubtreeInstalled
+	subtrees map[string]bool
+
+	// workspaces are the packages in the workspaces, read on first use
+	workspaceOnce sync.Once
+	workspaces    map[string]*localPackage
+	workspaceErr  error
+
+	// scriptsMu serializes approving lifecycle scripts
+	scriptsMu sync.Mutex
+}
+
+// install a package. The depth is how far the package is from the packages
+// that were requested, which are at depth 0. The parent is the path of the
+// package that depends on it, if any. Overrides from the root package.json
+// replace the versions of transitive dependencies.
+func (s *session) install(ctx context.Context, pkgname, parent string, depth int, overrides *overrides) error {
+	start := time.Now()
+	pkg, err := s.resolvePackage(ctx, pkgname)
 	if err != nil {
 		return err
 	}
+	// Overrides match the version that was originally resolved
+	nested := overrides.enterPackage(pkg)
+	if remote, ok := pkg.(*remotePackage); ok && depth > 0 {
+		if version, ok := overrides.version(remote.name(), remote.Version); ok && version != remote.Version {
+			pkgname = remote.name() + "@" + version
+			if remote.Alias != "" {
+				pkgname = remote.Alias + "@npm:" + pkgname
+			}
+			if pkg, err = s.resolvePackage(ctx, pkgname); err != nil {
+				return err
+			}
+		}
+	}
+	if remote, ok := pkg.(*remotePackage); ok {
+		remote.timings.Resolve = time.Since(start)
+	}
+	s.in.nest(pkg, parent)
+	return s.installPackage(ctx, pkgname, pkg, depth, nested)
+}
+
+// installPackage installs a resolved package. The overrides apply to the
+// package's dependencies.
+func (s *session) installPackage(ctx context.Context, pkgname string, pkg installable, depth int, overrides *overrides) error {
 	// Only install a package once
 	// TODO: this may need to get smarter to handle different versions
-	_, err, _ = sg.Do(pkg.Key(), func() (interface{}, error) {
-		if err := pkg.Install(ctx, sg, dir); err != nil {
+	_, err, _ := s.sg.Do(pkg.Key(), func() (interface{}, error) {
+		if err := pkg.Install(ctx, s, depth, overrides); err != nil {
 			return nil, fmt.Errorf("npm install %s: %w", pkgname, err)
 		}
 		return nil, nil
@@ -83,9 +211,73 @@ func install(ctx context.Context, sg *singleflight.Group, dir string, pkgname st
 	return err
 }
 
+// installDependencies installs the dependencies of the package at parent at
+// the given depth, unless we've reached the maximum depth.
+func (s *session) installDependencies(ctx context.Context, parent string, deps map[string]string, depth int, overrides *overrides) error {
+	if !s.descend(depth) {
+		return nil
+	}
+	eg := s.group()
+	for dep, version := range deps {
+		pkgname := fmt.Sprintf("%s@%s", dep, version)
+		eg.Go(func() error {
+			return s.install(ctx, pkgname, parent, depth+1, overrides)
+		})
+	}
+	return eg.Wait()
+}
+
+// stagingDir is where packages are extracted before they're moved into place.
+// It defaults to node_modules/.staging so it's on the same device as the
+// packages.
+func (s *session) stagingDir() string {
+	if s.in.tempDir != "" {
+		return s.in.tempDir
+	}
+	return filepath.Join(s.dir, "node_modules", ".staging")
+}
+
+// removeStagingDir removes the default staging directory once it's empty
+func (s *session) removeStagingDir() {
+	if s.in.tempDir == "" {
+		os.Remove(s.stagingDir())
+	}
+}
+
+// descend returns true if the dependencies of a package at depth should be
+// installed.
+func (s *session) descend(depth int) bool {
+	return !s.locked && (s.in.maxDepth < 0 || depth < s.in.maxDepth)
+}
+
+// finish the install by checking peers, reporting licenses, manifest problems
+// and advisories, then linking bins and writing the lockfile
+func (s *session) finish(ctx context.Context) error {
+	if err := s.checkPeers(); err != nil {
+		return err
+	}
+	if err := s.reportLicenses(); err != nil {
+		return err
+	}
+	if err := s.validateManifests(); err != nil {
+		return err
+	}
+	if err := s.checkUnmet(); err != nil {
+		return err
+	}
+	if err := s.reportAdvisories(ctx); err != nil {
+		return err
+	}
+	if err := s.in.linkBins(s.dir); err != nil {
+		return err
+	}
+	s.lock.keepInstalled()
+	return s.lock.Write()
+}
+
 type installable interface {
 	Key() string
-	Install(ctx context.Context, sg *singleflight.Group, to string) error
+	Install(ctx context.Context, s *session, depth int, overrides *overrides) error
 }
 
 func parseScope(pkgname string) (scope string, name string) {
@@ -99,86 +291,466 @@ func parseScope(pkgname string) (scope string, name string) {
 // Version resolves the version of a package. To get the latest you can do
 // `version, err := npm.Version(ctx, "preact", "*")`.
 func Version(ctx context.Context, pkgname, constraint string) (string, error) {
-	version, err := resolveVersion(pkgname, constraint)
+	return defaultInstaller.Version(ctx, pkgname, constraint)
+}
+
+// Version resolves the version of a package.
+func (in *Installer) Version(ctx context.Context, pkgname, constraint string) (string, error) {
+	version, err := in.resolveVersion(ctx, pkgname, constraint)
 	if err != nil {
 		return "", err
 	}
 	return version, nil
 }
 
-func resolvePackage(dir, pkgname string) (installable, error) {
-	if isLocal(pkgname) {
-		return readLocalPackage(filepath.Join(dir, pkgname))
-	} else if isAbsolute(pkgname) {
-		return readLocalPackage(pkgname)
+// ResolvePatched resolves the lowest version of a package that satisfies the
+// constraint and is at or above minVersion, which is the smallest upgrade that
+// picks up a security patch (e.g. ResolvePatched(ctx, "lodash", "^4.0.0",
+// "4.17.21")).
+func ResolvePatched(ctx context.Context, pkgname, constraint, minVersion string) (string, error) {
+	return defaultInstaller.ResolvePatched(ctx, pkgname, constraint, minVersion)
+}
+
+// ResolvePatched resolves the lowest version of a package that satisfies the
+// constraint and is at or above minVersion.
+func (in *Installer) ResolvePatched(ctx context.Context, pkgname, constraint, minVersion string) (string, error) {
+	meta, err := in.fetchMetadata(ctx, pkgname)
+	if err != nil {
+		return "", fmt.Errorf("npm: unable to resolve a patched version of %s: %w", pkgname, err)
 	}
-	index := strings.LastIndex(pkgname, "@")
-	if index == -1 {
-		return nil, fmt.Errorf("npm: unable to install %[1]s because it's missing the version (e.g. %[1]s@1.0.0)", pkgname)
+	meta, err = in.filterVersions(meta)
+	if err != nil {
+		return "", fmt.Errorf("npm: unable to resolve a patched version of %s: %w", pkgname, err)
 	}
-	pkgName, version := pkgname[:index], pkgname[index+1:]
-	scope, name := parseScope(pkgName)
-	if version == "" {
-		return nil, fmt.Errorf("npm: unable to install %[1]s because it's missing the version (e.g. %[1]s@1.0.0)", pkgname)
-	} else if version == "latest" {
-		return nil, fmt.Errorf("npm: unable to install %[1]s because tagged versions aren't supported yet", pkgname)
+	version, err := meta.ResolvePatched(constraint, minVersion)
+	if err != nil {
+		return "", fmt.Errorf("npm: unable to resolve a patched version of %s: %w", pkgname, err)
+	}
+	return version, nil
+}
+
+// TarballURL returns where the package's tarball would be downloaded from. The
+// version may be a range, which is resolved first. The registry's dist.tarball
+// is used when there is one, otherwise the URL is built from the registry.
+func TarballURL(ctx context.Context, pkgName, version string) (string, error) {
+	return defaultInstaller.TarballURL(ctx, pkgName, version)
+}
+
+// TarballURL returns where the package's tarball would be downloaded from.
+func (in *Installer) TarballURL(ctx context.Context, pkgName, version string) (string, error) {
+	meta, err := in.metadataFor(ctx, pkgName, version)
+	if err != nil {
+		return "", fmt.Errorf("npm: unable to get the tarball url for %s: %w", pkgName, err)
+	}
+	version, err = in.resolve(meta, version)
+	if err != nil {
+		return "", fmt.Errorf("npm: unable to get the tarball url for %s: %w", pkgName, err)
+	}
+	return in.newRemotePackage(pkgName, meta, version).url(), nil
+}
+
+// ResolveVersions resolves the version of many packages at once, keyed by
+// package name. Each package's metadata is fetched once, concurrently.
+func ResolveVersions(ctx context.Context, constraints map[string]string) (map[string]string, error) {
+	return defaultInstaller.ResolveVersions(ctx, constraints)
+}
+
+// ResolveVersions resolves the version of many packages at once.
+func (in *Installer) ResolveVersions(ctx context.Context, constraints map[string]string) (map[string]string, error) {
+	versions := make(map[string]string, len(constraints))
+	var mu sync.Mutex
+	eg, ctx := errgroup.WithContext(ctx)
+	for pkgName, constraint := range constraints {
+		eg.Go(func() error {
+			version, err := in.resolveVersion(ctx, pkgName, constraint)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			versions[pkgName] = version
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, fmt.Errorf("npm: unable to resolve versions: %w", err)
+	}
+	return versions, nil
+}
+
+// resolvePackage resolves the spec to the package to install. Specs are
+// parsed with ParseSpec, so what Install accepts is what ParseSpec accepts.
+func (s *session) resolvePackage(ctx context.Context, pkgname string) (installable, error) {
+	spec, err := ParseSpec(pkgname)
+	if err != nil {
+		return nil, err
+	}
+	switch spec.Type {
+	case SpecLocal, SpecAbsolute:
+		pkgPath := spec.Path
+		if spec.Type == SpecLocal {
+			pkgPath = filepath.Join(s.dir, spec.Path)
+		}
+		if isGlob(spec.Path) {
+			return s.resolveLocalGlob(spec.Path)
+		}
+		return s.in.readLocalPackage(pkgPath)
+	case SpecGitHub:
+		return &githubPackage{Alias: spec.Alias, Repo: spec.Repo, Ref: spec.Ref, Subdir: spec.Subdir}, nil
+	case SpecWorkspace:
+		return s.workspace(spec.Name, spec.Version)
+	}
+	meta, err := s.in.metadataFor(ctx, spec.Name, spec.Version)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve versions for %s: %w", spec.Name, err)
 	}
-	version, err := resolveVersion(pkgName, version)
+	// Remember the dist-tag the version came from (e.g. latest)
+	tag := ""
+	if _, ok := meta.DistTags[spec.Version]; ok {
+		tag = spec.Version
+	}
+	version, err := s.in.resolve(meta, spec.Version)
 	if err != nil {
 		return nil, err
 	}
-	return &remotePackage{
+	pkg := s.in.newRemotePackage(spec.Name, meta, version)
+	pkg.Tag = tag
+	pkg.Alias = spec.Alias
+	return pkg, nil
+}
+
+// splitPackage splits a package spec like @scope/name@version into the package
+// name and its version.
+func splitPackage(pkgname string) (pkgName, version string, err error) {
+	index := strings.LastIndex(pkgname, "@")
+	if index <= 0 {
+		return "", "", fmt.Errorf("npm: unable to install %[1]s because it's missing the version (e.g. %[1]s@1.0.0)", pkgname)
+	}
+	pkgName, version = pkgname[:index], pkgname[index+1:]
+	if version == "" {
+		return "", "", fmt.Errorf("npm: unable to install %[1]s because it's missing the version (e.g. %[1]s@1.0.0)", pkgname)
+	}
+	return pkgName, version, nil
+}
+
+// newRemotePackage describes a resolved version of a package in the registry
+func (in *Installer) newRemotePackage(pkgName string, meta *metadata, version string) *remotePackage {
+	scope, name := parseScope(pkgName)
+	pkg := &remotePackage{
 		Scope:   scope,
 		Name:    name,
 		Version: version,
-	}, nil
+		Tarball: in.tarballURL(scope, name, version),
+		layout:  in.moduleDir,
+	}
+	if dist := meta.Versions[version].Dist; dist != nil {
+		if dist.Tarball != "" {
+			pkg.Tarball = dist.Tarball
+		}
+		pkg.Integrity = dist.integrity()
+	}
+	pkg.Deprecated = meta.Versions[version].Deprecated
+	pkg.platform = meta.Versions[version].platform
+	return pkg
 }
 
 type remotePackage struct {
-	Scope   string `json:"scope,omitempty"`
-	Name    string `json:"name,omitempty"`
-	Version string `json:"version,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Tarball   string `json:"tarball,omitempty"`
+	Integrity string `json:"integrity,omitempty"`
+	// Path relative to the root directory to install into. Defaults to
+	// node_modules/<name>.
+	Path       string `json:"path,omitempty"`
+	Deprecated string `json:"deprecated,omitempty"`
+	// Tag is the dist-tag the version was resolved from
+	Tag string `json:"tag,omitempty"`
+	// Alias is the name the package is installed under instead of its own
+	// (e.g. react17 for react17@npm:react@17)
+	Alias string `json:"alias,omitempty"`
+
+	timings  Timings
+	platform platform
+	// layout maps the package's name to its directory within node_modules
+	layout func(name string) string
 }
 
 var _ installable = (*remotePackage)(nil)
 
 func (p *remotePackage) Key() string {
+	if p.Path != "" {
+		return p.Path
+	}
+	return p.dirName()
+}
+
+// name returns the package's name in the registry
+func (p *remotePackage) name() string {
 	if p.Scope == "" {
 		return p.Name
 	}
 	return fmt.Sprintf("%s/%s", p.Scope, p.Name)
 }
 
+// dirName returns the name of the directory the package is installed into
+func (p *remotePackage) dirName() string {
+	if p.Alias != "" {
+		return p.Alias
+	}
+	return p.name()
+}
+
+// moduleDir returns the package's directory within node_modules
+func (p *remotePackage) moduleDir() string {
+	if p.layout == nil {
+		return p.dirName()
+	}
+	return p.layout(p.dirName())
+}
+
 func (p *remotePackage) url() string {
-	if p.Scope == "" {
-		return fmt.Sprintf(`https://registry.npmjs.org/%[1]s/-/%[1]s-%[2]s.tgz`, p.Name, p.Version)
+	return p.Tarball
+}
+
+// relDir returns the package's directory relative to the root
+func (p *remotePackage) relDir() string {
+	if p.Path != "" {
+		return p.Path
 	}
-	return fmt.Sprintf(`https://registry.npmjs.org/%[1]s/%[2]s/-/%[2]s-%[3]s.tgz`, p.Scope, p.Name, p.Version)
+	return path.Join("node_modules", p.moduleDir())
 }
 
 func (p *remotePackage) dir(root string) string {
-	if p.Scope == "" {
-		return filepath.Join(root, "node_modules", p.Name)
+	if p.Path != "" {
+		return filepath.Join(root, filepath.FromSlash(p.Path))
 	}
-	return filepath.Join(root, "node_modules", p.Scope, p.Name)
+	return filepath.Join(root, "node_modules", filepath.FromSlash(p.moduleDir()))
 }
 
-func (p *remotePackage) Install(ctx context.Context, sg *singleflight.Group, to string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url(), nil)
+func (p *remotePackage) Install(ctx context.Context, s *session, depth int, overrides *overrides) error {
+	// Packages for other platforms fail, so they're skipped when optional
+	if err := s.in.checkPlatform(p.name(), p.Version, p.platform); err != nil {
+		return err
+	}
+	to := s.dir
+	if err := s.cleanPackage(p.dir(to)); err != nil {
+		return err
+	}
+	// Extract into a temporary directory and move it into place once it's
+	// complete, so failed or concurrent installs never leave a partial package.
+	start := time.Now()
+	err := replaceDir(s.stagingDir(), p.dir(to), s.in.copier, func(tmpDir string) error {
+		return s.in.fill(ctx, p, tmpDir)
+	})
 	if err != nil {
-		return fmt.Errorf("unable to create request for %s: %w", p.Name, err)
+		return err
 	}
-	res, err := http.DefaultClient.Do(req)
+	// Extracting is everything besides reading the tarball
+	p.timings.Extract = time.Since(start) - p.timings.Download
+	// Install dependencies
+	manifestPath := filepath.Join(p.dir(to), "package.json")
+	manifest, err := os.ReadFile(manifestPath)
 	if err != nil {
-		return fmt.Errorf("unable to download %s: %w", p.Name, err)
+		return fmt.Errorf("unable to read package.json: %w", err)
 	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return fmt.Errorf("unexpected status code while installing %s: %d", p.Name, res.StatusCode)
+	var pkg struct {
+		Dependencies         map[string]string    `json:"dependencies,omitempty"`
+		OptionalDependencies map[string]string    `json:"optionalDependencies,omitempty"`
+		PeerDependencies     map[string]string    `json:"peerDependencies,omitempty"`
+		PeerDependenciesMeta map[string]*PeerMeta `json:"peerDependenciesMeta,omitempty"`
+	}
+	if err := s.in.unmarshalManifest(manifest, &pkg); err != nil {
+		return fmt.Errorf("unable to unmarshal package.json: %w", err)
+	}
+	deps, err := s.in.readDependencies(manifest)
+	if err != nil {
+		return err
+	}
+	s.checkLicense(p.name(), p.Version, manifest)
+	scripts, err := s.in.readScripts(p.dir(to), manifest)
+	if err != nil {
+		return err
+	} else if err := s.approveScripts(p.name(), p.Version, scripts); err != nil {
+		return err
+	}
+	installed := &InstalledPackage{
+		Name:    p.name(),
+		Version: p.Version,
+		Tag:     p.Tag,
+		Dir:     p.dir(to),
+		Timings: p.timings,
+		Scripts: scripts,
+	}
+	s.record(installed)
+	if p.Deprecated != "" {
+		s.advise(&Advisory{
+			Name:       p.name(),
+			Version:    p.Version,
+			Deprecated: p.Deprecated,
+		})
+	}
+	// Never write credentials from the tarball's URL into the lockfile
+	resolved, _ := splitUserinfo(p.url())
+	// Packages installed under another directory name (e.g. aliases) are locked
+	// with their own name
+	lockName := ""
+	if !strings.HasSuffix(p.relDir(), "node_modules/"+p.name()) {
+		lockName = p.name()
+	}
+	s.lock.Add(p.dir(to), &lockPackage{
+		Name:                 lockName,
+		Version:              p.Version,
+		Resolved:             resolved,
+		Integrity:            p.Integrity,
+		Dependencies:         pkg.Dependencies,
+		OptionalDependencies: pkg.OptionalDependencies,
+		PeerDependencies:     pkg.PeerDependencies,
+		PeerDependenciesMeta: pkg.PeerDependenciesMeta,
+	})
+	if err := s.installTransitive(ctx, p.relDir(), deps, depth, overrides); err != nil {
+		return err
+	} else if err := s.installPeers(ctx, p.name(), pkg.PeerDependencies, pkg.PeerDependenciesMeta, depth, overrides); err != nil {
+		return err
+	}
+	s.subtreeInstalled(installed)
+	return nil
+}
+
+// fill the directory with the package's files, within the download timeout
+func (in *Installer) fill(ctx context.Context, p *remotePackage, dir string) error {
+	if in.downloadTimeout <= 0 {
+		return in.fillDir(ctx, p, dir)
+	}
+	downloadCtx, cancel := context.WithTimeout(ctx, in.downloadTimeout)
+	defer cancel()
+	err := in.fillDir(downloadCtx, p, dir)
+	if err != nil && ctx.Err() == nil && errors.Is(downloadCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s downloading %s: %w", in.downloadTimeout, p.Name, err)
+	}
+	return err
+}
+
+// fillDir fills the directory from the store or by downloading the tarball,
+// then strips the source maps
+func (in *Installer) fillDir(ctx context.Context, p *remotePackage, dir string) error {
+	if in.store != "" {
+		if err := in.installFromStore(ctx, p, dir); err != nil {
+			return err
+		}
+	} else if err := in.downloadVerified(ctx, p, dir, in.filter); err != nil {
+		return err
+	}
+	return in.stripSourceMaps(dir)
+}
+
+// download the package's tarball and extract it into dir. If filter isn't nil,
+// only the files it matches are extracted.
+func (in *Installer) download(ctx context.Context, p *remotePackage, dir string, filter func(path string) bool) error {
+	verifier, err := in.newVerifier(p)
+	if err != nil {
+		return err
 	}
-	gzipReader, err := gzip.NewReader(res.Body)
+	start := time.Now()
+	body, err := in.openTarball(ctx, p)
 	if err != nil {
-		return fmt.Errorf("unable to create gzip reader: %w", err)
+		return err
+	}
+	defer body.Close()
+	buffered := bufio.NewReader(body)
+	if err := checkGzip(buffered); err != nil {
+		return fmt.Errorf("unable to extract %s: %w", p.Name, err)
+	}
+	timed := &timedReader{r: buffered, elapsed: time.Since(start)}
+	defer func() { p.timings.Download += timed.elapsed }()
+	var reader io.Reader = timed
+	keeper, err := in.keepTarball(p)
+	if err != nil {
+		return err
+	}
+	defer keeper.Discard()
+	if keeper != nil {
+		reader = io.TeeReader(reader, keeper)
+	}
+	if verifier == nil {
+		if err := in.extractTarball(reader, dir, in.strip, filter); err != nil {
+			return err
+		}
+		return keeper.Keep(reader)
+	}
+	tee := io.TeeReader(reader, verifier)
+	if err := in.extractTarball(tee, dir, in.strip, filter); err != nil {
+		return err
+	}
+	// Hash anything left after the end of the archive
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return fmt.Errorf("unable to read %s: %w", p.Name, err)
+	}
+	if err := verifier.Verify(); err != nil {
+		return fmt.Errorf("unable to verify %s@%s: %w", p.Name, p.Version, err)
+	}
+	return keeper.Keep(reader)
+}
+
+// openTarball opens the package's tarball, reading it through the cache when
+// there is one. Concurrent downloads of the same URL are shared.
+func (in *Installer) openTarball(ctx context.Context, p *remotePackage) (io.ReadCloser, error) {
+	if in.vendor != "" {
+		file, err := os.Open(in.vendorPath(p))
+		if err == nil {
+			return file, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("unable to open vendored tarball for %s: %w", p.Name, err)
+		}
+	}
+	if cachePath, ok := in.tarballCachePath(p); ok {
+		if _, err := in.cacheTarball(ctx, p, cachePath); err != nil {
+			return nil, err
+		}
+		file, err := os.Open(cachePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open cached tarball for %s: %w", p.Name, err)
+		}
+		return file, nil
+	}
+	return in.requestShared(ctx, p)
+}
+
+// snippetSize is how much of an unexpected body is shown in errors
+const snippetSize = 200
+
+// checkGzip checks that the reader starts like a gzipped tarball, so an error
+// page served in place of the tarball gets a clear error
+func checkGzip(r *bufio.Reader) error {
+	magic, err := r.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("unable to read tarball: %w", err)
+	}
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return nil
+	}
+	snippet, _ := r.Peek(snippetSize)
+	if len(snippet) == 0 {
+		return fmt.Errorf("expected a gzipped tarball but got an empty body")
+	}
+	return fmt.Errorf("expected a gzipped tarball but got: %s", bodySnippet(snippet))
+}
+
+// bodySnippet formats the start of a body for an error message
+func bodySnippet(body []byte) string {
+	snippet := strings.Join(strings.Fields(string(body)), " ")
+	if len(body) >= snippetSize {
+		snippet += "..."
+	}
+	return strconv.Quote(snippet)
+}
+
+// extractTarball extracts a gzipped tarball into dir, stripping the leading
+// package/ directory.
+func (in *Installer) extractTarball(r io.Reader, to string, strip int, filter func(path string) bool) error {
+	gzipReader, err := in.gunzip(r)
+	if err != nil {
+		return err
 	}
 	defer gzipReader.Close()
 	tarReader := tar.NewReader(gzipReader)
@@ -189,9 +761,36 @@ func (p *remotePackage) Install(ctx context.Context, sg *singleflight.Group, to
 		} else if err != nil {
 			return fmt.Errorf("unable to get next header: %w", err)
 		}
+		// Use the full header name rather than FileInfo().Name(), since the name
+		// may come from a PAX or GNU long name record and directory entries end in
+		// a trailing slash.
 		fileInfo := header.FileInfo()
-		dir := filepath.Join(p.dir(to), rootless(filepath.Dir(header.Name)))
-		filename := filepath.Join(dir, fileInfo.Name())
+		// Refuse entries that would be written outside of the package
+		if path.IsAbs(header.Name) || filepath.IsAbs(header.Name) || strings.HasPrefix(header.Name, `\`) {
+			return fmt.Errorf("refusing to extract %q from tarball because it's an absolute path", header.Name)
+		}
+		name := path.Clean(header.Name)
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("refusing to extract %q from tarball because it's outside of the package", header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeDir:
+		default:
+			// Skip links like npm does, along with devices, FIFOs and any other
+			// special files
+			continue
+		}
+		rel, ok := stripComponents(name, strip)
+		if !ok || (rel == "" && !fileInfo.IsDir()) {
+			continue
+		} else if filter != nil && fileInfo.IsDir() {
+			// Directories are made as needed for the files that pass the filter
+			continue
+		} else if !keepFile(rel, filter) {
+			continue
+		}
+		filename := filepath.Join(to, filepath.FromSlash(rel))
+		dir := filepath.Dir(filename)
 		if fileInfo.IsDir() {
 			if err := os.MkdirAll(filename, fileInfo.Mode()); err != nil {
 				return fmt.Errorf("unable to make directory %q from tarball: %w", filename, err)
@@ -205,7 +804,7 @@ func (p *remotePackage) Install(ctx context.Context, sg *singleflight.Group, to
 		if err != nil {
 			return fmt.Errorf("unable to open file %q from tarball: %w", filename, err)
 		}
-		if written, err := io.Copy(file, tarReader); err != nil {
+		if written, err := in.copier.Copy(file, tarReader); err != nil {
 			return fmt.Errorf("unable to copy file %q from tarball: %w", filename, err)
 		} else if written != header.Size {
 			return fmt.Errorf("unable to copy file %q from tarball: wrote %d bytes, expected %d", filename, written, header.Size)
@@ -214,107 +813,446 @@ func (p *remotePackage) Install(ctx context.Context, sg *singleflight.Group, to
 			return fmt.Errorf("unable to close file %q from tarball: %w", filename, err)
 		}
 	}
-	// Install dependencies
-	manifestPath := filepath.Join(p.dir(to), "package.json")
-	manifest, err := os.ReadFile(manifestPath)
-	if err != nil {
-		return fmt.Errorf("unable to read package.json: %w", err)
+	return nil
+}
+
+// metadata is the registry document describing every published version of a
+// package.
+type metadata struct {
+	Name     string                      `json:"name,omitempty"`
+	DistTags map[string]string           `json:"dist-tags,omitempty"`
+	Versions map[string]*versionMetadata `json:"versions,omitempty"`
+	// Time maps versions to when they were published
+	Time publishTimes `json:"time,omitempty"`
+	// size of the document in bytes
+	size int64
+	// coerced maps coerced versions to the versions they were coerced from
+	coerced map[string]string
+}
+
+type versionMetadata struct {
+	Deprecated   string            `json:"deprecated,omitempty"`
+	Dist         *dist             `json:"dist,omitempty"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	platform
+	// manifest is the version's package.json as published
+	manifest json.RawMessage
+}
+
+// UnmarshalJSON keeps the version's package.json, so its dependencies can be
+// read like an installed package's
+func (v *versionMetadata) UnmarshalJSON(data []byte) error {
+	type fields versionMetadata
+	if err := json.Unmarshal(data, (*fields)(v)); err != nil {
+		return err
 	}
-	var pkg struct {
-		Dependencies map[string]string `json:"dependencies,omitempty"`
+	v.manifest = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+type dist struct {
+	Tarball      string `json:"tarball,omitempty"`
+	Integrity    string `json:"integrity,omitempty"`
+	Shasum       string `json:"shasum,omitempty"`
+	UnpackedSize int64  `json:"unpackedSize,omitempty"`
+}
+
+// integrity returns the subresource integrity string for the tarball. Older
+// packages only have a hex-encoded sha1 shasum, so we convert that over.
+func (d *dist) integrity() string {
+	if d == nil {
+		return ""
+	} else if d.Integrity != "" {
+		return d.Integrity
 	}
-	if err := json.Unmarshal(manifest, &pkg); err != nil {
-		return fmt.Errorf("unable to unmarshal package.json: %w", err)
+	sum, err := hex.DecodeString(d.Shasum)
+	if err != nil || len(sum) == 0 {
+		return ""
 	}
-	eg := new(errgroup.Group)
-	for dep, version := range pkg.Dependencies {
-		pkgname := fmt.Sprintf("%s@%s", dep, version)
-		eg.Go(func() error {
-			return install(ctx, sg, to, pkgname)
-		})
+	return "sha1-" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// fetchMetadata fetches the registry document for a package. Concurrent
+// fetches for the same package are shared. The shared fetch respects the first
+// caller's context, but is also bounded by the metadata timeout so one stuck
+// request doesn't stall everyone waiting on it.
+func (in *Installer) fetchMetadata(ctx context.Context, pkgName string) (*metadata, error) {
+	ch := in.metadata.DoChan(pkgName, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(ctx, in.metadataTimeout)
+		defer cancel()
+		meta, err := in.requestMetadata(fetchCtx, pkgName)
+		if err != nil {
+			// Forget the failed fetch, so a retry will fetch again
+			in.metadata.Forget(pkgName)
+			if ctx.Err() == nil && errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("timed out after %s fetching metadata for %s", in.metadataTimeout, pkgName)
+			}
+			return nil, err
+		}
+		if err := in.prepareMetadata(meta); err != nil {
+			return nil, err
+		}
+		return meta, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("unable to fetch metadata for %s: %w", pkgName, ctx.Err())
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*metadata), nil
 	}
-	return eg.Wait()
 }
 
-func resolveVersions(pkgName string) (semver.Collection, error) {
-	req, err := http.NewRequest(http.MethodGet, `https://registry.npmjs.org/`+pkgName, nil)
+// prepareMetadata checks and coerces the versions of fetched metadata
+func (in *Installer) prepareMetadata(meta *metadata) error {
+	if err := in.checkVersions(meta); err != nil {
+		return err
+	}
+	if in.coerceVersions {
+		meta.coerce()
+	}
+	return nil
+}
+
+// requestMetadata requests the package's metadata from its registry, falling
+// back to the mirrors, then the cache when they can't be reached.
+func (in *Installer) requestMetadata(ctx context.Context, pkgName string) (*metadata, error) {
+	scope, _ := parseScope(pkgName)
+	var err error
+	for _, registry := range in.registriesFor(scope) {
+		var meta *metadata
+		var unavailable bool
+		meta, unavailable, err = in.requestMetadataFrom(ctx, registry, pkgName)
+		if !unavailable {
+			return meta, err
+		}
+	}
+	// Fall back to the cached metadata when the registry is unreachable
+	if meta, cacheErr := in.readCachedMetadata(pkgName); cacheErr == nil {
+		return meta, nil
+	}
+	return nil, err
+}
+
+// requestMetadataFrom requests the package's metadata from the registry. It
+// returns unavailable when the registry can't be reached or has a server
+// error, so another registry can be tried.
+func (in *Installer) requestMetadataFrom(ctx context.Context, registry, pkgName string) (meta *metadata, unavailable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, registry+"/"+pkgName, nil)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create request to resolve version for %s: %w", pkgName, err)
+		return nil, false, fmt.Errorf("unable to create request to resolve version for %s: %w", pkgName, err)
+	} else if err := in.checkTransport(req.URL); err != nil {
+		return nil, false, err
+	}
+	authorize(req, in.tokenFor(req.URL))
+	// Only download the metadata again if it changed since it was cached
+	if etag := in.readCachedETag(pkgName); etag != "" {
+		req.Header.Set("If-None-Match", etag)
 	}
-	res, err := http.DefaultClient.Do(req)
+	release, err := in.acquire(ctx, req.URL.Host)
 	if err != nil {
-		return nil, fmt.Errorf("unable to preform request to resolve version for %s: %w", pkgName, err)
+		return nil, false, fmt.Errorf("unable to resolve version for %s: %w", pkgName, err)
+	}
+	defer release()
+	res, err := in.client.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, fmt.Errorf("unable to preform request to resolve version for %s: %w", pkgName, err)
 	}
 	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("unexpected status code while resolving version for %s: %d", pkgName, res.StatusCode)
+	if res.StatusCode == http.StatusNotModified {
+		meta, err := in.readCachedMetadata(pkgName)
+		return meta, false, err
 	}
-	var pkg struct {
-		Versions map[string]struct{} `json:"versions,omitempty"`
+	if res.StatusCode != 200 {
+		return nil, res.StatusCode >= 500, fmt.Errorf("unexpected status code while resolving version for %s: %d", pkgName, res.StatusCode)
 	}
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read body while resolving version for %s: %w", pkgName, err)
+		return nil, ctx.Err() == nil, fmt.Errorf("unable to read body while resolving version for %s: %w", pkgName, err)
+	}
+	meta, err = parseMetadata(pkgName, body)
+	if err != nil {
+		return nil, false, err
 	}
-	if err := json.Unmarshal(body, &pkg); err != nil {
+	if err := in.cacheMetadata(pkgName, body, res.Header.Get("ETag")); err != nil {
+		return nil, false, err
+	}
+	return meta, false, nil
+}
+
+func parseMetadata(pkgName string, body []byte) (*metadata, error) {
+	meta := new(metadata)
+	if err := json.Unmarshal(body, meta); err != nil {
 		return nil, fmt.Errorf("unable to unmarshal body while resolving version for %s: %w", pkgName, err)
 	}
-	var versions semver.Collection
-	for version := range pkg.Versions {
+	if meta.Name == "" {
+		meta.Name = pkgName
+	}
+	meta.size = int64(len(body))
+	return meta, nil
+}
+
+// versions returns the sorted collection of valid semantic versions
+func (m *metadata) versions() semver.Collection {
+	versions := make([]string, 0, len(m.Versions))
+	for version := range m.Versions {
+		versions = append(versions, version)
+	}
+	return parseVersions(versions)
+}
+
+// parseVersions returns the sorted collection of valid semantic versions
+func parseVersions(versions []string) semver.Collection {
+	var collection semver.Collection
+	for _, version := range versions {
 		v, err := semver.NewVersion(version)
 		if err != nil {
 			// Ignore errors that might be in the NPM registry.
 			continue
 		}
-		versions = append(versions, v)
+		collection = append(collection, v)
 	}
-	sort.Sort(versions)
-	return versions, nil
+	sort.Sort(collection)
+	return collection
+}
+
+// Resolve the version a dist-tag (e.g. latest) points to, or the highest version
+// that matches the constraint
+func (m *metadata) Resolve(constraint string) (string, error) {
+	if len(m.Versions) == 0 {
+		return "", m.errNoVersions(constraint)
+	}
+	if version, ok := m.DistTags[constraint]; ok {
+		if _, ok := m.Versions[version]; !ok {
+			return "", fmt.Errorf("unable to resolve version for %s@%s because the tag points to %s, which isn't published", m.Name, constraint, version)
+		}
+		return version, nil
+	}
+	versions := make([]string, 0, len(m.Versions))
+	for version := range m.Versions {
+		versions = append(versions, version)
+	}
+	version, err := match(versions, constraint)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve version for %s@%s: %w", m.Name, constraint, err)
+	}
+	return m.original(version), nil
 }
 
-func resolveVersion(pkgName, constraint string) (string, error) {
-	versions, err := resolveVersions(pkgName)
+// Match returns the highest of the versions that matches the constraint (e.g.
+// ^1.2.0 or ~1.2.0), like resolving a version from the registry but without
+// the network. Versions that aren't valid semantic versions are ignored.
+func Match(versions []string, constraint string) (string, error) {
+	version, err := match(versions, constraint)
 	if err != nil {
-		return "", fmt.Errorf("unable to resolve versions for %s: %w", pkgName, err)
+		return "", fmt.Errorf("npm: unable to match %s: %w", constraint, err)
+	}
+	return version, nil
+}
+
+// match returns the highest version that matches the constraint
+func match(versions []string, constraint string) (string, error) {
+	// Build metadata is ignored when comparing versions, so constraints that pin
+	// a version with build metadata (e.g. 1.0.0+build.5) are matched exactly
+	if exact := strings.TrimPrefix(strings.TrimSpace(constraint), "="); strings.Contains(exact, "+") {
+		for _, version := range versions {
+			if version == exact {
+				return exact, nil
+			}
+		}
 	}
 	checker, err := semver.NewConstraint(constraint)
 	if err != nil {
-		return "", fmt.Errorf("unable to create a new constraint for %s@%s: %w", pkgName, constraint, err)
+		return "", fmt.Errorf("unable to create a new constraint: %w", err)
 	}
-	for i := len(versions) - 1; i >= 0; i-- {
-		if checker.Check(versions[i]) {
-			return versions[i].String(), nil
+	collection := parseVersions(versions)
+	for i := len(collection) - 1; i >= 0; i-- {
+		if checker.Check(collection[i]) {
+			return collection[i].Original(), nil
 		}
 	}
-	return "", fmt.Errorf("unable to resolve version for %s@%s: no matching version found", pkgName, constraint)
+	return "", fmt.Errorf("no matching version found")
 }
 
-func readLocalPackage(pkgdir string) (*localPackage, error) {
+// ResolvePatched resolves the lowest version that matches the constraint and
+// is at or above minVersion
+func (m *metadata) ResolvePatched(constraint, minVersion string) (string, error) {
+	if len(m.Versions) == 0 {
+		return "", m.errNoVersions(constraint)
+	}
+	minimum, err := semver.NewVersion(minVersion)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse the minimum version %s: %w", minVersion, err)
+	}
+	checker, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("unable to create a new constraint for %s@%s: %w", m.Name, constraint, err)
+	}
+	for _, version := range m.versions() {
+		if !version.LessThan(minimum) && checker.Check(version) {
+			return m.original(version.Original()), nil
+		}
+	}
+	return "", fmt.Errorf("unable to resolve version for %s@%s: no matching version at or above %s", m.Name, constraint, minVersion)
+}
+
+// resolve the version of a package from its metadata, logging what the range
+// resolved to
+func (in *Installer) resolve(meta *metadata, constraint string) (string, error) {
+	version, err := in.pickVersion(meta, constraint)
+	if err != nil {
+		return "", err
+	}
+	in.log.Info(fmt.Sprintf("npm: resolved %s %s -> %s", meta.Name, constraint, version), "package", meta.Name, "range", constraint, "version", version)
+	return version, nil
+}
+
+func (in *Installer) resolveVersion(ctx context.Context, pkgName, constraint string) (string, error) {
+	meta, err := in.metadataFor(ctx, pkgName, constraint)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve versions for %s: %w", pkgName, err)
+	}
+	return in.resolve(meta, constraint)
+}
+
+func (in *Installer) readLocalPackage(pkgdir string) (*localPackage, error) {
 	manifestPath := filepath.Join(pkgdir, "package.json")
 	manifest, err := os.ReadFile(manifestPath)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read package.json: %w", err)
 	}
 	var pkg struct {
-		Name string `json:"name,omitempty"`
+		Name    string `json:"name,omitempty"`
+		Version string `json:"version,omitempty"`
 	}
-	if err := json.Unmarshal(manifest, &pkg); err != nil {
+	if err := in.unmarshalManifest(manifest, &pkg); err != nil {
 		return nil, fmt.Errorf("unable to unmarshal package.json: %w", err)
 	}
 	return &localPackage{
-		Name: pkg.Name,
-		Path: pkgdir,
+		Name:    pkg.Name,
+		Version: pkg.Version,
+		Path:    pkgdir,
 	}, nil
 }
 
+// resolveLocalGlob expands a glob like ./packages/* into the local packages it
+// matches. Directories without a package.json are skipped.
+func (s *session) resolveLocalGlob(pattern string) (*localGlob, error) {
+	root := "/"
+	if isLocal(pattern) {
+		root = s.dir
+	}
+	rel, err := filepath.Rel(root, filepath.Join(root, pattern))
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to match %s: %w", pattern, err)
+	}
+	matcher, err := glob.Compile(rel)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to compile glob %s: %w", pattern, err)
+	}
+	group := &localGlob{Pattern: pattern}
+	base := filepath.Join(root, glob.Base(rel))
+	err = filepath.WalkDir(base, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if path == base && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		} else if !de.IsDir() {
+			return nil
+		} else if path != base && (hiddenPath(de.Name()) || de.Name() == "node_modules") {
+			return fs.SkipDir
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if !matcher.Match(rel) {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, "package.json")); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		// Broken packages are reported after the others are installed
+		pkg, err := s.in.readLocalPackage(path)
+		if err != nil {
+			group.Broken = append(group.Broken, fmt.Errorf("unable to read %s: %w", path, err))
+			return nil
+		} else if pkg.Name == "" {
+			group.Broken = append(group.Broken, fmt.Errorf("unable to install %s: package.json is missing a name", path))
+			return nil
+		}
+		group.Packages = append(group.Packages, pkg)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to match %s: %w", pattern, err)
+	} else if len(group.Packages) == 0 && len(group.Broken) == 0 {
+		return nil, fmt.Errorf("npm: no local packages match %s", pattern)
+	}
+	return group, nil
+}
+
+// localGlob is a set of local packages matched by a glob
+type localGlob struct {
+	Pattern  string
+	Packages []*localPackage
+	// Broken are the errors of matching packages that can't be read
+	Broken []error `json:"-"`
+}
+
+var _ installable = (*localGlob)(nil)
+
+func (g *localGlob) Key() string {
+	return g.Pattern
+}
+
+// Install every matching package. One broken package doesn't stop the others
+// from installing, instead the errors are reported together.
+func (g *localGlob) Install(ctx context.Context, s *session, depth int, overrides *overrides) error {
+	var mu sync.Mutex
+	errs := append([]error(nil), g.Broken...)
+	eg := new(errgroup.Group)
+	for _, pkg := range g.Packages {
+		eg.Go(func() error {
+			if err := s.installPackage(ctx, pkg.Path, pkg, depth, overrides.enterPackage(pkg)); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+	if len(errs) > 0 {
+		return fmt.Errorf("npm: unable to install %d of the packages matching %s:\n%w", len(errs), g.Pattern, errors.Join(errs...))
+	}
+	return nil
+}
+
 type localPackage struct {
 	Name string `json:"name,omitempty"`
-	Path string `json:"path,omitempty"`
+	// Version is the version in the local package.json, if it has one
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path,omitempty"`
+	// Dest is the path relative to the root directory to install into. Defaults
+	// to node_modules/<name>.
+	Dest string `json:"dest,omitempty"`
 }
 
 var _ installable = (*localPackage)(nil)
 
+// Key is the package's name like remote packages, so a local package and a
+// remote dependency with the same name are only installed once
 func (p *localPackage) Key() string {
+	if p.Dest != "" {
+		return p.Dest
+	}
 	return p.Name
 }
 
@@ -333,7 +1271,8 @@ var ignorePaths = map[string]bool{
 // Install local package to the given directory. This is a very limited
 // implementation.
 // TODO: better align with: https://github.com/npm/npm-packlist
-func (p *localPackage) Install(ctx context.Context, sg *singleflight.Group, to string) error {
+func (p *localPackage) Install(ctx context.Context, s *session, depth int, overrides *overrides) error {
+	to := s.dir
 	pkgPath := p.Path
 	if filepath.IsLocal(pkgPath) {
 		pkgPath = filepath.Join(to, p.Path)
@@ -344,17 +1283,29 @@ func (p *localPackage) Install(ctx context.Context, sg *singleflight.Group, to s
 		return fmt.Errorf("unable to read %s for %s: %w", manifestName, p.Path, err)
 	}
 	var manifest Manifest
-	if err := json.Unmarshal(manifestJson, &manifest); err != nil {
+	if err := s.in.unmarshalManifest(manifestJson, &manifest); err != nil {
 		return fmt.Errorf("unable to unmarshal %s for %s: %w", manifestName, p.Path, err)
 	}
+	deps, err := s.in.readDependencies(manifestJson)
+	if err != nil {
+		return fmt.Errorf("unable to read dependencies for %s: %w", p.Path, err)
+	}
+	s.checkLicense(manifest.Name, manifest.Version, manifestJson)
 	fileMap := map[string]bool{
 		manifestName: true,
 	}
 	if manifest.Main != "" {
 		fileMap[filepath.Clean(manifest.Main)] = true
 	}
-	if manifest.Browser != "" {
-		fileMap[filepath.Clean(manifest.Browser)] = true
+	for _, p := range manifest.Browser.paths() {
+		fileMap[filepath.Clean(p)] = true
+	}
+	// Type definitions are often left out of "files"
+	if manifest.Types != "" {
+		fileMap[filepath.Clean(manifest.Types)] = true
+	}
+	if manifest.Typings != "" {
+		fileMap[filepath.Clean(manifest.Typings)] = true
 	}
 	for _, file := range manifest.Files {
 		err := glob.Walk(filepath.Join(pkgPath, file+"**"), func(path string, de fs.DirEntry, err error) error {
@@ -382,12 +1333,23 @@ func (p *localPackage) Install(ctx context.Context, sg *singleflight.Group, to s
 		}
 	}
 	for _, imp := range manifest.Imports {
-		for _, p := range imp {
+		for _, p := range imp.Paths() {
+			// Imports can also map to packages and patterns need to be included
+			// through "files"
+			if !strings.HasPrefix(p, "./") || strings.Contains(p, "*") {
+				continue
+			}
 			fileMap[filepath.Clean(p)] = true
 		}
 	}
-	for _, p := range manifest.Exports {
-		fileMap[filepath.Clean(p)] = true
+	for _, export := range manifest.Exports {
+		for _, p := range export.Paths() {
+			// Patterns need to be included through "files"
+			if strings.Contains(p, "*") {
+				continue
+			}
+			fileMap[filepath.Clean(p)] = true
+		}
 	}
 	files := make([]string, len(fileMap))
 	i := 0
@@ -395,32 +1357,239 @@ func (p *localPackage) Install(ctx context.Context, sg *singleflight.Group, to s
 		files[i] = file
 		i++
 	}
-	nodeDir := filepath.Join(to, "node_modules", manifest.Name)
-	if err := copyFiles(pkgPath, nodeDir, files...); err != nil {
+	relDir := path.Join("node_modules", s.in.moduleDir(manifest.Name))
+	if p.Dest != "" {
+		relDir = p.Dest
+	}
+	nodeDir := filepath.Join(to, filepath.FromSlash(relDir))
+	if err := s.cleanPackage(nodeDir); err != nil {
+		return err
+	}
+	if err := copyFiles(pkgPath, nodeDir, s.in.copier, !s.in.forceCopy, files...); err != nil {
 		return fmt.Errorf("unable to copy files to install local package: %w", err)
 	}
-	eg := new(errgroup.Group)
-	for dep, version := range manifest.Dependencies {
-		pkgname := fmt.Sprintf("%s@%s", dep, version)
-		eg.Go(func() error {
-			return install(ctx, sg, to, pkgname)
-		})
+	scripts, err := s.in.readScripts(pkgPath, manifestJson)
+	if err != nil {
+		return err
+	} else if err := s.approveScripts(manifest.Name, manifest.Version, scripts); err != nil {
+		return err
+	}
+	installed := &InstalledPackage{
+		Name:    manifest.Name,
+		Version: manifest.Version,
+		Dir:     nodeDir,
+		Scripts: scripts,
+	}
+	s.record(installed)
+	resolved := pkgPath
+	if rel, err := filepath.Rel(to, pkgPath); err == nil {
+		resolved = rel
+	}
+	s.lock.Add(nodeDir, &lockPackage{
+		Version:              manifest.Version,
+		Resolved:             "file:" + filepath.ToSlash(resolved),
+		Dependencies:         manifest.Dependencies,
+		OptionalDependencies: manifest.OptionalDependencies,
+		PeerDependencies:     manifest.PeerDependencies,
+		PeerDependenciesMeta: manifest.PeerDependenciesMeta,
+	})
+	if err := s.installTransitive(ctx, relDir, deps, depth, overrides); err != nil {
+		return err
+	} else if err := s.installPeers(ctx, manifest.Name, manifest.PeerDependencies, manifest.PeerDependenciesMeta, depth, overrides); err != nil {
+		return err
+	}
+	s.subtreeInstalled(installed)
+	return nil
+}
+
+// replaceDir fills a temporary directory in the staging directory, then
+// atomically renames it over dir. Nested node_modules in the existing
+// directory are kept. When the staging directory is on another device, the
+// files are copied next to dir first.
+func replaceDir(stagingDir, dir string, c *copier, fill func(tmpDir string) error) error {
+	parent, base := filepath.Split(dir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("unable to make directory %s: %w", parent, err)
+	}
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return fmt.Errorf("unable to make staging directory %s: %w", stagingDir, err)
+	}
+	tmpDir, err := os.MkdirTemp(stagingDir, base+"-")
+	if err != nil {
+		return fmt.Errorf("unable to make temporary directory for %s: %w", dir, err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := fill(tmpDir); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return fmt.Errorf("unable to change the mode of %s: %w", tmpDir, err)
+	}
+	// Directories can't be renamed across devices, so copy the files onto the
+	// same device as dir, then rename from there
+	copied := false
+	copyNearby := func() error {
+		nearDir, err := os.MkdirTemp(parent, "."+base+"-")
+		if err != nil {
+			return fmt.Errorf("unable to make temporary directory for %s: %w", dir, err)
+		}
+		if err := copyDir(tmpDir, nearDir, c); err != nil {
+			os.RemoveAll(nearDir)
+			return fmt.Errorf("unable to copy %s across devices: %w", dir, err)
+		}
+		tmpDir, copied = nearDir, true
+		return nil
+	}
+	defer func() {
+		if copied {
+			os.RemoveAll(tmpDir)
+		}
+	}()
+	nodeModules := filepath.Join(dir, "node_modules")
+	if _, err := os.Stat(nodeModules); err == nil {
+		err := renameDir(nodeModules, filepath.Join(tmpDir, "node_modules"))
+		if isCrossDevice(err) {
+			if err := copyNearby(); err != nil {
+				return err
+			}
+			err = renameDir(nodeModules, filepath.Join(tmpDir, "node_modules"))
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to keep %s: %w", nodeModules, err)
+		}
+	}
+	// Retry a few times in case a concurrent install moves a directory in at the
+	// same time.
+	for attempt := 0; ; attempt++ {
+		err := renameDir(tmpDir, dir)
+		if err == nil {
+			return nil
+		} else if isCrossDevice(err) && !copied {
+			if err := copyNearby(); err != nil {
+				return err
+			}
+			continue
+		} else if attempt == 3 {
+			return fmt.Errorf("unable to move %s into place: %w", dir, err)
+		}
+		// Move the existing directory out of the way
+		oldDir, err := os.MkdirTemp(filepath.Dir(tmpDir), base+"-old-")
+		if err != nil {
+			return fmt.Errorf("unable to make temporary directory for %s: %w", dir, err)
+		}
+		defer os.RemoveAll(oldDir)
+		if err := renameDir(dir, filepath.Join(oldDir, base)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to move %s out of the way: %w", dir, err)
+		}
 	}
-	return eg.Wait()
 }
 
-func copyFiles(from, to string, files ...string) error {
+// copyDir copies the files, directories and symlinks within from into to
+func copyDir(from, to string, c *copier) error {
+	return filepath.WalkDir(from, func(fpath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, fpath)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		switch {
+		case de.IsDir():
+			return os.MkdirAll(target, 0755)
+		case de.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(fpath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			info, err := de.Info()
+			if err != nil {
+				return err
+			}
+			if err := copyFile(fpath, target, c); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		}
+	})
+}
+
+// copyFiles copies the files of a local package. Symlinks are never followed.
+// Links that point within the package are recreated as relative links, while
+// links that point outside of it, or files reached through them, are skipped,
+// so a package can't pull in files from elsewhere or loop back on itself.
+// When skipUnchanged is true, files that are already copied are skipped.
+func copyFiles(from, to string, c *copier, skipUnchanged bool, files ...string) error {
+	root, err := filepath.EvalSymlinks(from)
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s to copy: %w", from, err)
+	}
 	eg := new(errgroup.Group)
 	for _, file := range files {
 		file := file
 		eg.Go(func() error {
-			return copyFile(filepath.Join(from, file), filepath.Join(to, file))
+			return copyPackageFile(root, from, to, file, c, skipUnchanged)
 		})
 	}
 	return eg.Wait()
 }
 
-func copyFile(src, dst string) error {
+// copyPackageFile copies a file within the package at root, following the
+// symlink policy of copyFiles
+func copyPackageFile(root, from, to, file string, c *copier, skipUnchanged bool) error {
+	src, dst := filepath.Join(from, file), filepath.Join(to, file)
+	// Skip files reached through a directory link that leads out of the package
+	realDir, err := filepath.EvalSymlinks(filepath.Dir(src))
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s to copy: %w", src, err)
+	}
+	if rel, err := filepath.Rel(root, realDir); err != nil || !filepath.IsLocal(rel) {
+		return nil
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("unable to stat %s to copy: %w", src, err)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		if skipUnchanged && unchanged(src, dst, info) {
+			return nil
+		} else if err := copyFile(src, dst, c); err != nil {
+			return err
+		}
+		// Keep the modification time, so unchanged files are quick to detect
+		if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("unable to set the modification time of %s: %w", dst, err)
+		}
+		return nil
+	}
+	link, err := os.Readlink(src)
+	if err != nil {
+		return fmt.Errorf("unable to read link %s to copy: %w", src, err)
+	}
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(realDir, link)
+	}
+	target, err := filepath.Rel(root, link)
+	if err != nil || !filepath.IsLocal(target) {
+		return nil
+	}
+	relLink, err := filepath.Rel(filepath.Dir(filepath.Clean(file)), target)
+	if err != nil {
+		return fmt.Errorf("unable to relink %s: %w", src, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("unable to make directory for %s to copy: %w", dst, err)
+	}
+	if err := os.Symlink(relLink, dst); err != nil {
+		return fmt.Errorf("unable to copy link %s: %w", src, err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string, c *copier) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("unable to open %s to copy: %w", src, err)
@@ -434,15 +1603,30 @@ func copyFile(src, dst string) error {
 		return fmt.Errorf("unable to create %s to copy: %w", dst, err)
 	}
 	defer dstFile.Close()
-	if _, err = io.Copy(dstFile, srcFile); err != nil {
+	if _, err = c.Copy(dstFile, srcFile); err != nil {
 		return fmt.Errorf("unable to copy %s to %s: %w", src, dst, err)
 	}
 	return nil
 }
 
-func rootless(fpath string) string {
-	parts := strings.Split(fpath, string(filepath.Separator))
-	return path.Join(parts[1:]...)
+// keepFile returns true if the file at the slash-separated path within the
+// package passes the filter. The package.json is always kept since it's needed
+// to install dependencies.
+func keepFile(rel string, filter func(path string) bool) bool {
+	return filter == nil || rel == "" || rel == "package.json" || filter(rel)
+}
+
+// stripComponents strips the leading directories from a slash-separated
+// tarball path. Paths with fewer directories are skipped like in tar.
+func stripComponents(fpath string, strip int) (string, bool) {
+	if fpath == "." {
+		return "", strip == 0
+	}
+	parts := strings.Split(fpath, "/")
+	if len(parts) < strip {
+		return "", false
+	}
+	return path.Join(parts[strip:]...), true
 }
 
 func isLocal(pkgname string) bool {
@@ -453,6 +1637,10 @@ func isAbsolute(pkgname string) bool {
 	return strings.HasPrefix(pkgname, "/")
 }
 
+func isGlob(pkgname string) bool {
+	return strings.ContainsAny(pkgname, "*?[{")
+}
+
 func hiddenPath(p string) bool {
 	return strings.HasPrefix(p, ".")
 }
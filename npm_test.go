@@ -1,14 +1,29 @@
 package npm_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/livebud/npm"
 	"github.com/matryer/is"
+	"golang.org/x/sync/errgroup"
 )
 
 func exists(t testing.TB, path string) {
@@ -122,6 +137,76 @@ func TestLocal(t *testing.T) {
 	exists(t, filepath.Join(dir, "node_modules", "uid", "package.json"))
 }
 
+func TestLocalTypes(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	pkgDir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{
+			"name": "typed",
+			"main": "./index.js",
+			"types": "./index.d.ts",
+			"files": ["lib/"]
+		}`,
+		"index.js":      `export const typed = "typed"`,
+		"index.d.ts":    `export declare const typed: string`,
+		"lib/util.js":   `export const util = "util"`,
+		"lib/util.d.ts": `export declare const util: string`,
+		"notes.d.ts":    `export {}`,
+	}
+	is.NoErr(writeFiles(pkgDir, files))
+	is.NoErr(npm.Install(context.Background(), dir, pkgDir))
+	equals(t, filepath.Join(dir, "node_modules", "typed", "index.d.ts"), files["index.d.ts"])
+	equals(t, filepath.Join(dir, "node_modules", "typed", "lib", "util.d.ts"), files["lib/util.d.ts"])
+	notExists(t, filepath.Join(dir, "node_modules", "typed", "notes.d.ts"))
+}
+
+func TestLocalSymlinks(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	root := t.TempDir()
+	pkgDir := filepath.Join(root, "bud")
+	files := map[string]string{
+		"bud/package.json": `{
+			"name": "bud",
+			"main": "./linked/main.js",
+			"files": ["src/"]
+		}`,
+		"bud/src/index.js":   `export const bud = "bud"`,
+		"bud/lib/main.js":    `export const main = "main"`,
+		"outside/secret.js":  `export const secret = "secret"`,
+		"outside/nested.js":  `export const nested = "nested"`,
+		"outside/index.html": `<h1>outside</h1>`,
+	}
+	is.NoErr(writeFiles(root, files))
+	// A file link within the package
+	is.NoErr(os.Symlink("index.js", filepath.Join(pkgDir, "src", "alias.js")))
+	// A file link outside of the package
+	is.NoErr(os.Symlink("../../outside/secret.js", filepath.Join(pkgDir, "src", "secret.js")))
+	// A directory link back up to the package
+	is.NoErr(os.Symlink("..", filepath.Join(pkgDir, "src", "loop")))
+	// A directory link outside of the package
+	is.NoErr(os.Symlink("../../outside", filepath.Join(pkgDir, "src", "outside")))
+	// The entry point is reached through a directory link within the package
+	is.NoErr(os.Symlink("lib", filepath.Join(pkgDir, "linked")))
+	ctx := context.Background()
+	is.NoErr(npm.Install(ctx, dir, pkgDir))
+	budDir := filepath.Join(dir, "node_modules", "bud")
+	equals(t, filepath.Join(budDir, "src", "index.js"), files["bud/src/index.js"])
+	// Links within the package are copied as links
+	link, err := os.Readlink(filepath.Join(budDir, "src", "alias.js"))
+	is.NoErr(err)
+	is.Equal(link, "index.js")
+	equals(t, filepath.Join(budDir, "src", "alias.js"), files["bud/src/index.js"])
+	link, err = os.Readlink(filepath.Join(budDir, "src", "loop"))
+	is.NoErr(err)
+	is.Equal(link, "..")
+	equals(t, filepath.Join(budDir, "linked", "main.js"), files["bud/lib/main.js"])
+	// Links outside of the package are skipped
+	notExists(t, filepath.Join(budDir, "src", "secret.js"))
+	notExists(t, filepath.Join(budDir, "src", "outside"))
+}
+
 func TestDepOfDep(t *testing.T) {
 	is := is.New(t)
 	dir := t.TempDir()
@@ -299,3 +384,934 @@ func TestVersion(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(version, "0.0.1")
 }
+
+func TestVersionBuildMetadata(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0+build.5": {},
+		"uid@1.0.0+build.6": {},
+		"uid@1.0.0+build.7": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	version, err := installer.Version(ctx, "uid", "1.0.0+build.6")
+	is.NoErr(err)
+	is.Equal(version, "1.0.0+build.6")
+	version, err = installer.Version(ctx, "uid", "=1.0.0+build.5")
+	is.NoErr(err)
+	is.Equal(version, "1.0.0+build.5")
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@1.0.0+build.5"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"1.0.0+build.5"}`)
+}
+
+func TestResolveVersions(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0":          {},
+		"uid@2.0.2":          {},
+		"uid@3.0.0":          {},
+		"@lukeed/uuid@2.0.1": {},
+	})
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	versions, err := npm.New(npm.WithRegistry(server.URL)).ResolveVersions(ctx, map[string]string{
+		"uid":          "^2",
+		"@lukeed/uuid": "*",
+	})
+	is.NoErr(err)
+	is.Equal(versions, map[string]string{"uid": "2.0.2", "@lukeed/uuid": "2.0.1"})
+	is.Equal(requests.Load(), int32(2))
+	_, err = npm.New(npm.WithRegistry(server.URL)).ResolveVersions(ctx, map[string]string{
+		"uid": "^4",
+	})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "no matching version"))
+}
+
+func TestResolvePatched(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+		"uid@2.0.2": {},
+		"uid@2.1.0": {},
+		"uid@2.2.0": {},
+		"uid@3.0.0": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	version, err := installer.ResolvePatched(ctx, "uid", "^2.0.0", "2.0.1")
+	is.NoErr(err)
+	is.Equal(version, "2.0.2")
+	version, err = installer.ResolvePatched(ctx, "uid", "^2.0.0", "2.1.0")
+	is.NoErr(err)
+	is.Equal(version, "2.1.0")
+	version, err = installer.ResolvePatched(ctx, "uid", "*", "2.2.1")
+	is.NoErr(err)
+	is.Equal(version, "3.0.0")
+	_, err = installer.ResolvePatched(ctx, "uid", "^2.0.0", "2.2.1")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "no matching version at or above 2.2.1"))
+}
+
+func TestMatch(t *testing.T) {
+	is := is.New(t)
+	versions := []string{"1.0.0", "1.2.0", "1.2.5", "1.3.0", "2.0.0-beta.1", "2.0.0+build.5", "not-a-version"}
+	version, err := npm.Match(versions, "^1.2.0")
+	is.NoErr(err)
+	is.Equal(version, "1.3.0")
+	version, err = npm.Match(versions, "~1.2.0")
+	is.NoErr(err)
+	is.Equal(version, "1.2.5")
+	version, err = npm.Match(versions, "2.0.0+build.5")
+	is.NoErr(err)
+	is.Equal(version, "2.0.0+build.5")
+	version, err = npm.Match(versions, "*")
+	is.NoErr(err)
+	is.Equal(version, "2.0.0+build.5")
+	_, err = npm.Match(versions, "^3.0.0")
+	is.True(err != nil)
+	is.Equal(err.Error(), "npm: unable to match ^3.0.0: no matching version found")
+}
+
+func TestTarballURL(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0":          {},
+		"uid@2.0.2":          {},
+		"@lukeed/uuid@2.0.1": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	url, err := installer.TarballURL(ctx, "uid", "^2.0.0")
+	is.NoErr(err)
+	is.Equal(url, server.URL+"/uid/-/uid-2.0.2.tgz")
+	url, err = installer.TarballURL(ctx, "@lukeed/uuid", "2.0.1")
+	is.NoErr(err)
+	is.Equal(url, server.URL+"/@lukeed/uuid/-/uuid-2.0.1.tgz")
+	_, err = installer.TarballURL(ctx, "uid", "3.0.0")
+	is.True(err != nil)
+}
+
+// registryHandler serves a fake npm registry. Packages are keyed by
+// name@version and map to the files inside the tarball.
+func registryHandler(t testing.TB, packages map[string]map[string]string) http.Handler {
+	t.Helper()
+	type version struct {
+		manifest map[string]interface{}
+		tarball  []byte
+	}
+	documents := map[string]map[string]*version{}
+	for key, files := range packages {
+		index := strings.LastIndex(key, "@")
+		if index <= 0 {
+			t.Fatalf("registry: expected package %q to be name@version", key)
+		}
+		name, v := key[:index], key[index+1:]
+		manifest := map[string]interface{}{}
+		if code, ok := files["package.json"]; ok {
+			if err := json.Unmarshal([]byte(code), &manifest); err != nil {
+				t.Fatalf("registry: unable to unmarshal package.json for %s: %s", key, err)
+			}
+		} else {
+			files["package.json"] = fmt.Sprintf(`{"name":%q,"version":%q}`, name, v)
+		}
+		manifest["name"] = name
+		manifest["version"] = v
+		tarball, err := createTarball(files)
+		if err != nil {
+			t.Fatalf("registry: unable to create tarball for %s: %s", key, err)
+		}
+		if documents[name] == nil {
+			documents[name] = map[string]*version{}
+		}
+		documents[name][v] = &version{manifest, tarball}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		urlPath := strings.Replace(strings.TrimPrefix(r.URL.Path, "/"), "%2f", "/", 1)
+		// Tarball request
+		if index := strings.Index(urlPath, "/-/"); index >= 0 {
+			name := urlPath[:index]
+			_, base := path.Split(name)
+			v := strings.TrimSuffix(strings.TrimPrefix(urlPath[index+3:], base+"-"), ".tgz")
+			version, ok := documents[name][v]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(version.tarball)
+			return
+		}
+		// Metadata request
+		versions, ok := documents[urlPath]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		document := map[string]interface{}{
+			"name": urlPath,
+		}
+		latest := ""
+		docVersions := map[string]interface{}{}
+		for v, version := range versions {
+			manifest := map[string]interface{}{}
+			for key, value := range version.manifest {
+				manifest[key] = value
+			}
+			_, base := path.Split(urlPath)
+			sum := sha512.Sum512(version.tarball)
+			manifest["dist"] = map[string]interface{}{
+				"tarball":   fmt.Sprintf("http://%s/%s/-/%s-%s.tgz", r.Host, urlPath, base, v),
+				"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+			}
+			docVersions[v] = manifest
+			if latest == "" || semver.MustParse(v).GreaterThan(semver.MustParse(latest)) {
+				latest = v
+			}
+		}
+		document["versions"] = docVersions
+		document["dist-tags"] = map[string]string{"latest": latest}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(document)
+	})
+}
+
+// createTarball creates a gzipped tarball with files under package/ like npm
+// pack does. Directory entries are added for nested files like tar does.
+func createTarball(files map[string]string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	seen := map[string]bool{}
+	for _, fpath := range paths {
+		for dir := path.Dir(fpath); dir != "." && !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			header := &tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     "package/" + dir + "/",
+				Mode:     0755,
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, path := range paths {
+		header := &tar.Header{
+			Name: "package/" + path,
+			Mode: 0644,
+			Size: int64(len(files[path])),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(files[path])); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestRegistry(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"^2.0.0"}}`,
+			"index.js":     `export const uuid = "uuid"`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	err := installer.Install(ctx, dir, "@lukeed/uuid@^2.0.0")
+	is.NoErr(err)
+	equals(t, filepath.Join(dir, "node_modules", "@lukeed", "uuid", "index.js"), `export const uuid = "uuid"`)
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+}
+
+func TestLongPaths(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	// Too long for a ustar name, so the tarball falls back to PAX records
+	longName := strings.Repeat("a", 120) + ".js"
+	// Short segments that overflow the 100 byte name field
+	longPath := strings.Repeat("nested/", 20) + "index.js"
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"long@1.0.0": {
+			longName:          `export const long = "name"`,
+			"lib/" + longName: `export const long = "lib"`,
+			longPath:          `export const long = "path"`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	err := installer.Install(ctx, dir, "long@1.0.0")
+	is.NoErr(err)
+	pkgDir := filepath.Join(dir, "node_modules", "long")
+	equals(t, filepath.Join(pkgDir, longName), `export const long = "name"`)
+	equals(t, filepath.Join(pkgDir, "lib", longName), `export const long = "lib"`)
+	equals(t, filepath.Join(pkgDir, filepath.FromSlash(longPath)), `export const long = "path"`)
+	notExists(t, filepath.Join(pkgDir, "lib", "lib"))
+}
+
+func TestConcurrentInstalls(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("lib/%d.js", i)] = fmt.Sprintf("export const n = %d", i)
+	}
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"many@1.0.0": files,
+	}))
+	defer server.Close()
+	// Stale files from a previous install are removed
+	is.NoErr(writeFiles(dir, map[string]string{
+		"node_modules/many/stale.js": `export const stale = true`,
+	}))
+	ctx := context.Background()
+	eg := new(errgroup.Group)
+	for i := 0; i < 8; i++ {
+		eg.Go(func() error {
+			// Separate installers act like separate processes
+			installer := npm.New(npm.WithRegistry(server.URL))
+			return installer.Install(ctx, dir, "many@1.0.0")
+		})
+	}
+	is.NoErr(eg.Wait())
+	for path, code := range files {
+		equals(t, filepath.Join(dir, "node_modules", "many", path), code)
+	}
+	notExists(t, filepath.Join(dir, "node_modules", "many", "stale.js"))
+	entries, err := os.ReadDir(filepath.Join(dir, "node_modules"))
+	is.NoErr(err)
+	for _, entry := range entries {
+		is.True(!strings.HasPrefix(entry.Name(), ".many-"))
+	}
+}
+
+func TestFailedInstallLeavesNothing(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("lib/%d.js", i)] = strings.Repeat(fmt.Sprintf("export const n = %d\n", i), 100)
+	}
+	registry := registryHandler(t, map[string]map[string]string{
+		"many@1.0.0": files,
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".tgz") {
+			registry.ServeHTTP(w, r)
+			return
+		}
+		// Cut the tarball off halfway through
+		rec := httptest.NewRecorder()
+		registry.ServeHTTP(rec, r)
+		body := rec.Body.Bytes()
+		w.Write(body[:len(body)/2])
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	err := installer.Install(ctx, dir, "many@1.0.0")
+	is.True(err != nil)
+	notExists(t, filepath.Join(dir, "node_modules", "many"))
+	entries, err := os.ReadDir(filepath.Join(dir, "node_modules"))
+	is.NoErr(err)
+	is.Equal(len(entries), 0)
+}
+
+func TestIntegrityMismatch(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	tampered, err := createTarball(map[string]string{
+		"package.json": `{"name":"uid","version":"2.0.0"}`,
+		"index.js":     `export const uid = "tampered"`,
+	})
+	is.NoErr(err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			w.Write(tampered)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	err = installer.Install(ctx, dir, "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "integrity mismatch"))
+	notExists(t, filepath.Join(dir, "node_modules", "uid"))
+}
+
+func TestIntegrityRetry(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	corrupted, err := createTarball(map[string]string{
+		"package.json": `{"name":"uid","version":"2.0.0"}`,
+		"index.js":     `export const uid = "corrupted"`,
+	})
+	is.NoErr(err)
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the first download is corrupted
+		if strings.HasSuffix(r.URL.Path, ".tgz") && downloads.Add(1) == 1 {
+			w.Write(corrupted)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	is.NoErr(npm.New(npm.WithRegistry(server.URL)).Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	is.Equal(downloads.Load(), int32(2))
+	// Without retries the mismatch fails the install
+	downloads.Store(0)
+	dir = t.TempDir()
+	err = npm.New(npm.WithRegistry(server.URL), npm.WithIntegrityRetries(0)).Install(ctx, dir, "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "integrity mismatch"))
+	notExists(t, filepath.Join(dir, "node_modules", "uid"))
+}
+
+func TestFilter(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js":           `export const uid = "uid"`,
+			"index.js.map":       `{}`,
+			"test/fixture.js":    `export const fixture = "fixture"`,
+			"docs/readme.md":     `# uid`,
+			"dist/index.min.js":  `export const uid="uid"`,
+			"dist/index.min.map": `{}`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithFilter(func(path string) bool {
+			return !strings.HasSuffix(path, ".map") &&
+				!strings.HasPrefix(path, "test/") &&
+				!strings.HasPrefix(path, "docs/")
+		}),
+	)
+	err := installer.Install(ctx, dir, "uid@2.0.0")
+	is.NoErr(err)
+	pkgDir := filepath.Join(dir, "node_modules", "uid")
+	exists(t, filepath.Join(pkgDir, "package.json"))
+	exists(t, filepath.Join(pkgDir, "index.js"))
+	exists(t, filepath.Join(pkgDir, "dist", "index.min.js"))
+	notExists(t, filepath.Join(pkgDir, "index.js.map"))
+	notExists(t, filepath.Join(pkgDir, "dist", "index.min.map"))
+	notExists(t, filepath.Join(pkgDir, "test"))
+	notExists(t, filepath.Join(pkgDir, "docs"))
+}
+
+func TestStripComponents(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"package.json":       `{"name":"uid","version":"2.0.0"}`,
+			"dist/package.json":  `{"name":"uid","version":"2.0.0","main":"index.js"}`,
+			"dist/index.js":      `export const uid = "uid"`,
+			"dist/lib/helper.js": `export const helper = "helper"`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	// Strip package/dist/
+	dir := t.TempDir()
+	is.NoErr(npm.New(npm.WithRegistry(server.URL), npm.WithStripComponents(2)).Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"2.0.0","main":"index.js"}`)
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	equals(t, filepath.Join(dir, "node_modules", "uid", "lib", "helper.js"), `export const helper = "helper"`)
+	// Only package/ is stripped by default
+	dir = t.TempDir()
+	is.NoErr(npm.New(npm.WithRegistry(server.URL)).Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "dist", "index.js"), `export const uid = "uid"`)
+}
+
+func TestUnsafeTarballPaths(t *testing.T) {
+	tests := []string{
+		"/etc/passwd",
+		"package/../../etc/passwd",
+		"package/../../../../../../tmp/evil.js",
+	}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			dir := t.TempDir()
+			registry := registryHandler(t, map[string]map[string]string{
+				"evil@1.0.0": {},
+			})
+			buf := new(bytes.Buffer)
+			gw := gzip.NewWriter(buf)
+			tw := tar.NewWriter(gw)
+			is.NoErr(tw.WriteHeader(&tar.Header{Name: "package/package.json", Mode: 0644, Size: 2}))
+			_, err := tw.Write([]byte("{}"))
+			is.NoErr(err)
+			is.NoErr(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 4}))
+			_, err = tw.Write([]byte("evil"))
+			is.NoErr(err)
+			is.NoErr(tw.Close())
+			is.NoErr(gw.Close())
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, ".tgz") {
+					w.Write(buf.Bytes())
+					return
+				}
+				registry.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+			ctx := context.Background()
+			installer := npm.New(npm.WithRegistry(server.URL))
+			err = installer.Install(ctx, dir, "evil@1.0.0")
+			is.True(err != nil)
+			is.True(strings.Contains(err.Error(), "refusing to extract"))
+			notExists(t, filepath.Join(dir, "node_modules", "evil"))
+			notExists(t, filepath.Join(dir, "etc"))
+		})
+	}
+}
+
+func TestSpecialTarballEntries(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	is.NoErr(tw.WriteHeader(&tar.Header{Name: "package/package.json", Mode: 0644, Size: 2}))
+	_, err := tw.Write([]byte("{}"))
+	is.NoErr(err)
+	is.NoErr(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeChar, Name: "package/null", Mode: 0666, Devmajor: 1, Devminor: 3}))
+	is.NoErr(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeBlock, Name: "package/sda", Mode: 0660, Devmajor: 8}))
+	is.NoErr(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeFifo, Name: "package/fifo", Mode: 0644}))
+	is.NoErr(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "package/passwd", Linkname: "/etc/passwd", Mode: 0777}))
+	is.NoErr(tw.WriteHeader(&tar.Header{Typeflag: tar.TypeLink, Name: "package/hardlink", Linkname: "package/package.json", Mode: 0644}))
+	is.NoErr(tw.Close())
+	is.NoErr(gw.Close())
+	tarball := buf.Bytes()
+	sum := sha512.Sum512(tarball)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			w.Write(tarball)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name": "odd",
+			"versions": map[string]interface{}{
+				"1.0.0": map[string]interface{}{
+					"name":    "odd",
+					"version": "1.0.0",
+					"dist": map[string]string{
+						"tarball":   "http://" + r.Host + "/odd/-/odd-1.0.0.tgz",
+						"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+					},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	is.NoErr(installer.Install(context.Background(), dir, "odd@1.0.0"))
+	exists(t, filepath.Join(dir, "node_modules", "odd", "package.json"))
+	notExists(t, filepath.Join(dir, "node_modules", "odd", "null"))
+	notExists(t, filepath.Join(dir, "node_modules", "odd", "sda"))
+	notExists(t, filepath.Join(dir, "node_modules", "odd", "fifo"))
+	// Links are skipped rather than written as empty files
+	_, err = os.Lstat(filepath.Join(dir, "node_modules", "odd", "passwd"))
+	is.True(os.IsNotExist(err))
+	_, err = os.Lstat(filepath.Join(dir, "node_modules", "odd", "hardlink"))
+	is.True(os.IsNotExist(err))
+}
+
+func TestTarballErrorPage(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expect      string
+	}{
+		{"html", "text/html; charset=utf-8", "<html>\n  <h1>502 Bad Gateway</h1>\n</html>", `expected a tarball but got text/html; charset=utf-8 from`},
+		{"octet-stream", "application/octet-stream", "Access denied by proxy", `expected a gzipped tarball but got: "Access denied by proxy"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+			registry := registryHandler(t, map[string]map[string]string{
+				"uid@2.0.0": {},
+			})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, ".tgz") {
+					w.Header().Set("Content-Type", test.contentType)
+					w.Write([]byte(test.body))
+					return
+				}
+				registry.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+			dir := t.TempDir()
+			err := npm.New(npm.WithRegistry(server.URL)).Install(context.Background(), dir, "uid@2.0.0")
+			is.True(err != nil)
+			is.True(strings.Contains(err.Error(), test.expect))
+			is.True(strings.Contains(err.Error(), "Bad Gateway") || strings.Contains(err.Error(), "Access denied"))
+			notExists(t, filepath.Join(dir, "node_modules", "uid"))
+		})
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{"name":"a","version":"1.0.0","dependencies":{"b":"^1.0.0"}}`,
+		},
+		"b@1.0.0": {
+			"package.json": `{"name":"b","version":"1.0.0","dependencies":{"c":"^1.0.0"}}`,
+		},
+		"c@1.0.0": {},
+	}))
+	defer server.Close()
+	tests := []struct {
+		depth     int
+		installed []string
+		missing   []string
+	}{
+		{0, []string{"a"}, []string{"b", "c"}},
+		{1, []string{"a", "b"}, []string{"c"}},
+		{-1, []string{"a", "b", "c"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.depth), func(t *testing.T) {
+			is := is.New(t)
+			dir := t.TempDir()
+			ctx := context.Background()
+			installer := npm.New(npm.WithRegistry(server.URL), npm.WithMaxDepth(test.depth))
+			err := installer.Install(ctx, dir, "a@1.0.0")
+			is.NoErr(err)
+			for _, name := range test.installed {
+				exists(t, filepath.Join(dir, "node_modules", name, "package.json"))
+			}
+			for _, name := range test.missing {
+				notExists(t, filepath.Join(dir, "node_modules", name))
+			}
+		})
+	}
+}
+
+func TestMetadataTimeout(t *testing.T) {
+	is := is.New(t)
+	var stuck atomic.Bool
+	stuck.Store(true)
+	registry := registryHandler(t, map[string]map[string]string{
+		"subs@1.0.2": {},
+		"subs@0.0.1": {},
+	})
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if stuck.Load() {
+			<-r.Context().Done()
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithMetadataTimeout(50*time.Millisecond),
+	)
+	// Every waiter gets the timeout error
+	eg := new(errgroup.Group)
+	for i := 0; i < 5; i++ {
+		eg.Go(func() error {
+			_, err := installer.Version(ctx, "subs", "*")
+			return err
+		})
+	}
+	err := eg.Wait()
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "timed out after 50ms fetching metadata for subs"))
+	// The failed fetch is forgotten, so a retry fetches again
+	stuck.Store(false)
+	version, err := installer.Version(ctx, "subs", "*")
+	is.NoErr(err)
+	is.Equal(version, "1.0.2")
+	is.True(requests.Load() >= 2)
+}
+
+func TestDownloadTimeout(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+	})
+	var delay atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			select {
+			case <-time.After(time.Duration(delay.Load())):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	// Slow downloads are fine within the download timeout, even when they take
+	// longer than the metadata timeout
+	delay.Store(int64(100 * time.Millisecond))
+	installer := npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithMetadataTimeout(50*time.Millisecond),
+		npm.WithDownloadTimeout(5*time.Second),
+	)
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	exists(t, filepath.Join(dir, "node_modules", "uid", "package.json"))
+	// Stuck downloads time out
+	delay.Store(int64(time.Hour))
+	installer = npm.New(npm.WithRegistry(server.URL), npm.WithDownloadTimeout(50*time.Millisecond))
+	err := installer.Install(ctx, t.TempDir(), "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "timed out after 50ms downloading uid"))
+}
+
+func TestLocalGlob(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"packages/a/package.json":                `{"name":"a","main":"index.js"}`,
+		"packages/a/index.js":                    `export const a = "a"`,
+		"packages/b/package.json":                `{"name":"@scope/b","main":"index.js"}`,
+		"packages/b/index.js":                    `export const b = "b"`,
+		"packages/docs/readme.md":                `# Not a package`,
+		"packages/b/node_modules/c/package.json": `{"name":"c"}`,
+	}))
+	ctx := context.Background()
+	is.NoErr(npm.Install(ctx, dir, "./packages/*"))
+	equals(t, filepath.Join(dir, "node_modules", "a", "index.js"), `export const a = "a"`)
+	equals(t, filepath.Join(dir, "node_modules", "@scope", "b", "index.js"), `export const b = "b"`)
+	notExists(t, filepath.Join(dir, "node_modules", "c"))
+	notExists(t, filepath.Join(dir, "node_modules", "docs"))
+	// Globs need to match at least one package
+	err := npm.Install(ctx, dir, "./missing/*")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "no local packages match ./missing/*"))
+}
+
+func TestLocalGlobBroken(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"packages/a/package.json":        `{"name":"a","main":"index.js"}`,
+		"packages/a/index.js":            `export const a = "a"`,
+		"packages/broken/package.json":   `{"name":"broken",}`,
+		"packages/nameless/package.json": `{"main":"index.js"}`,
+		"packages/z/package.json":        `{"name":"z","main":"index.js"}`,
+		"packages/z/index.js":            `export const z = "z"`,
+	}))
+	err := npm.Install(context.Background(), dir, "./packages/*")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "unable to install 2 of the packages matching ./packages/*"))
+	is.True(strings.Contains(err.Error(), filepath.Join("packages", "broken")))
+	is.True(strings.Contains(err.Error(), filepath.Join("packages", "nameless")))
+	// The valid packages are still installed
+	equals(t, filepath.Join(dir, "node_modules", "a", "index.js"), `export const a = "a"`)
+	equals(t, filepath.Join(dir, "node_modules", "z", "index.js"), `export const z = "z"`)
+}
+
+func TestKeepUnrelatedPackages(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"react@1.0.0": {
+			"index.js": `export const react = "react"`,
+		},
+		"react@1.1.0": {
+			"index.js": `export const react = "react 1.1"`,
+		},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	// lodash was installed by another tool, without a lockfile entry
+	is.NoErr(writeFiles(dir, map[string]string{
+		"node_modules/lodash/package.json":      `{"name":"lodash","version":"4.17.21"}`,
+		"node_modules/lodash/lodash.js":         `module.exports = {}`,
+		"node_modules/lodash/fp/placeholder.js": `module.exports = {}`,
+		"node_modules/.bin/lodash-cli":          `#!/usr/bin/env node`,
+	}))
+	installer := npm.New(npm.WithRegistry(server.URL))
+	ctx := context.Background()
+	is.NoErr(installer.Install(ctx, dir, "react@1.0.0"))
+	// Reinstalling another version moves react into place over the old one
+	is.NoErr(installer.Install(ctx, dir, "react@1.1.0"))
+	equals(t, filepath.Join(dir, "node_modules", "react", "index.js"), `export const react = "react 1.1"`)
+	equals(t, filepath.Join(dir, "node_modules", "lodash", "package.json"), `{"name":"lodash","version":"4.17.21"}`)
+	equals(t, filepath.Join(dir, "node_modules", "lodash", "lodash.js"), `module.exports = {}`)
+	equals(t, filepath.Join(dir, "node_modules", "lodash", "fp", "placeholder.js"), `module.exports = {}`)
+	equals(t, filepath.Join(dir, "node_modules", ".bin", "lodash-cli"), `#!/usr/bin/env node`)
+	entries, err := os.ReadDir(filepath.Join(dir, "node_modules"))
+	is.NoErr(err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	is.Equal(names, []string{".bin", ".package-lock.json", "lodash", "react"})
+}
+
+func TestTempDir(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	// The default staging directory is cleaned up
+	dir := t.TempDir()
+	is.NoErr(npm.New(npm.WithRegistry(server.URL)).Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	notExists(t, filepath.Join(dir, "node_modules", ".staging"))
+	// A custom staging directory is left in place, but empty
+	dir = t.TempDir()
+	tempDir := filepath.Join(t.TempDir(), "staging")
+	is.NoErr(npm.New(npm.WithRegistry(server.URL), npm.WithTempDir(tempDir)).Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	entries, err := os.ReadDir(tempDir)
+	is.NoErr(err)
+	is.Equal(len(entries), 0)
+}
+
+func TestInstallNoDependencies(t *testing.T) {
+	manifests := map[string]string{
+		"empty":        `{}`,
+		"null":         `{"name":"app","dependencies":null}`,
+		"empty object": `{"name":"app","dependencies":{}}`,
+		"only dev":     `{"name":"app","devDependencies":{}}`,
+		"all null":     `{"dependencies":null,"devDependencies":null,"overrides":null,"resolutions":null}`,
+	}
+	for name, manifest := range manifests {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			dir := t.TempDir()
+			is.NoErr(writeFiles(dir, map[string]string{
+				"package.json": manifest,
+			}))
+			is.NoErr(npm.Install(context.Background(), dir))
+			notExists(t, filepath.Join(dir, "node_modules"))
+		})
+	}
+}
+
+func TestTempDirCrossDevice(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	tempDir, err := os.MkdirTemp("/dev/shm", "npm-staging-")
+	if err != nil {
+		t.Skip("no /dev/shm to stage on another device")
+	}
+	defer os.RemoveAll(tempDir)
+	// Only test when the directories are actually on different devices
+	probe := filepath.Join(tempDir, "probe")
+	is.NoErr(os.Mkdir(probe, 0755))
+	if err := os.Rename(probe, filepath.Join(dir, "probe")); err == nil {
+		t.Skip("/dev/shm is on the same device")
+	}
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithTempDir(tempDir))
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	// Nested node_modules are kept when reinstalling
+	is.NoErr(writeFiles(dir, map[string]string{
+		"node_modules/uid/node_modules/nested/package.json": `{"name":"nested"}`,
+	}))
+	is.NoErr(installer.Install(ctx, dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	exists(t, filepath.Join(dir, "node_modules", "uid", "node_modules", "nested", "package.json"))
+	entries, err := os.ReadDir(filepath.Join(dir, "node_modules"))
+	is.NoErr(err)
+	is.Equal(len(entries), 2) // uid and .package-lock.json
+}
+
+func TestSharedDownloads(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	dir := t.TempDir()
+	stagingDir := filepath.Join(dir, "node_modules", ".staging")
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			downloads.Add(1)
+			// Block until both installs are downloading into the staging directory
+			for {
+				entries, _ := os.ReadDir(stagingDir)
+				if len(entries) >= 2 {
+					break
+				}
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(time.Millisecond):
+				}
+			}
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	is.NoErr(installer.Install(context.Background(), dir, "uid@2.0.0", "uid2@npm:uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	equals(t, filepath.Join(dir, "node_modules", "uid2", "index.js"), `export const uid = "uid"`)
+	is.Equal(downloads.Load(), int32(1))
+}
@@ -0,0 +1,91 @@
+package npm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ReadNpmrc reads the registries and credentials from an .npmrc file, so they
+// can be passed to New. The following settings are supported:
+//
+//	registry=https://registry.example.com/
+//	@myorg:registry=https://npm.myorg.com/
+//	//npm.myorg.com/:_authToken=${NPM_TOKEN}
+//	//npm.legacy.com/:_auth=${NPM_AUTH}
+//	_auth=${NPM_AUTH}
+//	always-auth=true
+//
+// Environment variables in ${NAME} form are expanded. The _auth is the
+// base64-encoded username:password sent with basic auth, and without a
+// registry it's for the default registry. Other settings like email are
+// ignored, since they're only used to publish.
+func ReadNpmrc(path string) (Option, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to read %s: %w", path, err)
+	}
+	option, err := parseNpmrc(data)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to parse %s: %w", path, err)
+	}
+	return option, nil
+}
+
+// withBasicAuth sends basic auth with requests to the default registry
+func withBasicAuth(auth string) Option {
+	return func(in *Installer) {
+		in.authToken = "Basic " + auth
+	}
+}
+
+var npmrcEnv = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+func parseNpmrc(data []byte) (Option, error) {
+	var options []Option
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key=value but got %q", line, text)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		value = strings.Trim(value, `"'`)
+		value = npmrcEnv.ReplaceAllStringFunc(value, func(match string) string {
+			return os.Getenv(match[2 : len(match)-1])
+		})
+		switch {
+		case key == "registry":
+			options = append(options, WithRegistry(value))
+		case strings.HasPrefix(key, "@") && strings.HasSuffix(key, ":registry"):
+			options = append(options, WithScopeRegistry(strings.TrimSuffix(key, ":registry"), value))
+		case strings.HasPrefix(key, "//") && strings.HasSuffix(key, ":_authToken"):
+			registry := "https:" + strings.TrimSuffix(key, ":_authToken")
+			options = append(options, WithRegistryAuthToken(registry, value))
+		case strings.HasPrefix(key, "//") && strings.HasSuffix(key, ":_auth"):
+			registry := "https:" + strings.TrimSuffix(key, ":_auth")
+			options = append(options, WithRegistryBasicAuth(registry, value))
+		case key == "_auth":
+			options = append(options, withBasicAuth(value))
+		case key == "always-auth":
+			if value == "true" {
+				options = append(options, WithAlwaysAuth())
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return func(in *Installer) {
+		for _, option := range options {
+			option(in)
+		}
+	}, nil
+}
@@ -0,0 +1,132 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestScopeRegistry(t *testing.T) {
+	is := is.New(t)
+	var mu sync.Mutex
+	var leaked []string
+	public := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	publicServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			mu.Lock()
+			leaked = append(leaked, auth)
+			mu.Unlock()
+		}
+		public.ServeHTTP(w, r)
+	}))
+	defer publicServer.Close()
+	private := registryHandler(t, map[string]map[string]string{
+		"@myorg/ui@1.0.0": {
+			"package.json": `{"name":"@myorg/ui","version":"1.0.0","dependencies":{"uid":"^2.0.0"}}`,
+			"index.js":     `export const ui = "ui"`,
+		},
+	})
+	privateServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer private-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		private.ServeHTTP(w, r)
+	}))
+	defer privateServer.Close()
+	t.Setenv("MYORG_NPM_TOKEN", "private-token")
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		".npmrc": strings.Join([]string{
+			"# Registries",
+			"registry=" + publicServer.URL + "/",
+			"@myorg:registry=" + privateServer.URL,
+			strings.TrimPrefix(privateServer.URL, "http:") + "/:_authToken=${MYORG_NPM_TOKEN}",
+		}, "\n"),
+	}))
+	npmrc, err := npm.ReadNpmrc(filepath.Join(dir, ".npmrc"))
+	is.NoErr(err)
+	is.NoErr(npm.New(npmrc).Install(context.Background(), dir, "@myorg/ui@^1.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "@myorg", "ui", "index.js"), `export const ui = "ui"`)
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	// The private token is never sent to the public registry
+	is.Equal(len(leaked), 0)
+}
+
+func TestReadNpmrcInvalid(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		".npmrc": "registry=https://registry.npmjs.org/\nnot a setting\n",
+	}))
+	_, err := npm.ReadNpmrc(filepath.Join(dir, ".npmrc"))
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `line 2: expected key=value but got "not a setting"`))
+}
+
+func TestNpmrcBasicAuth(t *testing.T) {
+	is := is.New(t)
+	auth := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+	})
+	// The tarballs are on another host that also needs the credentials
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic "+auth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer cdn.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic "+auth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.Host = strings.TrimPrefix(cdn.URL, "http://")
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	t.Setenv("LEGACY_AUTH", auth)
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		".npmrc": strings.Join([]string{
+			"registry=" + server.URL + "/",
+			"_auth=${LEGACY_AUTH}",
+			"email=me@example.com",
+			"always-auth=true",
+		}, "\n"),
+	}))
+	npmrc, err := npm.ReadNpmrc(filepath.Join(dir, ".npmrc"))
+	is.NoErr(err)
+	is.NoErr(npm.New(npmrc).Install(context.Background(), dir, "uid@2.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+	// Without always-auth, the tarball host doesn't get the credentials
+	dir = t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		".npmrc": strings.Join([]string{
+			"registry=" + server.URL + "/",
+			strings.TrimPrefix(server.URL, "http:") + "/:_auth=${LEGACY_AUTH}",
+		}, "\n"),
+	}))
+	npmrc, err = npm.ReadNpmrc(filepath.Join(dir, ".npmrc"))
+	is.NoErr(err)
+	err = npm.New(npmrc).Install(context.Background(), dir, "uid@2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "401"))
+}
@@ -0,0 +1,69 @@
+package npm
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Open an installed package in dir/node_modules as a filesystem. Files are
+// read straight from disk, but names are first resolved through the
+// package's exports and imports using the conditions (e.g. "import" or
+// "browser"). Open("feature") opens whatever ./feature is exported as and
+// Open("#internal") opens whatever the import map points at. Other names,
+// including ".", are opened as-is. Use EntryPoint to find the package's entry
+// file.
+func Open(dir, pkgName string, conditions ...string) (fs.FS, error) {
+	pkgDir := filepath.Join(dir, "node_modules", filepath.FromSlash(pkgName))
+	manifest, err := readManifest(filepath.Join(pkgDir, "package.json"), false)
+	if err != nil {
+		return nil, err
+	}
+	return &packageFS{
+		fsys:       os.DirFS(pkgDir),
+		manifest:   manifest,
+		conditions: conditions,
+	}, nil
+}
+
+type packageFS struct {
+	fsys       fs.FS
+	manifest   *Manifest
+	conditions []string
+}
+
+var _ fs.FS = (*packageFS)(nil)
+
+func (p *packageFS) Open(name string) (fs.File, error) {
+	if strings.HasPrefix(name, "#") {
+		target, ok := p.resolveImport(name)
+		if !ok {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		return p.fsys.Open(target)
+	}
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if p.manifest.Exports != nil && name != "." {
+		if target, ok := p.manifest.Exports.Resolve("./"+name, p.conditions...); ok {
+			file, err := p.fsys.Open(cleanExport(target))
+			if err == nil || !errors.Is(err, fs.ErrNotExist) {
+				return file, err
+			}
+		}
+	}
+	return p.fsys.Open(name)
+}
+
+// resolveImport resolves a subpath import (e.g. #internal) using the first
+// condition that matches, falling back to "default".
+func (p *packageFS) resolveImport(name string) (string, bool) {
+	target, ok := p.manifest.Imports.Resolve(name, p.conditions...)
+	if !ok {
+		return "", false
+	}
+	return cleanExport(target), true
+}
@@ -0,0 +1,72 @@
+package npm_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestOpen(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"node_modules/@scope/ui/package.json": `{
+			"name": "@scope/ui",
+			"exports": {
+				".": { "import": "./dist/index.mjs", "default": "./dist/index.cjs" },
+				"./button": { "import": "./dist/button.mjs" },
+				"./package.json": "./package.json"
+			},
+			"imports": {
+				"#internal": { "import": "./src/internal.mjs", "default": "./src/internal.js" },
+				"#shared": "./src/shared.js",
+				"#utils/*": "./src/utils/*.js"
+			}
+		}`,
+		"node_modules/@scope/ui/dist/index.mjs":   `export default "esm"`,
+		"node_modules/@scope/ui/dist/index.cjs":   `module.exports = "cjs"`,
+		"node_modules/@scope/ui/dist/button.mjs":  `export const button = "button"`,
+		"node_modules/@scope/ui/src/internal.mjs": `export const internal = "esm"`,
+		"node_modules/@scope/ui/src/internal.js":  `exports.internal = "cjs"`,
+		"node_modules/@scope/ui/src/shared.js":    `export const shared = "shared"`,
+		"node_modules/@scope/ui/src/utils/a.js":   `export const a = "a"`,
+	}))
+	fsys, err := npm.Open(dir, "@scope/ui", "import")
+	is.NoErr(err)
+	data, err := fs.ReadFile(fsys, "button")
+	is.NoErr(err)
+	is.Equal(string(data), `export const button = "button"`)
+	data, err = fs.ReadFile(fsys, "#internal")
+	is.NoErr(err)
+	is.Equal(string(data), `export const internal = "esm"`)
+	data, err = fs.ReadFile(fsys, "#shared")
+	is.NoErr(err)
+	is.Equal(string(data), `export const shared = "shared"`)
+	data, err = fs.ReadFile(fsys, "#utils/a")
+	is.NoErr(err)
+	is.Equal(string(data), `export const a = "a"`)
+	// Files are still reachable by their real paths
+	data, err = fs.ReadFile(fsys, "dist/index.cjs")
+	is.NoErr(err)
+	is.Equal(string(data), `module.exports = "cjs"`)
+	entries, err := fs.ReadDir(fsys, "dist")
+	is.NoErr(err)
+	is.Equal(len(entries), 3)
+	entries, err = fs.ReadDir(fsys, ".")
+	is.NoErr(err)
+	is.Equal(len(entries), 3)
+	// Without conditions, only the defaults match
+	fsys, err = npm.Open(dir, "@scope/ui")
+	is.NoErr(err)
+	data, err = fs.ReadFile(fsys, "#internal")
+	is.NoErr(err)
+	is.Equal(string(data), `exports.internal = "cjs"`)
+	_, err = fs.ReadFile(fsys, "button")
+	is.True(errors.Is(err, fs.ErrNotExist))
+	// Packages that aren't installed can't be opened
+	_, err = npm.Open(dir, "missing")
+	is.True(errors.Is(err, fs.ErrNotExist))
+}
@@ -0,0 +1,266 @@
+package npm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// override forces the version of a package anywhere beneath where it's
+// declared in the root package.json's overrides. For example,
+//
+//	"overrides": {
+//	  "c": "2.0.0",
+//	  "b@1": { ".": "1.2.0", "c": "1.0.0" }
+//	}
+//
+// installs c@2.0.0 everywhere, except beneath b@1, where b itself is pinned
+// to 1.2.0 and c to 1.0.0.
+type override struct {
+	Name string
+	// Constraint optionally limits the override to matching versions
+	Constraint string
+	// Version to install instead. Empty when only nested overrides are set.
+	Version string
+	// Overrides apply beneath this package
+	Overrides []*override
+}
+
+// overrides are the override rules in effect at a point in the tree. Rules
+// nested deeper in the tree take precedence.
+type overrides struct {
+	rules  []*override
+	parent *overrides
+}
+
+// version returns the version to install in place of the package
+func (o *overrides) version(name, version string) (string, bool) {
+	for ; o != nil; o = o.parent {
+		for _, rule := range o.rules {
+			if rule.Name == name && rule.Version != "" && rule.matches(version) {
+				return rule.Version, true
+			}
+		}
+	}
+	return "", false
+}
+
+// enter returns the overrides in effect for the dependencies of the package
+func (o *overrides) enter(name, version string) *overrides {
+	var rules []*override
+	for scope := o; scope != nil; scope = scope.parent {
+		for _, rule := range scope.rules {
+			if rule.Name == name && len(rule.Overrides) > 0 && rule.matches(version) {
+				rules = append(rules, rule.Overrides...)
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return o
+	}
+	return &overrides{rules, o}
+}
+
+// enterPackage returns the overrides in effect for the dependencies of the
+// resolved package.
+func (o *overrides) enterPackage(pkg installable) *overrides {
+	switch p := pkg.(type) {
+	case *remotePackage:
+		return o.enter(p.name(), p.Version)
+	case *localPackage:
+		return o.enter(p.Key(), p.Version)
+	}
+	return o.enter(pkg.Key(), "")
+}
+
+func (o *override) matches(version string) bool {
+	if o.Constraint == "" || version == "" {
+		return true
+	}
+	constraint, err := semver.NewConstraint(o.Constraint)
+	if err != nil {
+		return false
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return constraint.Check(v)
+}
+
+// readOverrides reads the overrides from the root package.json in dir, if
+// there is one. Yarn's resolutions are supported too, but where both pin the
+// same package at the same place, overrides take precedence.
+func (in *Installer) readOverrides(dir string) (*overrides, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("npm: unable to read package.json: %w", err)
+	}
+	var manifest struct {
+		Dependencies    map[string]string          `json:"dependencies,omitempty"`
+		DevDependencies map[string]string          `json:"devDependencies,omitempty"`
+		Overrides       map[string]json.RawMessage `json:"overrides,omitempty"`
+		Resolutions     map[string]string          `json:"resolutions,omitempty"`
+	}
+	if err := in.unmarshalManifest(data, &manifest); err != nil {
+		return nil, fmt.Errorf("npm: unable to unmarshal package.json: %w", err)
+	}
+	if len(manifest.Overrides) == 0 && len(manifest.Resolutions) == 0 {
+		return nil, nil
+	}
+	// Overrides can reference the root's own dependencies with $name
+	root := map[string]string{}
+	for name, version := range manifest.DevDependencies {
+		root[name] = version
+	}
+	for name, version := range manifest.Dependencies {
+		root[name] = version
+	}
+	rules, err := parseOverrides(manifest.Overrides, root)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to parse overrides in package.json: %w", err)
+	}
+	resolutions, err := parseResolutions(manifest.Resolutions)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to parse resolutions in package.json: %w", err)
+	}
+	return &overrides{rules: mergeOverrides(rules, resolutions)}, nil
+}
+
+func parseOverrides(fields map[string]json.RawMessage, root map[string]string) (rules []*override, err error) {
+	for key, value := range fields {
+		if key == "." {
+			continue
+		}
+		rule := newOverride(key)
+		var version string
+		if err := json.Unmarshal(value, &version); err == nil {
+			if rule.Version, err = overrideVersion(version, root); err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+			continue
+		}
+		var nested map[string]json.RawMessage
+		if err := json.Unmarshal(value, &nested); err != nil {
+			return nil, fmt.Errorf("expected %q to be a version or an object", key)
+		}
+		if self, ok := nested["."]; ok {
+			if err := json.Unmarshal(self, &version); err != nil {
+				return nil, fmt.Errorf("expected \".\" in %q to be a version", key)
+			}
+			if rule.Version, err = overrideVersion(version, root); err != nil {
+				return nil, err
+			}
+		}
+		if rule.Overrides, err = parseOverrides(nested, root); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// overrideVersion resolves $name references to the root's dependencies
+func overrideVersion(version string, root map[string]string) (string, error) {
+	if !strings.HasPrefix(version, "$") {
+		return version, nil
+	}
+	name := version[1:]
+	rootVersion, ok := root[name]
+	if !ok {
+		return "", fmt.Errorf("unable to reference %s because it's not a dependency of the root package", version)
+	}
+	return rootVersion, nil
+}
+
+// parseResolutions turns Yarn's resolutions into overrides. Resolutions are
+// keyed by a path of packages (e.g. a/**/c), which is nested the same way
+// overrides are. Since overrides apply anywhere beneath where they're
+// declared, a/c is treated like a/**/c.
+func parseResolutions(resolutions map[string]string) (rules []*override, err error) {
+	for key, version := range resolutions {
+		names, err := splitResolution(key)
+		if err != nil {
+			return nil, err
+		}
+		rule := newOverride(names[len(names)-1])
+		rule.Version = version
+		for i := len(names) - 2; i >= 0; i-- {
+			parent := newOverride(names[i])
+			parent.Overrides = []*override{rule}
+			rule = parent
+		}
+		rules = mergeOverrides(rules, []*override{rule})
+	}
+	return rules, nil
+}
+
+// splitResolution splits a resolution path into package names, skipping the
+// ** globs.
+func splitResolution(key string) (names []string, err error) {
+	segments := strings.Split(key, "/")
+	for i := 0; i < len(segments); i++ {
+		segment := segments[i]
+		if segment == "**" {
+			continue
+		}
+		// Scoped packages span two segments
+		if strings.HasPrefix(segment, "@") && i+1 < len(segments) {
+			segment += "/" + segments[i+1]
+			i++
+		}
+		if segment == "" || strings.Contains(segment, "*") {
+			return nil, fmt.Errorf("unsupported resolution %q", key)
+		}
+		names = append(names, segment)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("unsupported resolution %q", key)
+	}
+	return names, nil
+}
+
+// newOverride creates an override for a name with an optional @constraint
+func newOverride(key string) *override {
+	rule := &override{Name: key}
+	if index := strings.LastIndex(key, "@"); index > 0 {
+		rule.Name, rule.Constraint = key[:index], key[index+1:]
+	}
+	return rule
+}
+
+// mergeOverrides merges the extra rules into rules. When both have a rule for
+// the same package, the version in rules wins and their nested rules are
+// merged.
+func mergeOverrides(rules, extra []*override) []*override {
+	for _, rule := range extra {
+		existing := findOverride(rules, rule.Name, rule.Constraint)
+		if existing == nil {
+			rules = append(rules, rule)
+			continue
+		}
+		if existing.Version == "" {
+			existing.Version = rule.Version
+		}
+		existing.Overrides = mergeOverrides(existing.Overrides, rule.Overrides)
+	}
+	return rules
+}
+
+func findOverride(rules []*override, name, constraint string) *override {
+	for _, rule := range rules {
+		if rule.Name == name && rule.Constraint == constraint {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func installedVersion(t testing.TB, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "node_modules", name, "package.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pkg struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		t.Fatal(err)
+	}
+	return pkg.Version
+}
+
+func overridesRegistry(t testing.TB) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{"name":"a","version":"1.0.0","dependencies":{"b":"^1.0.0"}}`,
+		},
+		"b@1.0.0": {
+			"package.json": `{"name":"b","version":"1.0.0","dependencies":{"c":"^1.0.0"}}`,
+		},
+		"b@1.1.0": {
+			"package.json": `{"name":"b","version":"1.1.0","dependencies":{"c":"^1.0.0"}}`,
+		},
+		"c@1.0.0": {},
+		"c@2.0.0": {},
+	}))
+}
+
+func TestOverrides(t *testing.T) {
+	is := is.New(t)
+	server := overridesRegistry(t)
+	defer server.Close()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"dependencies":{"a":"^1.0.0"},"overrides":{"c":"2.0.0"}}`,
+	}))
+	is.NoErr(npm.New(npm.WithRegistry(server.URL)).Install(context.Background(), dir))
+	is.Equal(installedVersion(t, dir, "b"), "1.1.0")
+	is.Equal(installedVersion(t, dir, "c"), "2.0.0")
+}
+
+func TestOverridesNested(t *testing.T) {
+	is := is.New(t)
+	server := overridesRegistry(t)
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	ctx := context.Background()
+	// Overrides beneath a package that's in the tree apply
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"dependencies":{"a":"^1.0.0"},"overrides":{"a":{"b@^1.1.0":{".":"1.0.0","c":"2.0.0"}}}}`,
+	}))
+	is.NoErr(installer.Install(ctx, dir))
+	is.Equal(installedVersion(t, dir, "b"), "1.0.0")
+	is.Equal(installedVersion(t, dir, "c"), "2.0.0")
+	// Overrides beneath a package that's not in the tree don't
+	dir = t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"dependencies":{"a":"^1.0.0"},"overrides":{"d":{"c":"2.0.0"}}}`,
+	}))
+	is.NoErr(installer.Install(ctx, dir))
+	is.Equal(installedVersion(t, dir, "c"), "1.0.0")
+}
+
+func TestOverridesReference(t *testing.T) {
+	is := is.New(t)
+	server := overridesRegistry(t)
+	defer server.Close()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"dependencies":{"a":"^1.0.0","b":"1.0.0"},"overrides":{"b":"$b"}}`,
+	}))
+	is.NoErr(npm.New(npm.WithRegistry(server.URL)).Install(context.Background(), dir))
+	is.Equal(installedVersion(t, dir, "b"), "1.0.0")
+}
+
+func TestResolutions(t *testing.T) {
+	is := is.New(t)
+	server := overridesRegistry(t)
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	ctx := context.Background()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"dependencies":{"a":"^1.0.0"},"resolutions":{"**/b":"1.0.0","a/**/c":"2.0.0"}}`,
+	}))
+	is.NoErr(installer.Install(ctx, dir))
+	is.Equal(installedVersion(t, dir, "b"), "1.0.0")
+	is.Equal(installedVersion(t, dir, "c"), "2.0.0")
+	// Overrides take precedence over resolutions
+	dir = t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"dependencies":{"a":"^1.0.0"},"overrides":{"c":"1.0.0"},"resolutions":{"c":"2.0.0","b":"1.0.0"}}`,
+	}))
+	is.NoErr(installer.Install(ctx, dir))
+	is.Equal(installedVersion(t, dir, "b"), "1.0.0")
+	is.Equal(installedVersion(t, dir, "c"), "1.0.0")
+}
+
+func TestOverridesLocalVersion(t *testing.T) {
+	is := is.New(t)
+	server := overridesRegistry(t)
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	ctx := context.Background()
+	root := t.TempDir()
+	is.NoErr(writeFiles(root, map[string]string{
+		"loc/package.json": `{"name":"loc","version":"1.0.0","dependencies":{"b":"^1.0.0"}}`,
+	}))
+	pkgDir := filepath.Join(root, "loc")
+	// Overrides for another version of the local package don't apply
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"overrides":{"loc@^2.0.0":{"b":"1.0.0"}}}`,
+	}))
+	result, err := installer.InstallWithResult(ctx, dir, pkgDir)
+	is.NoErr(err)
+	is.Equal(installedVersion(t, dir, "b"), "1.1.0")
+	is.Equal(result.Packages[2].Name, "loc")
+	is.Equal(result.Packages[2].Version, "1.0.0")
+	// Overrides for its version do
+	dir = t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"overrides":{"loc@^1.0.0":{"b":"1.0.0"}}}`,
+	}))
+	is.NoErr(installer.Install(ctx, dir, pkgDir))
+	is.Equal(installedVersion(t, dir, "b"), "1.0.0")
+}
@@ -0,0 +1,81 @@
+package npm
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+)
+
+// PackageJSON downloads a package's tarball (e.g. preact@^10.0.0) and returns
+// its package.json without extracting anything else. Reading stops as soon as
+// the package.json is found, which makes building a dependency graph from
+// tarballs much cheaper than installing them. The tarball's integrity isn't
+// verified since it's not read to the end.
+func PackageJSON(ctx context.Context, pkgname string) ([]byte, error) {
+	return defaultInstaller.PackageJSON(ctx, pkgname)
+}
+
+// PackageJSON downloads a package's tarball and returns its package.json
+// without extracting anything else.
+func (in *Installer) PackageJSON(ctx context.Context, pkgname string) ([]byte, error) {
+	pkgName, version, err := splitPackage(pkgname)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := in.metadataFor(ctx, pkgName, version)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to resolve versions for %s: %w", pkgName, err)
+	}
+	version, err = in.resolve(meta, version)
+	if err != nil {
+		return nil, fmt.Errorf("npm: %w", err)
+	}
+	pkg := in.newRemotePackage(pkgName, meta, version)
+	body, err := in.openTarball(ctx, pkg)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to download %s@%s: %w", pkgName, version, err)
+	}
+	defer body.Close()
+	manifest, err := in.extractManifest(bufio.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to read package.json from %s@%s: %w", pkgName, version, err)
+	}
+	return manifest, nil
+}
+
+// extractManifest reads the package.json out of a gzipped tarball, stopping
+// once it's found
+func (in *Installer) extractManifest(r *bufio.Reader) ([]byte, error) {
+	if err := checkGzip(r); err != nil {
+		return nil, err
+	}
+	gzipReader, err := in.gunzip(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("tarball doesn't contain a package.json")
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to get next header: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		rel, ok := stripComponents(path.Clean(header.Name), in.strip)
+		if !ok || rel != "package.json" {
+			continue
+		}
+		manifest, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read package.json from tarball: %w", err)
+		}
+		return manifest, nil
+	}
+}
@@ -0,0 +1,36 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestPackageJSON(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0": {
+			"package.json": `{"name":"uid","version":"1.0.0","dependencies":{"a":"^1.0.0"}}`,
+			"index.js":     `export default 1`,
+		},
+		"uid@1.1.0": {
+			"package.json": `{"name":"uid","version":"1.1.0"}`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	manifest, err := installer.PackageJSON(ctx, "uid@~1.0.0")
+	is.NoErr(err)
+	is.Equal(string(manifest), `{"name":"uid","version":"1.0.0","dependencies":{"a":"^1.0.0"}}`)
+	manifest, err = installer.PackageJSON(ctx, "uid@latest")
+	is.NoErr(err)
+	is.Equal(string(manifest), `{"name":"uid","version":"1.1.0"}`)
+	_, err = installer.PackageJSON(ctx, "uid@^2.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "no matching version"))
+}
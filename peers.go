@@ -0,0 +1,124 @@
+package npm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// WithPeerDependencies installs the peer dependencies of installed packages,
+// like npm 7+. Peers marked optional in peerDependenciesMeta aren't installed
+// and it's fine for them to be missing, but once the install finishes, every
+// installed peer must satisfy the range that asked for it.
+func WithPeerDependencies() Option {
+	return func(in *Installer) {
+		in.peers = true
+	}
+}
+
+// WithRootPeers installs the peerDependencies of the root package.json along
+// with its dependencies, like dev dependencies, so libraries can be developed
+// and tested against their peers. Peers marked optional in
+// peerDependenciesMeta aren't installed, and dependencies win over peers with
+// the same name.
+func WithRootPeers() Option {
+	return func(in *Installer) {
+		in.rootPeers = true
+	}
+}
+
+// rootPeers adds the required peers to the root's dependencies
+func rootPeers(deps, peers map[string]string, meta map[string]*PeerMeta) map[string]string {
+	merged := make(map[string]string, len(deps)+len(peers))
+	for name, constraint := range peers {
+		if meta[name] != nil && meta[name].Optional {
+			continue
+		}
+		merged[name] = constraint
+	}
+	for name, version := range deps {
+		merged[name] = version
+	}
+	return merged
+}
+
+// PeerMeta describes a peer dependency in peerDependenciesMeta
+type PeerMeta struct {
+	Optional bool `json:"optional,omitempty"`
+}
+
+// peerRequirement is a peer dependency asked for by an installed package
+type peerRequirement struct {
+	From       string
+	Name       string
+	Constraint string
+	Optional   bool
+}
+
+// installPeers installs the required peer dependencies of a package and
+// remembers every peer, so they can be checked once the install finishes.
+func (s *session) installPeers(ctx context.Context, from string, peers map[string]string, meta map[string]*PeerMeta, depth int, overrides *overrides) error {
+	if !s.in.peers || len(peers) == 0 || !s.descend(depth) {
+		return nil
+	}
+	required := map[string]string{}
+	s.mu.Lock()
+	for name, constraint := range peers {
+		optional := meta[name] != nil && meta[name].Optional
+		s.peers = append(s.peers, &peerRequirement{from, name, constraint, optional})
+		if !optional {
+			required[name] = constraint
+		}
+	}
+	s.mu.Unlock()
+	// Peers are hoisted so the package shares them with its dependents
+	return s.installDependencies(ctx, "", required, depth, overrides)
+}
+
+// checkPeers ensures every peer dependency is satisfied by what's installed.
+// Missing optional peers are fine.
+func (s *session) checkPeers() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var problems []string
+	for _, peer := range s.peers {
+		manifest, err := readManifest(filepath.Join(s.dir, "node_modules", filepath.FromSlash(s.in.moduleDir(peer.Name)), "package.json"), s.in.lenientJSON)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				if !peer.Optional {
+					problems = append(problems, fmt.Sprintf("%s requires peer %s@%s, but it's not installed", peer.From, peer.Name, peer.Constraint))
+				}
+				continue
+			}
+			return err
+		}
+		if !satisfies(manifest.Version, peer.Constraint) {
+			problems = append(problems, fmt.Sprintf("%s requires peer %s@%s, but %s is installed", peer.From, peer.Name, peer.Constraint, manifest.Version))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("npm: unmet peer dependencies: %s", strings.Join(problems, ", "))
+}
+
+// satisfies returns true if the version satisfies the constraint. Constraints
+// that aren't semver ranges (e.g. tags or URLs) are assumed to be satisfied.
+func satisfies(version, constraint string) bool {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return true
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return c.Check(v)
+}
@@ -0,0 +1,98 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func peersRegistry(t testing.TB) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"ui@1.0.0": {
+			"package.json": `{
+				"name": "ui",
+				"version": "1.0.0",
+				"peerDependencies": { "react": "^18.0.0", "react-dom": "^18.0.0" },
+				"peerDependenciesMeta": { "react-dom": { "optional": true } }
+			}`,
+		},
+		"react@18.2.0":     {},
+		"react-dom@17.0.2": {},
+		"react-dom@18.2.0": {},
+	}))
+}
+
+func TestPeerDependencies(t *testing.T) {
+	is := is.New(t)
+	server := peersRegistry(t)
+	defer server.Close()
+	ctx := context.Background()
+	dir := t.TempDir()
+	is.NoErr(npm.New(npm.WithRegistry(server.URL), npm.WithPeerDependencies()).Install(ctx, dir, "ui@^1.0.0"))
+	is.Equal(installedVersion(t, dir, "react"), "18.2.0")
+	// Optional peers aren't installed
+	notExists(t, filepath.Join(dir, "node_modules", "react-dom"))
+	// Peers aren't installed without the option
+	dir = t.TempDir()
+	is.NoErr(npm.New(npm.WithRegistry(server.URL)).Install(ctx, dir, "ui@^1.0.0"))
+	notExists(t, filepath.Join(dir, "node_modules", "react"))
+}
+
+func TestPeerDependenciesUnmet(t *testing.T) {
+	is := is.New(t)
+	server := peersRegistry(t)
+	defer server.Close()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithPeerDependencies())
+	err := installer.Install(context.Background(), dir, "ui@^1.0.0", "react-dom@^17.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "ui requires peer react-dom@^18.0.0, but 17.0.2 is installed"))
+}
+
+func TestPeerDependenciesFlatScopes(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"ui@1.0.0": {
+			"package.json": `{"name":"ui","version":"1.0.0","peerDependencies":{"@scope/core":"^1.0.0"}}`,
+		},
+		"@scope/core@1.0.0": {},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithPeerDependencies(), npm.WithScopedLayout(npm.FlatScopes))
+	is.NoErr(installer.Install(context.Background(), dir, "ui@^1.0.0"))
+	exists(t, filepath.Join(dir, "node_modules", "@scope%2fcore", "package.json"))
+}
+
+func TestRootPeers(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"react@18.0.0": {},
+		"react@17.0.0": {},
+		"uid@2.0.0":    {},
+		"debug@1.0.0":  {},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	is.NoErr(os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{
+		"name": "library",
+		"dependencies": {"uid": "^2.0.0", "react": "^17.0.0"},
+		"peerDependencies": {"react": ">=17", "debug": "^1.0.0", "missing": "^1.0.0"},
+		"peerDependenciesMeta": {"missing": {"optional": true}}
+	}`), 0644))
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithRootPeers())
+	is.NoErr(installer.Install(context.Background(), dir))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"2.0.0"}`)
+	equals(t, filepath.Join(dir, "node_modules", "debug", "package.json"), `{"name":"debug","version":"1.0.0"}`)
+	// Dependencies win over peers
+	equals(t, filepath.Join(dir, "node_modules", "react", "package.json"), `{"name":"react","version":"17.0.0"}`)
+	_, err := os.Stat(filepath.Join(dir, "node_modules", "missing"))
+	is.True(os.IsNotExist(err))
+}
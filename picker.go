@@ -0,0 +1,113 @@
+package npm
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// VersionChoice is a version range that more than one version could
+// reasonably resolve to
+type VersionChoice struct {
+	Name       string
+	Constraint string
+	// Versions that satisfy the range, newest first. Prereleases newer than
+	// the default are included when their release would satisfy the range.
+	Versions []string
+	// Default is the version that's installed unless another one is picked,
+	// which is the highest stable version
+	Default string
+}
+
+// WithVersionPicker calls pick when a range (e.g. * or ^1.0.0) could resolve
+// to more than one version, so interactive tools can prompt or apply their
+// own policy. Pick returns one of the versions, or an empty string to keep the
+// default. Dist-tags and exact versions never call pick, and calls are never
+// concurrent.
+func WithVersionPicker(pick func(choice *VersionChoice) (string, error)) Option {
+	return func(in *Installer) {
+		in.pick = pick
+	}
+}
+
+// filterVersions returns a copy of the metadata with only the versions that
+// can be resolved, after WithBeforeDate, WithAllowedVersions and
+// WithTaggedVersionsOnly
+func (in *Installer) filterVersions(meta *metadata) (*metadata, error) {
+	meta, err := in.publishedBefore(meta)
+	if err != nil {
+		return nil, err
+	}
+	meta, err = in.allowedVersions(meta)
+	if err != nil {
+		return nil, err
+	}
+	return in.taggedVersions(meta)
+}
+
+// pickVersion resolves the version of a package from its metadata, letting the
+// version picker choose between the candidates
+func (in *Installer) pickVersion(meta *metadata, constraint string) (string, error) {
+	meta, err := in.filterVersions(meta)
+	if err != nil {
+		return "", err
+	}
+	version, err := in.resolveAllowed(meta, constraint)
+	if err != nil || in.pick == nil {
+		return version, err
+	}
+	if _, ok := meta.DistTags[constraint]; ok {
+		return version, nil
+	}
+	versions := meta.candidates(constraint, version)
+	if len(versions) <= 1 {
+		return version, nil
+	}
+	in.pickMu.Lock()
+	defer in.pickMu.Unlock()
+	picked, err := in.pick(&VersionChoice{
+		Name:       meta.Name,
+		Constraint: constraint,
+		Versions:   versions,
+		Default:    version,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to pick a version for %s@%s: %w", meta.Name, constraint, err)
+	} else if picked == "" {
+		return version, nil
+	}
+	for _, candidate := range versions {
+		if candidate == picked {
+			return picked, nil
+		}
+	}
+	return "", fmt.Errorf("unable to pick %s for %s@%s because it doesn't satisfy the range", picked, meta.Name, constraint)
+}
+
+// candidates returns the versions that satisfy the constraint newest first,
+// along with the prereleases newer than the default version whose release
+// satisfies the constraint
+func (m *metadata) candidates(constraint, defaultVersion string) (candidates []string) {
+	checker, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil
+	}
+	current, err := semver.NewVersion(defaultVersion)
+	if err != nil {
+		return nil
+	}
+	versions := m.versions()
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		if version.Prerelease() != "" && version.GreaterThan(current) {
+			release, err := version.SetPrerelease("")
+			if err != nil || !checker.Check(&release) {
+				continue
+			}
+		} else if !checker.Check(version) {
+			continue
+		}
+		candidates = append(candidates, m.original(version.Original()))
+	}
+	return candidates
+}
@@ -0,0 +1,94 @@
+package npm_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestVersionPicker(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0":       {},
+		"uid@1.1.0":       {},
+		"uid@1.2.0-beta":  {},
+		"uid@2.0.0":       {},
+		"pinned@1.0.0":    {},
+		"pinned@1.0.1":    {},
+		"pinned@2.0.0-rc": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	var choices []*npm.VersionChoice
+	installer := npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithVersionPicker(func(choice *npm.VersionChoice) (string, error) {
+			choices = append(choices, choice)
+			if choice.Name == "pinned" {
+				return "", nil
+			}
+			return "1.0.0", nil
+		}),
+	)
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@^1.0.0", "pinned@1.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"1.0.0"}`)
+	is.Equal(len(choices), 1)
+	is.Equal(choices[0].Constraint, "^1.0.0")
+	is.Equal(choices[0].Default, "1.1.0")
+	is.Equal(strings.Join(choices[0].Versions, " "), "1.2.0-beta 1.1.0 1.0.0")
+	// Empty keeps the default
+	version, err := installer.Version(ctx, "pinned", "~1.0.0")
+	is.NoErr(err)
+	is.Equal(version, "1.0.1")
+	// Dist-tags aren't ambiguous
+	version, err = installer.Version(ctx, "uid", "latest")
+	is.NoErr(err)
+	is.Equal(version, "2.0.0")
+	is.Equal(len(choices), 2)
+	// Versions outside of the range are rejected
+	_, err = installer.Version(ctx, "uid", "^2.0.0 || ^1.1.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "doesn't satisfy the range"))
+	// Errors fail the resolution
+	installer = npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithVersionPicker(func(choice *npm.VersionChoice) (string, error) {
+			return "", errors.New("cancelled")
+		}),
+	)
+	_, err = installer.Version(ctx, "uid", "*")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "cancelled"))
+}
+
+func TestLogResolvedVersions(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+		"uid@2.0.2": {},
+	}))
+	defer server.Close()
+	logs := new(bytes.Buffer)
+	log := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithLogger(log))
+	version, err := installer.Version(context.Background(), "uid", "^2.0.0")
+	is.NoErr(err)
+	is.Equal(version, "2.0.2")
+	is.Equal(logs.String(), `level=INFO msg="npm: resolved uid ^2.0.0 -> 2.0.2" package=uid range=^2.0.0 version=2.0.2`+"\n")
+}
@@ -0,0 +1,101 @@
+package npm
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// WithLibc sets the C library packages are installed for, either "glibc" or
+// "musl". Native packages (e.g. esbuild's binaries) publish a variant for each
+// libc and list it in their package.json's libc field. Defaults to detecting
+// the host's libc on Linux, which is best-effort. When it can't be detected,
+// the libc field is ignored.
+func WithLibc(libc string) Option {
+	return func(in *Installer) {
+		in.libc = libc
+	}
+}
+
+// platform a package supports, from the os, cpu and libc fields of its
+// package.json. Entries starting with ! are excluded (e.g. !win32).
+type platform struct {
+	OS   []string `json:"os,omitempty"`
+	CPU  []string `json:"cpu,omitempty"`
+	Libc []string `json:"libc,omitempty"`
+}
+
+// checkPlatform returns an error if the package doesn't support the host
+func (in *Installer) checkPlatform(name, version string, p platform) error {
+	if !matchPlatform(nodeOS(runtime.GOOS), p.OS) {
+		return fmt.Errorf("npm: %s@%s doesn't support os %s, only %s", name, version, nodeOS(runtime.GOOS), strings.Join(p.OS, ", "))
+	} else if !matchPlatform(nodeCPU(runtime.GOARCH), p.CPU) {
+		return fmt.Errorf("npm: %s@%s doesn't support cpu %s, only %s", name, version, nodeCPU(runtime.GOARCH), strings.Join(p.CPU, ", "))
+	} else if in.libc != "" && !matchPlatform(in.libc, p.Libc) {
+		return fmt.Errorf("npm: %s@%s doesn't support libc %s, only %s", name, version, in.libc, strings.Join(p.Libc, ", "))
+	}
+	return nil
+}
+
+// matchPlatform returns true if the value isn't excluded and is in the list,
+// or the list only has exclusions
+func matchPlatform(value string, list []string) bool {
+	included, match := false, false
+	for _, item := range list {
+		if excluded, ok := strings.CutPrefix(item, "!"); ok {
+			if excluded == value {
+				return false
+			}
+			continue
+		}
+		included = true
+		if item == value {
+			match = true
+		}
+	}
+	return match || !included
+}
+
+// nodeOS returns Node's name for the operating system (process.platform)
+func nodeOS(goos string) string {
+	switch goos {
+	case "windows":
+		return "win32"
+	case "solaris", "illumos":
+		return "sunos"
+	default:
+		return goos
+	}
+}
+
+// nodeCPU returns Node's name for the architecture (process.arch)
+func nodeCPU(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x64"
+	case "386":
+		return "ia32"
+	case "ppc64le":
+		return "ppc64"
+	default:
+		return goarch
+	}
+}
+
+// detectLibc returns the host's libc by looking for its dynamic loader, or an
+// empty string if it's not Linux or can't tell
+func detectLibc() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	if matches, _ := filepath.Glob("/lib/ld-musl-*.so.1"); len(matches) > 0 {
+		return "musl"
+	}
+	for _, pattern := range []string{"/lib*/ld-linux*.so.*", "/lib/*/ld-linux*.so.*"} {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			return "glibc"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestPlatformLibc(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"native@1.0.0": {
+			"package.json": `{
+				"optionalDependencies": {
+					"native-gnu": "1.0.0",
+					"native-musl": "1.0.0",
+					"native-aix": "1.0.0"
+				}
+			}`,
+		},
+		"native-gnu@1.0.0": {
+			"package.json": `{"libc": ["glibc"]}`,
+		},
+		"native-musl@1.0.0": {
+			"package.json": `{"libc": ["musl"]}`,
+		},
+		"native-aix@1.0.0": {
+			"package.json": `{"os": ["aix"], "cpu": ["!x64", "!arm64"]}`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	// Only the variant for the libc is installed
+	dir := t.TempDir()
+	installer := npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithDependencyFields("dependencies", "optionalDependencies"),
+		npm.WithLibc("musl"),
+	)
+	is.NoErr(installer.Install(ctx, dir, "native@1.0.0"))
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, "node_modules", name, "package.json"))
+		return err == nil
+	}
+	is.True(exists("native"))
+	is.True(exists("native-musl"))
+	is.True(!exists("native-gnu"))
+	is.True(!exists("native-aix"))
+	// Required packages for another platform fail
+	installer = npm.New(npm.WithRegistry(server.URL), npm.WithLibc("glibc"))
+	err := installer.Install(ctx, t.TempDir(), "native-musl@1.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "native-musl@1.0.0 doesn't support libc glibc"))
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package npm
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// renameDir renames the directory
+func renameDir(from, to string) error {
+	return os.Rename(from, to)
+}
+
+// isCrossDevice returns true if the rename failed because the directories are
+// on different devices
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+package npm
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	errorAccessDenied     = syscall.Errno(5)  // ERROR_ACCESS_DENIED
+	errorNotSameDevice    = syscall.Errno(17) // ERROR_NOT_SAME_DEVICE
+	errorSharingViolation = syscall.Errno(32) // ERROR_SHARING_VIOLATION
+)
+
+// renameDir renames the directory. Windows doesn't allow renaming a directory
+// while a file within it is open, which is common while antivirus scanners and
+// indexers look at freshly extracted files, so the rename is retried for a
+// while. Renaming over an existing directory fails right away, so the caller
+// can move it out of the way.
+func renameDir(from, to string) (err error) {
+	for delay := 10 * time.Millisecond; delay <= time.Second; delay *= 2 {
+		err = os.Rename(from, to)
+		if err == nil || !errors.Is(err, errorSharingViolation) && !errors.Is(err, errorAccessDenied) {
+			return err
+		}
+		if _, statErr := os.Lstat(to); statErr == nil {
+			return err
+		}
+		time.Sleep(delay)
+	}
+	return err
+}
+
+// isCrossDevice returns true if the rename failed because the directories are
+// on different volumes
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,347 @@
+package npm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Tree is a resolved dependency tree. Nodes are keyed by name@version and
+// point to their dependencies by key, so the tree can be walked without
+// worrying about cycles.
+type Tree struct {
+	// Roots are the keys of the requested packages
+	Roots []string `json:"roots,omitempty"`
+	// Nodes are every resolved package, keyed by name@version
+	Nodes map[string]*Node `json:"nodes,omitempty"`
+
+	mu  sync.Mutex
+	dir string
+	// specs are the requested specs with globs expanded, in the order of Roots
+	specs         []string
+	packages      map[string]*remotePackage
+	metadataSizes map[string]int64
+}
+
+// Node is a resolved package in the tree
+type Node struct {
+	Name      string `json:"name,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Tarball   string `json:"tarball,omitempty"`
+	Integrity string `json:"integrity,omitempty"`
+	// UnpackedSize is the size of the package's files in bytes, when the
+	// registry lists it
+	UnpackedSize int64 `json:"unpackedSize,omitempty"`
+	// Dependencies maps each dependency's name to its key in the tree
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+func (n *Node) key() string {
+	return n.Name + "@" + n.Version
+}
+
+// JSON encodes the tree as indented JSON. Keys are sorted, so the output is
+// the same across runs.
+func (t *Tree) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to marshal tree: %w", err)
+	}
+	return data, nil
+}
+
+// DOT renders the tree as a Graphviz graph, with the requested packages drawn
+// as boxes. Nodes and edges are sorted, so the output is the same across runs.
+func (t *Tree) DOT() string {
+	keys := make([]string, 0, len(t.Nodes))
+	for key := range t.Nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	roots := map[string]bool{}
+	for _, root := range t.Roots {
+		roots[root] = true
+	}
+	out := new(strings.Builder)
+	out.WriteString("digraph npm {\n")
+	for _, key := range keys {
+		if roots[key] {
+			fmt.Fprintf(out, "  %q [shape=box];\n", key)
+			continue
+		}
+		fmt.Fprintf(out, "  %q;\n", key)
+	}
+	for _, key := range keys {
+		deps := t.Nodes[key].Dependencies
+		names := make([]string, 0, len(deps))
+		for name := range deps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "  %q -> %q;\n", key, deps[name])
+		}
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// Resolve the dependency tree of the packages without downloading or
+// installing anything. Only the registry metadata is fetched.
+func Resolve(ctx context.Context, packages ...string) (*Tree, error) {
+	return defaultInstaller.Resolve(ctx, packages...)
+}
+
+// Resolve the dependency tree of the packages without downloading or
+// installing anything.
+func (in *Installer) Resolve(ctx context.Context, packages ...string) (*Tree, error) {
+	tree, err := in.resolveTree(ctx, "", nil, packages...)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to resolve: %w", err)
+	}
+	return tree, nil
+}
+
+// ResolveTree resolves the dependency tree of the packages like Install would
+// install them into dir, without downloading or installing anything. The
+// overrides and resolutions in dir/package.json are applied, and when no
+// packages are passed in, its dependencies are resolved. Every node has the
+// tarball URL and integrity from the registry, which is enough to write a
+// lockfile or download the tarballs separately.
+func ResolveTree(ctx context.Context, dir string, packages ...string) (*Tree, error) {
+	return defaultInstaller.ResolveTree(ctx, dir, packages...)
+}
+
+// ResolveTree resolves the dependency tree of the packages like Install would
+// install them into dir.
+func (in *Installer) ResolveTree(ctx context.Context, dir string, packages ...string) (*Tree, error) {
+	if len(packages) == 0 {
+		deps, err := in.rootDependencies(dir)
+		if err != nil {
+			return nil, fmt.Errorf("npm: unable to resolve: %w", err)
+		}
+		packages = deps
+	}
+	overrides, err := in.readOverrides(dir)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := in.resolveTree(ctx, dir, overrides, packages...)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to resolve: %w", err)
+	}
+	return tree, nil
+}
+
+// resolveTree resolves the packages and their dependencies. Local packages are
+// relative to dir and local globs are resolved as each package they match.
+func (in *Installer) resolveTree(ctx context.Context, dir string, overrides *overrides, packages ...string) (*Tree, error) {
+	specs, err := in.expandGlobs(dir, packages)
+	if err != nil {
+		return nil, err
+	}
+	tree := &Tree{
+		Roots:         make([]string, len(specs)),
+		Nodes:         map[string]*Node{},
+		dir:           dir,
+		specs:         specs,
+		packages:      map[string]*remotePackage{},
+		metadataSizes: map[string]int64{},
+	}
+	eg := new(errgroup.Group)
+	for i, pkgname := range specs {
+		eg.Go(func() error {
+			key, err := in.resolveNode(ctx, tree, pkgname, 0, overrides)
+			if err != nil {
+				return err
+			}
+			tree.Roots[i] = key
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// expandGlobs replaces the local globs in packages with the absolute paths of
+// the packages they match
+func (in *Installer) expandGlobs(dir string, packages []string) ([]string, error) {
+	specs := make([]string, 0, len(packages))
+	for _, pkgname := range packages {
+		spec, err := ParseSpec(pkgname)
+		if err != nil {
+			return nil, err
+		} else if (spec.Type != SpecLocal && spec.Type != SpecAbsolute) || !isGlob(spec.Path) {
+			specs = append(specs, pkgname)
+			continue
+		}
+		s := &session{in: in, dir: dir}
+		group, err := s.resolveLocalGlob(spec.Path)
+		if err != nil {
+			return nil, err
+		} else if len(group.Broken) > 0 {
+			return nil, fmt.Errorf("npm: unable to resolve %d of the packages matching %s:\n%w", len(group.Broken), spec.Path, errors.Join(group.Broken...))
+		}
+		for _, pkg := range group.Packages {
+			pkgPath, err := filepath.Abs(pkg.Path)
+			if err != nil {
+				return nil, err
+			}
+			specs = append(specs, pkgPath)
+		}
+	}
+	return specs, nil
+}
+
+// resolveNode resolves a package into the tree along with its dependencies,
+// returning its key. Overrides are applied like in session.install and
+// optional dependencies that fail to resolve are skipped.
+func (in *Installer) resolveNode(ctx context.Context, tree *Tree, pkgname string, depth int, overrides *overrides) (string, error) {
+	node, deps, err := in.resolveSpec(ctx, tree, pkgname)
+	if err != nil {
+		return "", err
+	}
+	// Overrides match the version that was originally resolved
+	nested := overrides.enter(node.Name, node.Version)
+	if remote := node.Tarball != ""; remote {
+		if version, ok := overrides.version(node.Name, node.Version); ok && depth > 0 && version != node.Version {
+			if node, deps, err = in.resolveSpec(ctx, tree, node.Name+"@"+version); err != nil {
+				return "", err
+			}
+		}
+	}
+	key := node.key()
+	tree.mu.Lock()
+	if _, ok := tree.Nodes[key]; ok {
+		tree.mu.Unlock()
+		return key, nil
+	}
+	tree.Nodes[key] = node
+	tree.mu.Unlock()
+	if in.maxDepth >= 0 && depth >= in.maxDepth {
+		return key, nil
+	}
+	resolveDep := func(dep, version string) error {
+		depKey, err := in.resolveNode(ctx, tree, dep+"@"+version, depth+1, nested)
+		if err != nil {
+			return err
+		}
+		tree.mu.Lock()
+		if node.Dependencies == nil {
+			node.Dependencies = map[string]string{}
+		}
+		node.Dependencies[dep] = depKey
+		tree.mu.Unlock()
+		return nil
+	}
+	eg := new(errgroup.Group)
+	for dep, version := range deps.Required {
+		eg.Go(func() error {
+			return resolveDep(dep, version)
+		})
+	}
+	for dep, version := range deps.Optional {
+		eg.Go(func() error {
+			resolveDep(dep, version)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// resolveSpec resolves a package spec to a node and its dependencies like
+// resolvePackage. GitHub packages are leaves named after their alias or
+// repository, since their package.json is only known once they're downloaded.
+func (in *Installer) resolveSpec(ctx context.Context, tree *Tree, pkgname string) (*Node, *dependencies, error) {
+	spec, err := ParseSpec(pkgname)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch spec.Type {
+	case SpecLocal, SpecAbsolute:
+		if isGlob(spec.Path) {
+			return nil, nil, fmt.Errorf("npm: unable to resolve %s because only the packages passed in can be globs", pkgname)
+		}
+		pkgPath := spec.Path
+		if spec.Type == SpecLocal {
+			pkgPath = filepath.Join(tree.dir, spec.Path)
+		}
+		return in.resolveLocal(pkgPath)
+	case SpecGitHub:
+		pkg := &githubPackage{Alias: spec.Alias, Repo: spec.Repo, Ref: spec.Ref, Subdir: spec.Subdir}
+		name := spec.Alias
+		if name == "" {
+			name = path.Base(spec.Repo)
+		}
+		return &Node{Name: name, Version: pkg.String()}, new(dependencies), nil
+	case SpecWorkspace:
+		workspaces, err := in.readWorkspaces(tree.dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		pkg, err := findWorkspace(workspaces, spec.Name, spec.Version)
+		if err != nil {
+			return nil, nil, err
+		}
+		return in.resolveLocal(pkg.Path)
+	}
+	meta, err := in.metadataFor(ctx, spec.Name, spec.Version)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to resolve versions for %s: %w", spec.Name, err)
+	}
+	version, err := in.resolve(meta, spec.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	deps, err := in.readDependencies(meta.Versions[version].manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read dependencies for %s@%s: %w", spec.Name, version, err)
+	}
+	pkg := in.newRemotePackage(spec.Name, meta, version)
+	node := &Node{
+		Name:      spec.Name,
+		Version:   version,
+		Tarball:   pkg.url(),
+		Integrity: pkg.Integrity,
+	}
+	if dist := meta.Versions[version].Dist; dist != nil {
+		node.UnpackedSize = dist.UnpackedSize
+	}
+	tree.mu.Lock()
+	tree.packages[node.key()] = pkg
+	tree.metadataSizes[spec.Name] = meta.size
+	tree.mu.Unlock()
+	return node, deps, nil
+}
+
+// resolveLocal resolves the local package in dir to a node and its
+// dependencies
+func (in *Installer) resolveLocal(dir string) (*Node, *dependencies, error) {
+	manifestJSON, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read package.json: %w", err)
+	}
+	var manifest Manifest
+	if err := in.unmarshalManifest(manifestJSON, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("unable to unmarshal package.json in %s: %w", dir, err)
+	}
+	deps, err := in.readDependencies(manifestJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read dependencies for %s: %w", dir, err)
+	}
+	return &Node{Name: manifest.Name, Version: manifest.Version}, deps, nil
+}
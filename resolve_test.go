@@ -0,0 +1,125 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestResolve(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+		"uid@2.1.0": {},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"~2.0.0"}}`,
+		},
+	}))
+	defer server.Close()
+	tree, err := npm.New(npm.WithRegistry(server.URL)).Resolve(context.Background(), "@lukeed/uuid@^2.0.0", "uid@*")
+	is.NoErr(err)
+	is.Equal(tree.Roots, []string{"@lukeed/uuid@2.0.1", "uid@2.1.0"})
+	is.Equal(len(tree.Nodes), 3)
+	uuid := tree.Nodes["@lukeed/uuid@2.0.1"]
+	is.Equal(uuid.Dependencies["uid"], "uid@2.0.0")
+	is.True(uuid.Integrity != "")
+	is.Equal(uuid.Tarball, server.URL+"/@lukeed/uuid/-/uuid-2.0.1.tgz")
+}
+
+func TestTreeExport(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+		"b@1.0.0": {
+			"package.json": `{"name":"b","version":"1.0.0","dependencies":{"uid":"2"}}`,
+		},
+		"a@1.0.0": {
+			"package.json": `{"name":"a","version":"1.0.0","dependencies":{"uid":"2","b":"1"}}`,
+		},
+	}))
+	defer server.Close()
+	tree, err := npm.New(npm.WithRegistry(server.URL)).Resolve(context.Background(), "a@1")
+	is.NoErr(err)
+	is.Equal(tree.DOT(), `digraph npm {
+  "a@1.0.0" [shape=box];
+  "b@1.0.0";
+  "uid@2.0.0";
+  "a@1.0.0" -> "b@1.0.0";
+  "a@1.0.0" -> "uid@2.0.0";
+  "b@1.0.0" -> "uid@2.0.0";
+}
+`)
+	data, err := tree.JSON()
+	is.NoErr(err)
+	var decoded struct {
+		Roots []string `json:"roots"`
+		Nodes map[string]struct {
+			Version      string            `json:"version"`
+			Dependencies map[string]string `json:"dependencies"`
+		} `json:"nodes"`
+	}
+	is.NoErr(json.Unmarshal(data, &decoded))
+	is.Equal(decoded.Roots, []string{"a@1.0.0"})
+	is.Equal(decoded.Nodes["a@1.0.0"].Dependencies, map[string]string{"b": "b@1.0.0", "uid": "uid@2.0.0"})
+	// The output is stable
+	again, err := tree.JSON()
+	is.NoErr(err)
+	is.Equal(string(data), string(again))
+}
+
+func TestResolveTree(t *testing.T) {
+	is := is.New(t)
+	server := overridesRegistry(t)
+	defer server.Close()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json": `{"dependencies":{"a":"^1.0.0"},"overrides":{"a":{"b":"1.0.0","c":"2.0.0"}}}`,
+	}))
+	tree, err := npm.New(npm.WithRegistry(server.URL)).ResolveTree(context.Background(), dir)
+	is.NoErr(err)
+	is.Equal(tree.Roots, []string{"a@1.0.0"})
+	is.Equal(tree.Nodes["a@1.0.0"].Dependencies["b"], "b@1.0.0")
+	b := tree.Nodes["b@1.0.0"]
+	is.Equal(b.Dependencies["c"], "c@2.0.0")
+	is.Equal(b.Tarball, server.URL+"/b/-/b-1.0.0.tgz")
+	is.True(b.Integrity != "")
+	is.Equal(len(tree.Nodes), 3)
+}
+
+func TestResolveTreeSpecs(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{"name":"a","version":"1.0.0","dependencies":{"gh":"github:user/gh"},"optionalDependencies":{"b":"^1.0.0","missing":"^1.0.0"}}`,
+		},
+		"b@1.0.0": {},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"packages/ui/package.json": `{"name":"ui","version":"1.0.0","dependencies":{"a":"^1.0.0"}}`,
+	}))
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithDependencyFields("dependencies", "optionalDependencies"))
+	tree, err := installer.ResolveTree(context.Background(), dir, "./packages/*")
+	is.NoErr(err)
+	is.Equal(tree.Roots, []string{"ui@1.0.0"})
+	// Optional dependencies are resolved when they're configured and skipped
+	// when they're missing
+	a := tree.Nodes["a@1.0.0"]
+	is.Equal(a.Dependencies["b"], "b@1.0.0")
+	is.Equal(a.Dependencies["missing"], "")
+	// GitHub packages are leaves
+	is.Equal(a.Dependencies["gh"], "gh@github:user/gh")
+	is.Equal(tree.Nodes["gh@github:user/gh"].Tarball, "")
+	// Only the dependencies are resolved by default
+	tree, err = npm.New(npm.WithRegistry(server.URL)).ResolveTree(context.Background(), dir, "./packages/*")
+	is.NoErr(err)
+	is.Equal(tree.Nodes["a@1.0.0"].Dependencies["b"], "")
+	// Invalid specs fail
+	_, err = installer.ResolveTree(context.Background(), dir, "git+https://example.com/repo.git")
+	is.True(err != nil)
+}
@@ -0,0 +1,82 @@
+package npm
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+)
+
+// InstallResult describes what was installed
+type InstallResult struct {
+	// Packages are every installed package, sorted by name and version
+	Packages []*InstalledPackage
+}
+
+// InstalledPackage is a package that was installed
+type InstalledPackage struct {
+	Name    string
+	Version string
+	// Tag is the dist-tag the version was resolved from (e.g. latest), which
+	// explains why a later install of the same spec picks a different version
+	Tag string
+	// Dir is where the package was installed
+	Dir string
+	// Timings of installing the package. They're zero for local packages.
+	Timings Timings
+	// Scripts are the lifecycle scripts the package declares, which aren't run
+	Scripts map[string]string
+}
+
+// Timings are how long each phase of installing a package took
+type Timings struct {
+	// Resolve is how long resolving the version took, including fetching the
+	// package's metadata
+	Resolve time.Duration
+	// Download is how long reading the tarball took, whether it came from the
+	// registry, the cache or the vendor directory
+	Download time.Duration
+	// Extract is how long extracting the tarball and moving the package into
+	// place took
+	Extract time.Duration
+}
+
+// timedReader measures how long reading takes
+type timedReader struct {
+	r       io.Reader
+	elapsed time.Duration
+}
+
+func (t *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.r.Read(p)
+	t.elapsed += time.Since(start)
+	return n, err
+}
+
+// InstallWithResult installs packages like Install, returning what was
+// installed.
+func InstallWithResult(ctx context.Context, dir string, packages ...string) (*InstallResult, error) {
+	return defaultInstaller.InstallWithResult(ctx, dir, packages...)
+}
+
+// record an installed package in the result
+func (s *session) record(pkg *InstalledPackage) {
+	s.mu.Lock()
+	s.installed = append(s.installed, pkg)
+	s.mu.Unlock()
+}
+
+// result returns what was installed
+func (s *session) result() *InstallResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	packages := append([]*InstalledPackage(nil), s.installed...)
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return packages[i].Version < packages[j].Version
+	})
+	return &InstallResult{Packages: packages}
+}
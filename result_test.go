@@ -0,0 +1,72 @@
+package npm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestInstallResultTag(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+		"uid@2.0.2": {},
+		"@lukeed/uuid@2.0.0": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.0","dependencies":{"uid":"^2.0.0"}}`,
+		},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"^2.0.0"}}`,
+		},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	result, err := installer.InstallWithResult(context.Background(), dir, "@lukeed/uuid@latest")
+	is.NoErr(err)
+	is.Equal(len(result.Packages), 2)
+	for _, pkg := range result.Packages {
+		pkg.Timings = npm.Timings{}
+	}
+	is.Equal(result.Packages[0], &npm.InstalledPackage{
+		Name:    "@lukeed/uuid",
+		Version: "2.0.1",
+		Tag:     "latest",
+		Dir:     filepath.Join(dir, "node_modules", "@lukeed", "uuid"),
+	})
+	is.Equal(result.Packages[1], &npm.InstalledPackage{
+		Name:    "uid",
+		Version: "2.0.2",
+		Dir:     filepath.Join(dir, "node_modules", "uid"),
+	})
+}
+
+func TestInstallResultTimings(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			time.Sleep(30 * time.Millisecond)
+		} else {
+			time.Sleep(20 * time.Millisecond)
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	result, err := installer.InstallWithResult(context.Background(), t.TempDir(), "uid@2.0.0")
+	is.NoErr(err)
+	is.Equal(len(result.Packages), 1)
+	timings := result.Packages[0].Timings
+	is.True(timings.Resolve >= 20*time.Millisecond)
+	is.True(timings.Download >= 30*time.Millisecond)
+	is.True(timings.Extract > 0)
+}
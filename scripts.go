@@ -0,0 +1,80 @@
+package npm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// lifecycleScripts are the scripts npm runs when installing a package
+var lifecycleScripts = []string{"preinstall", "install", "postinstall"}
+
+// LifecycleScripts are the install scripts an installed package declares.
+// They're never run, but they're a common way to attack the supply chain.
+type LifecycleScripts struct {
+	Name    string
+	Version string
+	// Scripts by lifecycle event (e.g. postinstall). Packages with a
+	// binding.gyp and no install script get npm's implicit "node-gyp rebuild".
+	Scripts map[string]string
+}
+
+func (l *LifecycleScripts) String() string {
+	events := make([]string, 0, len(l.Scripts))
+	for event := range l.Scripts {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return fmt.Sprintf("%s@%s (%s)", l.Name, l.Version, strings.Join(events, ", "))
+}
+
+// WithLifecycleScripts calls approve for every installed package that has
+// preinstall, install or postinstall scripts, before its dependencies are
+// installed. Returning an error rejects the package and fails the install.
+// Calls are never concurrent.
+func WithLifecycleScripts(approve func(scripts *LifecycleScripts) error) Option {
+	return func(in *Installer) {
+		in.approveScripts = approve
+	}
+}
+
+// readScripts reads the lifecycle scripts of the package in dir
+func (in *Installer) readScripts(dir string, manifest []byte) (map[string]string, error) {
+	var pkg struct {
+		Scripts map[string]string `json:"scripts,omitempty"`
+	}
+	if err := in.unmarshalManifest(manifest, &pkg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal scripts in package.json: %w", err)
+	}
+	scripts := map[string]string{}
+	for _, event := range lifecycleScripts {
+		if script := pkg.Scripts[event]; script != "" {
+			scripts[event] = script
+		}
+	}
+	// npm builds native addons when there's no install script
+	if scripts["install"] == "" && scripts["preinstall"] == "" {
+		if _, err := os.Stat(filepath.Join(dir, "binding.gyp")); err == nil {
+			scripts["install"] = "node-gyp rebuild"
+		}
+	}
+	if len(scripts) == 0 {
+		return nil, nil
+	}
+	return scripts, nil
+}
+
+// approveScripts asks for approval when the package has lifecycle scripts
+func (s *session) approveScripts(name, version string, scripts map[string]string) error {
+	if s.in.approveScripts == nil || len(scripts) == 0 {
+		return nil
+	}
+	s.scriptsMu.Lock()
+	defer s.scriptsMu.Unlock()
+	if err := s.in.approveScripts(&LifecycleScripts{name, version, scripts}); err != nil {
+		return fmt.Errorf("npm: rejected the lifecycle scripts of %s@%s: %w", name, version, err)
+	}
+	return nil
+}
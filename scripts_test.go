@@ -0,0 +1,56 @@
+package npm_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestLifecycleScripts(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"app@1.0.0": {
+			"package.json": `{
+				"dependencies": {"native": "1.0.0", "plain": "1.0.0"},
+				"scripts": {"postinstall": "node hack.js", "test": "node test.js"}
+			}`,
+		},
+		"native@1.0.0": {
+			"binding.gyp": `{"targets": []}`,
+		},
+		"plain@1.0.0": {
+			"package.json": `{"scripts": {"build": "tsc"}}`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	var approved []string
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithLifecycleScripts(func(scripts *npm.LifecycleScripts) error {
+		approved = append(approved, scripts.String())
+		return nil
+	}))
+	result, err := installer.InstallWithResult(ctx, t.TempDir(), "app@1.0.0")
+	is.NoErr(err)
+	is.Equal(len(result.Packages), 3)
+	is.Equal(result.Packages[0].Scripts, map[string]string{"postinstall": "node hack.js"})
+	is.Equal(result.Packages[1].Scripts, map[string]string{"install": "node-gyp rebuild"})
+	is.Equal(result.Packages[2].Scripts, nil)
+	is.Equal(len(approved), 2)
+	is.Equal(approved[0], "app@1.0.0 (postinstall)")
+	is.Equal(approved[1], "native@1.0.0 (install)")
+	// Rejecting a package's scripts fails the install
+	installer = npm.New(npm.WithRegistry(server.URL), npm.WithLifecycleScripts(func(scripts *npm.LifecycleScripts) error {
+		if scripts.Name == "native" {
+			return errors.New("native addons aren't allowed")
+		}
+		return nil
+	}))
+	err = installer.Install(ctx, t.TempDir(), "app@1.0.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "rejected the lifecycle scripts of native@1.0.0: native addons aren't allowed"))
+}
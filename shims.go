@@ -0,0 +1,186 @@
+package npm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// WithBinShims writes shims into node_modules/.bin instead of symlinks, like
+// npm does on Windows with cmd-shim. Each executable gets a shell script, a
+// .cmd and a .ps1 that run the package's script through the program in its
+// shebang (e.g. node). Defaults to true on Windows.
+func WithBinShims(enabled bool) Option {
+	return func(in *Installer) {
+		in.binShims = enabled
+	}
+}
+
+// defaultBinShims is true where symlinks aren't usable
+var defaultBinShims = runtime.GOOS == "windows"
+
+// shebang matches the program and arguments of a script's shebang, skipping
+// /usr/bin/env
+var shebang = regexp.MustCompile(`^#!\s*(?:/usr/bin/env\s+(?:-S\s+)?)?(\S+)\s*(.*)$`)
+
+// readShebang returns the program and arguments from the script's shebang,
+// or an empty program when it doesn't have one
+func readShebang(scriptPath string) (prog, args string) {
+	file, err := os.Open(scriptPath)
+	if err != nil {
+		return "", ""
+	}
+	defer file.Close()
+	line, _ := bufio.NewReader(file).ReadString('\n')
+	match := shebang.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if match == nil {
+		return "", ""
+	}
+	return path.Base(match[1]), strings.TrimSpace(match[2])
+}
+
+// writeShims writes the shims for the executable at targetPath into
+// binDir/name, binDir/name.cmd and binDir/name.ps1
+func writeShims(binDir, name, targetPath string) error {
+	rel, err := filepath.Rel(binDir, targetPath)
+	if err != nil {
+		return err
+	}
+	target := filepath.ToSlash(rel)
+	prog, args := readShebang(targetPath)
+	shims := map[string]string{
+		name:          shShim(prog, args, target),
+		name + ".cmd": cmdShim(prog, args, strings.ReplaceAll(target, "/", `\`)),
+		name + ".ps1": ps1Shim(prog, args, target),
+	}
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return err
+	}
+	for shim, code := range shims {
+		shimPath := filepath.Join(binDir, shim)
+		// Replace links from before shims were enabled
+		if err := os.Remove(shimPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := os.WriteFile(shimPath, []byte(code), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shShim(prog, args, target string) string {
+	code := "#!/bin/sh\n" +
+		"basedir=$(dirname \"$(echo \"$0\" | sed -e 's,\\\\,/,g')\")\n\n" +
+		"case `uname` in\n" +
+		"    *CYGWIN*|*MINGW*|*MSYS*)\n" +
+		"        if command -v cygpath > /dev/null 2>&1; then\n" +
+		"            basedir=`cygpath -w \"$basedir\"`\n" +
+		"        fi\n" +
+		"    ;;\n" +
+		"esac\n\n"
+	if prog == "" {
+		return code + fmt.Sprintf("exec \"$basedir/%s\"   \"$@\"\n", target)
+	}
+	return code + fmt.Sprintf("if [ -x \"$basedir/%[1]s\" ]; then\n"+
+		"  exec \"$basedir/%[1]s\" %[2]s \"$basedir/%[3]s\" \"$@\"\n"+
+		"else \n"+
+		"  exec %[1]s %[2]s \"$basedir/%[3]s\" \"$@\"\n"+
+		"fi\n", prog, args, target)
+}
+
+func cmdShim(prog, args, target string) string {
+	code := "@ECHO off\r\n" +
+		"GOTO start\r\n" +
+		":find_dp0\r\n" +
+		"SET dp0=%~dp0\r\n" +
+		"EXIT /b\r\n" +
+		":start\r\n" +
+		"SETLOCAL\r\n" +
+		"CALL :find_dp0\r\n\r\n"
+	if prog == "" {
+		return code + fmt.Sprintf("\"%%dp0%%\\%s\"   %%*\r\n", target)
+	}
+	return code + fmt.Sprintf("IF EXIST \"%%dp0%%\\%[1]s.exe\" (\r\n"+
+		"  SET \"_prog=%%dp0%%\\%[1]s.exe\"\r\n"+
+		") ELSE (\r\n"+
+		"  SET \"_prog=%[1]s\"\r\n"+
+		"  SET PATHEXT=%%PATHEXT:;.JS;=;%%\r\n"+
+		")\r\n\r\n"+
+		"endLocal & goto #_undefined_# 2>NUL || title %%COMSPEC%% & \"%%_prog%%\" %[2]s \"%%dp0%%\\%[3]s\" %%*\r\n", prog, args, target)
+}
+
+func ps1Shim(prog, args, target string) string {
+	code := "#!/usr/bin/env pwsh\n" +
+		"$basedir=Split-Path $MyInvocation.MyCommand.Definition -Parent\n\n"
+	if prog == "" {
+		return code + fmt.Sprintf("# Support pipeline input\n"+
+			"if ($MyInvocation.ExpectingInput) {\n"+
+			"  $input | & \"$basedir/%[1]s\"   $args\n"+
+			"} else {\n"+
+			"  & \"$basedir/%[1]s\"   $args\n"+
+			"}\n"+
+			"exit $LASTEXITCODE\n", target)
+	}
+	return code + fmt.Sprintf("$exe=\"\"\n"+
+		"if ($PSVersionTable.PSVersion -lt \"6.0\" -or $IsWindows) {\n"+
+		"  # Fix case when both the Windows and Linux builds of Node\n"+
+		"  # are installed in the same directory\n"+
+		"  $exe=\".exe\"\n"+
+		"}\n"+
+		"$ret=0\n"+
+		"if (Test-Path \"$basedir/%[1]s$exe\") {\n"+
+		"  # Support pipeline input\n"+
+		"  if ($MyInvocation.ExpectingInput) {\n"+
+		"    $input | & \"$basedir/%[1]s$exe\" %[2]s \"$basedir/%[3]s\" $args\n"+
+		"  } else {\n"+
+		"    & \"$basedir/%[1]s$exe\" %[2]s \"$basedir/%[3]s\" $args\n"+
+		"  }\n"+
+		"  $ret=$LASTEXITCODE\n"+
+		"} else {\n"+
+		"  # Support pipeline input\n"+
+		"  if ($MyInvocation.ExpectingInput) {\n"+
+		"    $input | & \"%[1]s$exe\" %[2]s \"$basedir/%[3]s\" $args\n"+
+		"  } else {\n"+
+		"    & \"%[1]s$exe\" %[2]s \"$basedir/%[3]s\" $args\n"+
+		"  }\n"+
+		"  $ret=$LASTEXITCODE\n"+
+		"}\n"+
+		"exit $ret\n", prog, args, target)
+}
+
+// shimTargetPattern matches the target in a shell shim
+var shimTargetPattern = regexp.MustCompile(`"\$basedir/([^"]+)"\s+"\$@"`)
+
+// shimTarget returns the path of the executable a shell shim runs, or false
+// if the file isn't a shim
+func shimTarget(shimPath string) (string, bool) {
+	if filepath.Ext(shimPath) != "" {
+		return "", false
+	}
+	code, err := os.ReadFile(shimPath)
+	if err != nil || !strings.HasPrefix(string(code), "#!/bin/sh\nbasedir=") {
+		return "", false
+	}
+	match := shimTargetPattern.FindAllStringSubmatch(string(code), -1)
+	if match == nil {
+		return "", false
+	}
+	return filepath.Join(filepath.Dir(shimPath), filepath.FromSlash(match[len(match)-1][1])), true
+}
+
+// removeShims removes the shell shim along with its .cmd and .ps1
+func removeShims(shimPath string) error {
+	for _, ext := range []string{"", ".cmd", ".ps1"} {
+		if err := os.Remove(shimPath + ext); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package npm
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// WithStripSourceMaps removes source maps from installed packages to shrink
+// node_modules for production. Extracted .map files are removed, along with
+// the //# sourceMappingURL comments that point to them in JavaScript files.
+// It applies to the files kept by WithFilter.
+func WithStripSourceMaps() Option {
+	return func(in *Installer) {
+		in.stripMaps = true
+	}
+}
+
+// sourceMappingURL matches the comment lines that link a source map
+var sourceMappingURL = regexp.MustCompile(`(?m)^[ \t]*//[#@][ \t]*sourceMappingURL=.*(\r?\n)?`)
+
+// stripSourceMaps removes the source maps from the package in dir
+func (in *Installer) stripSourceMaps(dir string) error {
+	if !in.stripMaps {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(fpath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if de.IsDir() {
+			// Leave nested packages alone
+			if de.Name() == "node_modules" && fpath != dir {
+				return fs.SkipDir
+			}
+			return nil
+		} else if !de.Type().IsRegular() {
+			return nil
+		}
+		switch filepath.Ext(fpath) {
+		case ".map":
+			if err := os.Remove(fpath); err != nil {
+				return fmt.Errorf("unable to remove source map %s: %w", fpath, err)
+			}
+			return nil
+		case ".js", ".mjs", ".cjs":
+			return stripSourceMappingURL(fpath)
+		}
+		return nil
+	})
+}
+
+// stripSourceMappingURL removes the sourceMappingURL comments from the file.
+// The file is replaced rather than written in place, since it may be linked
+// from the store.
+func stripSourceMappingURL(fpath string) error {
+	code, err := os.ReadFile(fpath)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", fpath, err)
+	} else if !bytes.Contains(code, []byte("sourceMappingURL=")) {
+		return nil
+	}
+	stripped := sourceMappingURL.ReplaceAll(code, nil)
+	if len(stripped) == len(code) {
+		return nil
+	}
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return fmt.Errorf("unable to stat %s: %w", fpath, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fpath), "."+filepath.Base(fpath)+"-")
+	if err != nil {
+		return fmt.Errorf("unable to strip %s: %w", fpath, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(stripped); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to strip %s: %w", fpath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to strip %s: %w", fpath, err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("unable to strip %s: %w", fpath, err)
+	}
+	if err := os.Rename(tmp.Name(), fpath); err != nil {
+		return fmt.Errorf("unable to strip %s: %w", fpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestStripSourceMaps(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js":         "export const uid = \"uid\"\n//# sourceMappingURL=index.js.map\n",
+			"index.js.map":     `{"version":3}`,
+			"index.mjs":        "export const uid = \"uid\"\r\n//# sourceMappingURL=data:application/json;base64,e30=",
+			"lib/util.cjs":     "module.exports = 1\n//@ sourceMappingURL=util.cjs.map\n",
+			"lib/util.cjs.map": `{"version":3}`,
+			"readme.md":        "//# sourceMappingURL=kept.map\n",
+			"string.js":        "const s = \"//# sourceMappingURL=kept\"\n",
+		},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithStripSourceMaps())
+	is.NoErr(installer.Install(context.Background(), dir, "uid@2.0.0"))
+	pkgDir := filepath.Join(dir, "node_modules", "uid")
+	equals(t, filepath.Join(pkgDir, "index.js"), "export const uid = \"uid\"\n")
+	equals(t, filepath.Join(pkgDir, "index.mjs"), "export const uid = \"uid\"\r\n")
+	equals(t, filepath.Join(pkgDir, "lib", "util.cjs"), "module.exports = 1\n")
+	equals(t, filepath.Join(pkgDir, "readme.md"), "//# sourceMappingURL=kept.map\n")
+	equals(t, filepath.Join(pkgDir, "string.js"), "const s = \"//# sourceMappingURL=kept\"\n")
+	notExists(t, filepath.Join(pkgDir, "index.js.map"))
+	notExists(t, filepath.Join(pkgDir, "lib", "util.cjs.map"))
+}
@@ -0,0 +1,170 @@
+package npm
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// SpecType is what a package spec refers to
+type SpecType int
+
+const (
+	// SpecVersion is an exact version in the registry (e.g. preact@10.0.0)
+	SpecVersion SpecType = iota + 1
+	// SpecRange is a range of versions in the registry (e.g. preact@^10.0.0)
+	SpecRange
+	// SpecTag is a dist-tag in the registry (e.g. preact@latest)
+	SpecTag
+	// SpecLocal is a directory relative to where the package is installed
+	// (e.g. ./packages/*)
+	SpecLocal
+	// SpecAbsolute is an absolute directory (e.g. /src/ui)
+	SpecAbsolute
+	// SpecWorkspace is a package in the workspace (e.g. ui@workspace:*)
+	SpecWorkspace
+	// SpecGitHub is a package in a GitHub repository (e.g. github:user/repo)
+	SpecGitHub
+)
+
+// Spec is a parsed package spec
+type Spec struct {
+	// Type is what the spec refers to
+	Type SpecType
+	// Name is the package's name, including its scope. It's empty for local,
+	// absolute and GitHub specs, whose name comes from their package.json.
+	Name string
+	// Scope is the package's scope (e.g. @lukeed), if any
+	Scope string
+	// Alias is the name to install the package under (e.g. react17 in
+	// react17@npm:react@^17), if any
+	Alias string
+	// Version is the version, range or dist-tag, or the workspace protocol's
+	// version (e.g. workspace:^)
+	Version string
+	// Path is the directory of local and absolute specs
+	Path string
+	// Repo is the user/repo of GitHub specs
+	Repo string
+	// Ref is the branch, tag or commit of GitHub specs
+	Ref string
+	// Subdir is the directory of the package within a GitHub repository
+	Subdir string
+}
+
+// ParseSpec parses a package spec the way Install does, so specs can be
+// validated before installing. Specs Install doesn't support, like tarball
+// URLs and git repositories outside of GitHub, are an error.
+func ParseSpec(spec string) (*Spec, error) {
+	if spec == "" {
+		return nil, fmt.Errorf("npm: unable to parse an empty spec")
+	} else if isLocal(spec) {
+		return &Spec{Type: SpecLocal, Path: spec}, nil
+	} else if isAbsolute(spec) {
+		return &Spec{Type: SpecAbsolute, Path: spec}, nil
+	} else if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return nil, fmt.Errorf("npm: unable to install %s because tarball urls aren't supported", spec)
+	} else if isGitSpec(spec) {
+		return nil, fmt.Errorf("npm: unable to install %s because only GitHub repositories are supported (e.g. github:user/repo)", spec)
+	}
+	if pkg, ok, err := splitGitHub(spec); ok {
+		if err != nil {
+			return nil, err
+		}
+		if pkg.Alias != "" {
+			if err := checkName(pkg.Alias); err != nil {
+				return nil, fmt.Errorf("npm: unable to install %s because %w", spec, err)
+			}
+		}
+		return &Spec{Type: SpecGitHub, Alias: pkg.Alias, Repo: pkg.Repo, Ref: pkg.Ref, Subdir: pkg.Subdir}, nil
+	}
+	alias, real, ok := splitAlias(spec)
+	if ok {
+		if err := checkName(alias); err != nil {
+			return nil, fmt.Errorf("npm: unable to install %s because %w", spec, err)
+		} else if target := spec[len(alias)+1+len(aliasProtocol):]; isLocal(target) || isAbsolute(target) || strings.HasPrefix(target, githubProtocol) {
+			return nil, fmt.Errorf("npm: unable to install %s as %s because only registry packages can be aliased", target, alias)
+		}
+	} else {
+		real = spec
+	}
+	name, version, err := splitPackage(real)
+	if err != nil {
+		return nil, err
+	} else if err := checkName(name); err != nil {
+		return nil, fmt.Errorf("npm: unable to install %s because %w", spec, err)
+	}
+	parsed := &Spec{Name: name, Alias: alias, Version: version}
+	parsed.Scope, _ = parseScope(name)
+	switch {
+	case isWorkspace(version):
+		if ok {
+			return nil, fmt.Errorf("npm: unable to install %s as %s because only registry packages can be aliased", real, alias)
+		}
+		parsed.Type = SpecWorkspace
+	case isExactVersion(version):
+		parsed.Type = SpecVersion
+	case isRange(version):
+		parsed.Type = SpecRange
+	case url.PathEscape(version) == version:
+		parsed.Type = SpecTag
+	default:
+		return nil, fmt.Errorf("npm: unable to install %s because %q isn't a valid version, range or tag", spec, version)
+	}
+	return parsed, nil
+}
+
+// gitPrefixes are the git specs npm supports that Install doesn't
+var gitPrefixes = []string{"git+", "git://", "git@", "gitlab:", "bitbucket:", "gist:"}
+
+// isGitSpec returns true if the spec is a git repository outside of GitHub
+func isGitSpec(spec string) bool {
+	// Skip the name of aliased specs (e.g. foo@git+https://...)
+	if index := strings.Index(spec[1:], "@"); index >= 0 {
+		for _, prefix := range gitPrefixes {
+			if strings.HasPrefix(spec[index+2:], prefix) {
+				return true
+			}
+		}
+	}
+	for _, prefix := range gitPrefixes {
+		if strings.HasPrefix(spec, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkName checks that the package name follows npm's rules
+func checkName(name string) error {
+	scope, base := parseScope(name)
+	switch {
+	case name == "":
+		return fmt.Errorf("the package name is empty")
+	case len(name) > 214:
+		return fmt.Errorf("the package name %q is longer than 214 characters", name)
+	case scope != "" && (!strings.HasPrefix(scope, "@") || len(scope) == 1 || base == ""):
+		return fmt.Errorf("the package name %q isn't @scope/name", name)
+	case scope == "" && strings.HasPrefix(name, "@"):
+		return fmt.Errorf("the package name %q isn't @scope/name", name)
+	case strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_"):
+		return fmt.Errorf("the package name %q starts with a period or underscore", name)
+	case strings.TrimSpace(name) != name || url.PathEscape(scope) != scope || url.PathEscape(base) != base:
+		return fmt.Errorf("the package name %q has characters that aren't url-safe", name)
+	}
+	return nil
+}
+
+// isExactVersion returns true if the version is a single version
+func isExactVersion(version string) bool {
+	_, err := semver.StrictNewVersion(strings.TrimPrefix(strings.TrimPrefix(version, "="), "v"))
+	return err == nil
+}
+
+// isRange returns true if the version is a valid range
+func isRange(version string) bool {
+	_, err := semver.NewConstraint(version)
+	return err == nil
+}
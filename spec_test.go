@@ -0,0 +1,69 @@
+package npm_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestParseSpec(t *testing.T) {
+	is := is.New(t)
+	tests := []struct {
+		spec   string
+		expect *npm.Spec
+	}{
+		{"preact@10.0.0", &npm.Spec{Type: npm.SpecVersion, Name: "preact", Version: "10.0.0"}},
+		{"preact@10.0.0-rc.1+build", &npm.Spec{Type: npm.SpecVersion, Name: "preact", Version: "10.0.0-rc.1+build"}},
+		{"preact@10", &npm.Spec{Type: npm.SpecRange, Name: "preact", Version: "10"}},
+		{"@lukeed/uuid@^2.0.0", &npm.Spec{Type: npm.SpecRange, Name: "@lukeed/uuid", Scope: "@lukeed", Version: "^2.0.0"}},
+		{"uid@>=1.0.0 <2.0.0 || 3.x", &npm.Spec{Type: npm.SpecRange, Name: "uid", Version: ">=1.0.0 <2.0.0 || 3.x"}},
+		{"preact@latest", &npm.Spec{Type: npm.SpecTag, Name: "preact", Version: "latest"}},
+		{"react17@npm:react@^17", &npm.Spec{Type: npm.SpecRange, Name: "react", Alias: "react17", Version: "^17"}},
+		{"react17@npm:react", &npm.Spec{Type: npm.SpecTag, Name: "react", Alias: "react17", Version: "latest"}},
+		{"ui@workspace:^", &npm.Spec{Type: npm.SpecWorkspace, Name: "ui", Version: "workspace:^"}},
+		{"./packages/*", &npm.Spec{Type: npm.SpecLocal, Path: "./packages/*"}},
+		{"/src/ui", &npm.Spec{Type: npm.SpecAbsolute, Path: "/src/ui"}},
+		{"github:user/repo#main::path:packages/foo", &npm.Spec{Type: npm.SpecGitHub, Repo: "user/repo", Ref: "main", Subdir: "packages/foo"}},
+		{"foo@github:user/repo", &npm.Spec{Type: npm.SpecGitHub, Alias: "foo", Repo: "user/repo"}},
+	}
+	for _, test := range tests {
+		spec, err := npm.ParseSpec(test.spec)
+		is.NoErr(err)
+		is.Equal(spec, test.expect)
+	}
+	errors := []struct {
+		spec   string
+		expect string
+	}{
+		{"", "empty spec"},
+		{"preact", "missing the version"},
+		{"preact@", "missing the version"},
+		{"Pre act@1.0.0", "aren't url-safe"},
+		{"_private@1.0.0", "starts with a period or underscore"},
+		{"@scope@1.0.0", "isn't @scope/name"},
+		{"scope/name@1.0.0", "isn't @scope/name"},
+		{"preact@not a range", `"not a range" isn't a valid version, range or tag`},
+		{"https://example.com/preact.tgz", "tarball urls aren't supported"},
+		{"foo@git+https://gitlab.com/user/repo.git", "only GitHub repositories are supported"},
+		{"gitlab:user/repo", "only GitHub repositories are supported"},
+		{"github:user", "isn't user/repo"},
+		{"ui@npm:ui@workspace:*", "only registry packages can be aliased"},
+		{"ui@npm:./ui", "only registry packages can be aliased"},
+	}
+	// Install rejects the same specs
+	installer := npm.New(npm.WithRegistry("http://127.0.0.1:1"))
+	for _, test := range errors {
+		_, err := npm.ParseSpec(test.spec)
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), test.expect))
+		if test.spec == "" {
+			continue
+		}
+		err = installer.Install(context.Background(), t.TempDir(), test.spec)
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), test.expect))
+	}
+}
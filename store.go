@@ -0,0 +1,109 @@
+package npm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithStore installs remote packages through a content-addressable store
+// shared between projects, similar to pnpm. Each package is extracted into the
+// store once and its files are hard linked into node_modules. Hard links are
+// used rather than symlinks so Node still resolves a package's dependencies
+// from the project's node_modules.
+func WithStore(dir string) Option {
+	return func(in *Installer) {
+		in.store = dir
+	}
+}
+
+// storeDir returns the directory a package is extracted into within the store.
+// Packages are addressed by their integrity hash, falling back to the name and
+// version for registries that don't provide one.
+func (in *Installer) storeDir(p *remotePackage) string {
+	if algorithm, digest, ok := strings.Cut(p.Integrity, "-"); ok {
+		if sum, err := base64.StdEncoding.DecodeString(digest); err == nil {
+			return filepath.Join(in.store, algorithm, hex.EncodeToString(sum))
+		}
+	}
+	name := p.Name
+	if p.Scope != "" {
+		name = p.Scope + "+" + p.Name
+	}
+	return filepath.Join(in.store, "v", name+"@"+p.Version)
+}
+
+// installFromStore extracts the package into the store if it's not already
+// there, then links its files into dir.
+func (in *Installer) installFromStore(ctx context.Context, p *remotePackage, dir string) error {
+	storeDir := in.storeDir(p)
+	if _, err := os.Stat(storeDir); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("unable to stat %s in the store: %w", storeDir, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(storeDir), 0755); err != nil {
+			return fmt.Errorf("unable to make store directory: %w", err)
+		}
+		// Extract into a temporary directory first, so other installers never see
+		// a partially extracted package in the store.
+		tmpDir, err := os.MkdirTemp(filepath.Dir(storeDir), ".tmp-")
+		if err != nil {
+			return fmt.Errorf("unable to make temporary store directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		// The store is shared, so it always has the complete package
+		if err := in.downloadVerified(ctx, p, tmpDir, nil); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpDir, storeDir); err != nil {
+			// Another installer may have won the race to add the package
+			if _, statErr := os.Stat(storeDir); statErr != nil {
+				return fmt.Errorf("unable to move %s into the store: %w", p.Name, err)
+			}
+		}
+	}
+	if err := linkFiles(storeDir, dir, in.filter, in.copier); err != nil {
+		return fmt.Errorf("unable to link %s from the store: %w", p.Name, err)
+	}
+	return nil
+}
+
+// linkFiles hard links every file in from that passes the filter into to,
+// falling back to copying when hard links aren't possible (e.g. across
+// devices).
+func linkFiles(from, to string, filter func(path string) bool, c *copier) error {
+	return filepath.WalkDir(from, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		if de.IsDir() {
+			if filter != nil {
+				// Directories are made as needed for the files that pass the filter
+				return nil
+			}
+			return os.MkdirAll(target, 0755)
+		} else if !keepFile(filepath.ToSlash(rel), filter) {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Link(path, target); err != nil {
+			return copyFile(path, target, c)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,56 @@
+package npm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestStore(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"index.js": `export const uid = "uid"`,
+		},
+		"@lukeed/uuid@2.0.1": {
+			"package.json": `{"name":"@lukeed/uuid","version":"2.0.1","dependencies":{"uid":"^2.0.0"}}`,
+			"index.js":     `export const uuid = "uuid"`,
+		},
+	})
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			downloads.Add(1)
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	store := t.TempDir()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithStore(store))
+	ctx := context.Background()
+	app1 := t.TempDir()
+	is.NoErr(installer.Install(ctx, app1, "@lukeed/uuid@^2.0.0"))
+	app2 := t.TempDir()
+	is.NoErr(installer.Install(ctx, app2, "@lukeed/uuid@^2.0.0"))
+	// Each package is only downloaded once
+	is.Equal(downloads.Load(), int32(2))
+	for _, file := range []string{
+		filepath.Join("node_modules", "@lukeed", "uuid", "index.js"),
+		filepath.Join("node_modules", "uid", "index.js"),
+	} {
+		stat1, err := os.Stat(filepath.Join(app1, file))
+		is.NoErr(err)
+		stat2, err := os.Stat(filepath.Join(app2, file))
+		is.NoErr(err)
+		is.True(os.SameFile(stat1, stat2))
+	}
+	equals(t, filepath.Join(app2, "node_modules", "uid", "index.js"), `export const uid = "uid"`)
+}
@@ -0,0 +1,29 @@
+package npm
+
+// WithSubtreeInstalled calls fn once a package and all of its transitive
+// dependencies are installed, so downstream work like transpiling can start
+// while the rest of the tree is still installing. Dependencies are reported
+// before the packages that depend on them, and every package is reported
+// once. Calls may be concurrent.
+func WithSubtreeInstalled(fn func(pkg *InstalledPackage)) Option {
+	return func(in *Installer) {
+		in.onSubtree = fn
+	}
+}
+
+// subtreeInstalled reports that the package and its dependencies are installed
+func (s *session) subtreeInstalled(pkg *InstalledPackage) {
+	if s.in.onSubtree == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.subtrees == nil {
+		s.subtrees = map[string]bool{}
+	}
+	reported := s.subtrees[pkg.Dir]
+	s.subtrees[pkg.Dir] = true
+	s.mu.Unlock()
+	if !reported {
+		s.in.onSubtree(pkg)
+	}
+}
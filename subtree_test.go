@@ -0,0 +1,55 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestSubtreeInstalled(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"app@1.0.0": {
+			"package.json": `{"name":"app","version":"1.0.0","dependencies":{"lib":"^1.0.0","util":"^1.0.0"}}`,
+		},
+		"lib@1.0.0": {
+			"package.json": `{"name":"lib","version":"1.0.0","dependencies":{"util":"^1.0.0"}}`,
+		},
+		"util@1.0.0": {},
+		"solo@1.0.0": {},
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	var mu sync.Mutex
+	var order []string
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithSubtreeInstalled(func(pkg *npm.InstalledPackage) {
+		// Every dependency is in place by the time a package is reported
+		deps := map[string][]string{"app": {"lib", "util"}, "lib": {"util"}}
+		for _, dep := range append(deps[pkg.Name], pkg.Name) {
+			_, err := os.Stat(filepath.Join(dir, "node_modules", dep, "package.json"))
+			is.NoErr(err)
+		}
+		is.Equal(pkg.Dir, filepath.Join(dir, "node_modules", pkg.Name))
+		mu.Lock()
+		order = append(order, pkg.Name+"@"+pkg.Version)
+		mu.Unlock()
+	}))
+	is.NoErr(installer.Install(context.Background(), dir, "app@1.0.0", "solo@1.0.0"))
+	is.Equal(len(order), 4)
+	index := map[string]int{}
+	for i, key := range order {
+		_, ok := index[key]
+		is.True(!ok) // reported once
+		index[key] = i
+	}
+	is.True(index["util@1.0.0"] < index["lib@1.0.0"])
+	is.True(index["lib@1.0.0"] < index["app@1.0.0"])
+	_, ok := index["solo@1.0.0"]
+	is.True(ok)
+}
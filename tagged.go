@@ -0,0 +1,45 @@
+package npm
+
+import (
+	"fmt"
+)
+
+// WithTaggedVersionsOnly only resolves versions that a dist-tag points to
+// (e.g. latest or lts), so only releases that were promoted are installed,
+// never a version that was published but not tagged. Ranges resolve to the
+// highest tagged version that satisfies them.
+func WithTaggedVersionsOnly() Option {
+	return func(in *Installer) {
+		in.taggedOnly = true
+	}
+}
+
+// taggedVersions returns a copy of the metadata with only the versions that
+// the dist-tags point to
+func (in *Installer) taggedVersions(meta *metadata) (*metadata, error) {
+	if !in.taggedOnly {
+		return meta, nil
+	}
+	tagged := map[string]bool{}
+	for _, version := range meta.DistTags {
+		tagged[version] = true
+	}
+	filtered := &metadata{
+		Name:     meta.Name,
+		DistTags: map[string]string{},
+		Versions: map[string]*versionMetadata{},
+		Time:     meta.Time,
+		size:     meta.size,
+		coerced:  meta.coerced,
+	}
+	for version, versionMeta := range meta.Versions {
+		if tagged[meta.original(version)] {
+			filtered.Versions[version] = versionMeta
+		}
+	}
+	if len(filtered.Versions) == 0 && len(meta.Versions) > 0 {
+		return nil, fmt.Errorf("unable to resolve a version of %s because none of its versions are tagged", meta.Name)
+	}
+	filtered.retag(meta.DistTags)
+	return filtered, nil
+}
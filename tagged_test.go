@@ -0,0 +1,75 @@
+package npm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestTaggedVersionsOnly(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0":      {},
+		"uid@1.1.0":      {},
+		"uid@1.2.0":      {},
+		"uid@2.0.0-beta": {},
+		"untagged@1.0.0": {},
+	})
+	distTags := map[string]map[string]string{
+		"uid":      {"latest": "1.1.0", "lts": "1.0.0", "next": "2.0.0-beta"},
+		"untagged": {},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			registry.ServeHTTP(w, r)
+			return
+		}
+		// Only some of the versions are tagged
+		rec := httptest.NewRecorder()
+		registry.ServeHTTP(rec, r)
+		var document map[string]interface{}
+		is.NoErr(json.Unmarshal(rec.Body.Bytes(), &document))
+		document["dist-tags"] = distTags[document["name"].(string)]
+		json.NewEncoder(w).Encode(document)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithTaggedVersionsOnly())
+	tests := []struct {
+		constraint string
+		expect     string
+	}{
+		{"^1.0.0", "1.1.0"},
+		{"~1.0.0", "1.0.0"},
+		{"*", "1.1.0"},
+		{"latest", "1.1.0"},
+		{"next", "2.0.0-beta"},
+		{">=2.0.0-0", "2.0.0-beta"},
+	}
+	for _, test := range tests {
+		version, err := installer.Version(ctx, "uid", test.constraint)
+		is.NoErr(err)
+		is.Equal(version, test.expect)
+	}
+	_, err := installer.Version(ctx, "uid", "^1.2.0")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "none of the tagged versions (1.0.0, 1.1.0, 2.0.0-beta) satisfy it"))
+	_, err = installer.Version(ctx, "untagged", "*")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "none of its versions are tagged"))
+	// Installs only tagged versions too
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "uid@^1.0.0"))
+	equals(t, filepath.Join(dir, "node_modules", "uid", "package.json"), `{"name":"uid","version":"1.1.0"}`)
+	// Untagged versions are resolved by default
+	version, err := npm.New(npm.WithRegistry(server.URL)).Version(ctx, "uid", "^1.0.0")
+	is.NoErr(err)
+	is.Equal(version, "1.2.0")
+}
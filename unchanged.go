@@ -0,0 +1,56 @@
+package npm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// WithForceCopy copies every file of local packages on every install. By
+// default, files that are identical to what's already in node_modules are
+// skipped, which makes repeated installs in a watch loop much faster.
+func WithForceCopy() Option {
+	return func(in *Installer) {
+		in.forceCopy = true
+	}
+}
+
+// unchanged returns true if dst is already a copy of src. Files with the same
+// size and modification time are assumed to be the same, since copies keep
+// the modification time of their source. Otherwise files of the same size are
+// compared by their hash.
+func unchanged(src, dst string, srcInfo fs.FileInfo) bool {
+	dstInfo, err := os.Lstat(dst)
+	if err != nil || !dstInfo.Mode().IsRegular() || dstInfo.Size() != srcInfo.Size() {
+		return false
+	} else if dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+		return true
+	}
+	srcSum, err := hashFile(src)
+	if err != nil {
+		return false
+	}
+	dstSum, err := hashFile(dst)
+	if err != nil || !bytes.Equal(srcSum, dstSum) {
+		return false
+	}
+	// Take the fast path next time
+	os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime())
+	return true
+}
+
+// hashFile returns the sha256 of the file's contents
+func hashFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
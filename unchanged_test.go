@@ -0,0 +1,60 @@
+package npm_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestLocalUnchanged(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	pkgDir := filepath.Join(dir, "packages", "ui")
+	is.NoErr(writeFiles(pkgDir, map[string]string{
+		"package.json": `{"name":"ui","version":"1.0.0","main":"./index.js"}`,
+		"index.js":     `export const ui = "v1"`,
+	}))
+	src := filepath.Join(pkgDir, "index.js")
+	dst := filepath.Join(dir, "node_modules", "ui", "index.js")
+	installer := npm.New()
+	is.NoErr(installer.Install(ctx, dir, "./packages/ui"))
+	equals(t, dst, `export const ui = "v1"`)
+	// Copies keep the source's modification time
+	srcInfo, err := os.Stat(src)
+	is.NoErr(err)
+	dstInfo, err := os.Stat(dst)
+	is.NoErr(err)
+	is.True(dstInfo.ModTime().Equal(srcInfo.ModTime()))
+	// Files with the same size and modification time are skipped
+	is.NoErr(os.WriteFile(dst, []byte(`export const ui = "xx"`), 0644))
+	is.NoErr(os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime()))
+	is.NoErr(installer.Install(ctx, dir, "./packages/ui"))
+	equals(t, dst, `export const ui = "xx"`)
+	// Unless every file is copied
+	is.NoErr(npm.New(npm.WithForceCopy()).Install(ctx, dir, "./packages/ui"))
+	equals(t, dst, `export const ui = "v1"`)
+	// Changes of the same size are found by their hash
+	is.NoErr(os.WriteFile(src, []byte(`export const ui = "v2"`), 0644))
+	later := srcInfo.ModTime().Add(time.Second)
+	is.NoErr(os.Chtimes(src, later, later))
+	is.NoErr(installer.Install(ctx, dir, "./packages/ui"))
+	equals(t, dst, `export const ui = "v2"`)
+	// Identical files with another modification time are skipped, but get
+	// the source's modification time
+	old := later.Add(-time.Hour)
+	is.NoErr(os.Chtimes(dst, old, old))
+	is.NoErr(installer.Install(ctx, dir, "./packages/ui"))
+	dstInfo, err = os.Stat(dst)
+	is.NoErr(err)
+	is.True(dstInfo.ModTime().Equal(later))
+	// Other changes are copied
+	is.NoErr(os.WriteFile(src, []byte(`export const ui = "version 3"`), 0644))
+	is.NoErr(installer.Install(ctx, dir, "./packages/ui"))
+	equals(t, dst, `export const ui = "version 3"`)
+}
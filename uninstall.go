@@ -0,0 +1,215 @@
+package npm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Uninstall removes packages from dir/node_modules and from the dependencies
+// in dir/package.json like `npm uninstall <pkg>`. The package's links in
+// node_modules/.bin are removed, along with its scope directory once no other
+// package is left in it (e.g. node_modules/@lukeed).
+func Uninstall(ctx context.Context, dir string, names ...string) error {
+	return defaultInstaller.Uninstall(ctx, dir, names...)
+}
+
+// Uninstall removes packages from dir/node_modules and from the dependencies
+// in dir/package.json.
+func (in *Installer) Uninstall(ctx context.Context, dir string, names ...string) error {
+	// Check every name before removing anything
+	for _, name := range names {
+		if err := checkName(name); err != nil {
+			return fmt.Errorf("npm: unable to uninstall %q because %w", name, err)
+		} else if !filepath.IsLocal(filepath.FromSlash(in.moduleDir(name))) {
+			return fmt.Errorf("npm: unable to uninstall %q because it's outside of node_modules", name)
+		}
+	}
+	nodeModules := filepath.Join(dir, "node_modules")
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := in.uninstallPackage(nodeModules, name); err != nil {
+			return fmt.Errorf("npm: unable to uninstall %s: %w", name, err)
+		}
+	}
+	if err := in.removeDependencies(filepath.Join(dir, "package.json"), names); err != nil {
+		return fmt.Errorf("npm: unable to uninstall: %w", err)
+	}
+	if err := in.unlockPackages(dir, names); err != nil {
+		return fmt.Errorf("npm: unable to uninstall: %w", err)
+	}
+	return nil
+}
+
+// uninstallPackage removes the package's directory, its .bin links and its
+// scope directory if it's now empty
+func (in *Installer) uninstallPackage(nodeModules, name string) error {
+	pkgDir := filepath.Join(nodeModules, filepath.FromSlash(in.moduleDir(name)))
+	if err := removeBinLinks(filepath.Join(nodeModules, ".bin"), pkgDir); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(pkgDir); err != nil {
+		return fmt.Errorf("unable to remove %s: %w", pkgDir, err)
+	}
+	// Flattened scoped layouts don't have a scope directory
+	scopeDir := filepath.Dir(pkgDir)
+	if scopeDir == nodeModules {
+		return nil
+	}
+	entries, err := os.ReadDir(scopeDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("unable to read %s: %w", scopeDir, err)
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+	if err := os.Remove(scopeDir); err != nil {
+		return fmt.Errorf("unable to remove %s: %w", scopeDir, err)
+	}
+	return nil
+}
+
+// removeBinLinks removes the links and shims in binDir that point into pkgDir
+func removeBinLinks(binDir, pkgDir string) error {
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("unable to read %s: %w", binDir, err)
+	}
+	for _, entry := range entries {
+		shimPath := filepath.Join(binDir, entry.Name())
+		if target, ok := shimTarget(shimPath); ok {
+			if rel, err := filepath.Rel(pkgDir, target); err == nil && filepath.IsLocal(rel) {
+				if err := removeShims(shimPath); err != nil {
+					return fmt.Errorf("unable to remove shim %s: %w", shimPath, err)
+				}
+			}
+			continue
+		}
+		if entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		linkPath := filepath.Join(binDir, entry.Name())
+		target, err := os.Readlink(linkPath)
+		if err != nil {
+			return fmt.Errorf("unable to read link %s: %w", linkPath, err)
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(binDir, target)
+		}
+		rel, err := filepath.Rel(pkgDir, target)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		if err := os.Remove(linkPath); err != nil {
+			return fmt.Errorf("unable to remove link %s: %w", linkPath, err)
+		}
+	}
+	return nil
+}
+
+// removeDependencies removes the packages from every dependency field in the
+// package.json, keeping its other fields and formatting
+func (in *Installer) removeDependencies(manifestPath string, names []string) error {
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("unable to read package.json: %w", err)
+	}
+	root := new(jsonObject)
+	if err := in.unmarshalManifest(manifest, root); err != nil {
+		return fmt.Errorf("unable to unmarshal package.json: %w", err)
+	}
+	changed := false
+	for _, field := range []string{"dependencies", "devDependencies", "optionalDependencies", "peerDependencies"} {
+		value, ok := root.Get(field)
+		if !ok || string(value) == "null" {
+			continue
+		}
+		dependencies := new(jsonObject)
+		if err := json.Unmarshal(value, dependencies); err != nil {
+			return fmt.Errorf("unable to unmarshal %s in package.json: %w", field, err)
+		}
+		removed := false
+		for _, name := range names {
+			removed = dependencies.Delete(name) || removed
+		}
+		if !removed {
+			continue
+		}
+		value, err := marshalJSON(dependencies)
+		if err != nil {
+			return err
+		}
+		root.Set(field, value)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	compact, err := marshalJSON(root)
+	if err != nil {
+		return err
+	}
+	out := new(bytes.Buffer)
+	if err := json.Indent(out, compact, "", detectIndent(manifest)); err != nil {
+		return fmt.Errorf("unable to indent package.json: %w", err)
+	}
+	out.WriteByte('\n')
+	if err := os.WriteFile(manifestPath, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to write package.json: %w", err)
+	}
+	return nil
+}
+
+// unlockPackages removes the packages and everything nested within them from
+// the hidden lockfile
+func (in *Installer) unlockPackages(dir string, names []string) error {
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = "node_modules/" + in.moduleDir(name)
+	}
+	return unlockKeys(dir, keys)
+}
+
+// unlockKeys removes the lockfile keys (e.g. node_modules/a) and everything
+// nested within them from the hidden lockfile
+func unlockKeys(dir string, keys []string) error {
+	lockPath := filepath.Join(dir, "node_modules", ".package-lock.json")
+	lock, err := readLockfile(lockPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	lock.dir = dir
+	for _, key := range keys {
+		for pkgKey := range lock.Packages {
+			if pkgKey == key || strings.HasPrefix(pkgKey, key+"/") {
+				delete(lock.Packages, pkgKey)
+			}
+		}
+	}
+	if len(lock.Packages) == 0 {
+		if err := os.Remove(lockPath); err != nil {
+			return fmt.Errorf("unable to remove lockfile: %w", err)
+		}
+		return nil
+	}
+	return lock.Write()
+}
@@ -0,0 +1,92 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestUninstallScoped(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"uid@2.0.0": {
+			"bin.js": `console.log("uid")`,
+		},
+		"@lukeed/uuid@2.0.1": {
+			"bin.js": `console.log("uuid")`,
+		},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	is.NoErr(installer.Add(ctx, dir, "uid@2.0.0", "@lukeed/uuid@2.0.1"))
+	binDir := filepath.Join(dir, "node_modules", ".bin")
+	is.NoErr(os.MkdirAll(binDir, 0755))
+	is.NoErr(os.Symlink("../@lukeed/uuid/bin.js", filepath.Join(binDir, "uuid")))
+	is.NoErr(os.Symlink("../uid/bin.js", filepath.Join(binDir, "uid")))
+	is.NoErr(installer.Uninstall(ctx, dir, "@lukeed/uuid"))
+	notExists(t, filepath.Join(dir, "node_modules", "@lukeed"))
+	notExists(t, filepath.Join(binDir, "uuid"))
+	exists(t, filepath.Join(binDir, "uid"))
+	exists(t, filepath.Join(dir, "node_modules", "uid", "bin.js"))
+	equals(t, filepath.Join(dir, "package.json"), "{\n  \"dependencies\": {\n    \"uid\": \"^2.0.0\"\n  }\n}\n")
+	lock := readLockfile(t, filepath.Join(dir, "node_modules", ".package-lock.json"))
+	_, ok := lock.Packages["node_modules/@lukeed/uuid"]
+	is.True(!ok)
+	is.Equal(lock.Packages["node_modules/uid"].Version, "2.0.0")
+}
+
+func TestUninstallKeepsScope(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"@lukeed/uuid@2.0.1":   {},
+		"@lukeed/csprng@1.1.0": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	is.NoErr(installer.Install(ctx, dir, "@lukeed/uuid@2.0.1", "@lukeed/csprng@1.1.0"))
+	is.NoErr(installer.Uninstall(ctx, dir, "@lukeed/uuid"))
+	notExists(t, filepath.Join(dir, "node_modules", "@lukeed", "uuid"))
+	exists(t, filepath.Join(dir, "node_modules", "@lukeed", "csprng", "package.json"))
+}
+
+func TestUninstallInvalidNames(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"node_modules/uid/package.json": `{"name":"uid","version":"2.0.0"}`,
+		"x/keep.txt":                    `keep`,
+	}))
+	ctx := context.Background()
+	for _, name := range []string{"", "../x", "uid/../../x", "@scope/../../x"} {
+		is.True(npm.Uninstall(ctx, dir, name) != nil)
+	}
+	// Nothing is removed when any name is invalid
+	is.True(npm.Uninstall(ctx, dir, "uid", "../x") != nil)
+	exists(t, filepath.Join(dir, "node_modules", "uid", "package.json"))
+	exists(t, filepath.Join(dir, "x", "keep.txt"))
+}
+
+func TestUninstallFlatScopes(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"@lukeed/uuid@2.0.1": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithScopedLayout(npm.FlatScopes))
+	is.NoErr(installer.Install(ctx, dir, "@lukeed/uuid@2.0.1"))
+	exists(t, filepath.Join(dir, "node_modules", "@lukeed%2fuuid", "package.json"))
+	is.NoErr(installer.Uninstall(ctx, dir, "@lukeed/uuid"))
+	notExists(t, filepath.Join(dir, "node_modules", "@lukeed%2fuuid"))
+	exists(t, filepath.Join(dir, "node_modules"))
+}
@@ -0,0 +1,152 @@
+package npm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// UnmetDependency is a dependency of an installed package that doesn't
+// resolve from the package's directory like Node would resolve it
+type UnmetDependency struct {
+	// From is the package that depends on it
+	From        string
+	FromVersion string
+	Name        string
+	// Range is the version range in From's package.json
+	Range string
+	// Installed is the version that resolves instead. It's empty when the
+	// dependency is missing.
+	Installed string
+}
+
+func (u *UnmetDependency) String() string {
+	if u.Installed == "" {
+		return fmt.Sprintf("%s@%s depends on %s@%s, which is missing", u.From, u.FromVersion, u.Name, u.Range)
+	}
+	return fmt.Sprintf("%s@%s depends on %s@%s, but %s is installed", u.From, u.FromVersion, u.Name, u.Range, u.Installed)
+}
+
+// WithUnmetDependencies checks that the dependencies of every installed
+// package resolve after installing, calling fn for each one that doesn't. See
+// UnmetDependencies.
+func WithUnmetDependencies(fn func(unmet *UnmetDependency)) Option {
+	return func(in *Installer) {
+		in.onUnmet = fn
+	}
+}
+
+// UnmetDependencies walks every package in dir/node_modules, including nested
+// ones, and returns the dependencies that don't resolve from the package's
+// directory, either because they're missing or because the version that
+// resolves doesn't satisfy the range. Optional dependencies are skipped, and
+// ranges that aren't semver ranges (e.g. tags or URLs) only need something to
+// be installed.
+func UnmetDependencies(dir string) ([]*UnmetDependency, error) {
+	return defaultInstaller.UnmetDependencies(dir)
+}
+
+// UnmetDependencies returns the dependencies of the packages installed in
+// dir/node_modules that don't resolve.
+func (in *Installer) UnmetDependencies(dir string) ([]*UnmetDependency, error) {
+	var unmet []*UnmetDependency
+	if err := in.walkUnmet(dir, dir, &unmet); err != nil {
+		return nil, fmt.Errorf("npm: unable to check dependencies: %w", err)
+	}
+	return unmet, nil
+}
+
+// walkUnmet checks the packages in parent/node_modules and the packages
+// nested within them
+func (in *Installer) walkUnmet(root, parent string, unmet *[]*UnmetDependency) error {
+	packages, err := in.List(parent)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range packages {
+		manifest, err := os.ReadFile(filepath.Join(pkg.Dir, "package.json"))
+		if err != nil {
+			return fmt.Errorf("unable to read package.json for %s: %w", pkg.Name, err)
+		}
+		deps, err := in.readDependencies(manifest)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pkg.Name, err)
+		}
+		names := make([]string, 0, len(deps.Required))
+		for name := range deps.Required {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			spec := deps.Required[name]
+			installed, ok, err := in.resolveInstalled(root, pkg.Dir, name)
+			if err != nil {
+				return err
+			} else if ok && satisfies(installed, aliasedRange(spec)) {
+				continue
+			}
+			*unmet = append(*unmet, &UnmetDependency{
+				From:        pkg.Name,
+				FromVersion: pkg.Version,
+				Name:        name,
+				Range:       spec,
+				Installed:   installed,
+			})
+		}
+		if err := in.walkUnmet(root, pkg.Dir, unmet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveInstalled finds the version of the dependency that Node would load
+// from the package's directory, looking in each node_modules up to the root
+func (in *Installer) resolveInstalled(root, pkgDir, name string) (version string, ok bool, err error) {
+	for dir := pkgDir; ; dir = filepath.Dir(dir) {
+		if filepath.Base(dir) == "node_modules" {
+			continue
+		}
+		manifestPath := filepath.Join(dir, "node_modules", filepath.FromSlash(in.moduleDir(name)), "package.json")
+		manifest, err := readManifest(manifestPath, in.lenientJSON)
+		if err == nil {
+			return manifest.Version, true, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", false, err
+		}
+		if dir == root || filepath.Dir(dir) == dir {
+			return "", false, nil
+		}
+	}
+}
+
+// aliasedRange returns the range of an aliased spec (e.g. npm:react@^17)
+func aliasedRange(spec string) string {
+	real, ok := strings.CutPrefix(spec, aliasProtocol)
+	if !ok {
+		return spec
+	}
+	index := strings.LastIndex(real, "@")
+	if index <= 0 {
+		return "latest"
+	}
+	return real[index+1:]
+}
+
+// checkUnmet reports the unmet dependencies after installing
+func (s *session) checkUnmet() error {
+	if s.in.onUnmet == nil {
+		return nil
+	}
+	unmet, err := s.in.UnmetDependencies(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, dependency := range unmet {
+		s.in.onUnmet(dependency)
+	}
+	return nil
+}
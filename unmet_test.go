@@ -0,0 +1,53 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestUnmetDependencies(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"a@1.0.0": {
+			"package.json": `{"name":"a","version":"1.0.0","dependencies":{"b":"^1.0.0"},"optionalDependencies":{"missing":"^1.0.0"}}`,
+		},
+		"c@1.0.0": {
+			"package.json": `{"name":"c","version":"1.0.0","dependencies":{"b":"^1.0.0"}}`,
+		},
+		"b@1.0.0": {},
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	var reported []*npm.UnmetDependency
+	installer := npm.New(
+		npm.WithRegistry(server.URL),
+		npm.WithDependencyFields("dependencies", "optionalDependencies"),
+		npm.WithUnmetDependencies(func(unmet *npm.UnmetDependency) {
+			reported = append(reported, unmet)
+		}),
+	)
+	dir := t.TempDir()
+	is.NoErr(installer.Install(ctx, dir, "a@1.0.0", "c@1.0.0"))
+	is.Equal(len(reported), 0)
+	// Nested dependencies resolve before hoisted ones
+	is.NoErr(writeFiles(dir, map[string]string{
+		"node_modules/c/node_modules/b/package.json": `{"name":"b","version":"2.0.0"}`,
+	}))
+	unmet, err := installer.UnmetDependencies(dir)
+	is.NoErr(err)
+	is.Equal(len(unmet), 1)
+	is.Equal(unmet[0].String(), "c@1.0.0 depends on b@^1.0.0, but 2.0.0 is installed")
+	is.NoErr(os.RemoveAll(filepath.Join(dir, "node_modules", "b")))
+	unmet, err = installer.UnmetDependencies(dir)
+	is.NoErr(err)
+	is.Equal(len(unmet), 2)
+	is.Equal(unmet[0].String(), "a@1.0.0 depends on b@^1.0.0, which is missing")
+	is.Equal(unmet[0].Installed, "")
+	is.Equal(unmet[1].From, "c")
+}
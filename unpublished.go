@@ -0,0 +1,49 @@
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// publishTimes maps versions to when they were published. Unpublished
+// packages have an "unpublished" object instead of the versions, which is
+// kept as the time the package was unpublished.
+type publishTimes map[string]string
+
+func (t *publishTimes) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	times := make(publishTimes, len(fields))
+	for key, value := range fields {
+		var date string
+		if err := json.Unmarshal(value, &date); err == nil {
+			times[key] = date
+			continue
+		}
+		if key != "unpublished" {
+			continue
+		}
+		var unpublished struct {
+			Time string `json:"time,omitempty"`
+		}
+		if err := json.Unmarshal(value, &unpublished); err == nil {
+			times[key] = unpublished.Time
+		}
+	}
+	*t = times
+	return nil
+}
+
+// errNoVersions explains why a package without versions can't be resolved,
+// which is different from none of its versions matching
+func (m *metadata) errNoVersions(constraint string) error {
+	if unpublished, ok := m.Time["unpublished"]; ok {
+		if unpublished == "" {
+			return fmt.Errorf("unable to resolve version for %s@%s because the package was unpublished", m.Name, constraint)
+		}
+		return fmt.Errorf("unable to resolve version for %s@%s because the package was unpublished at %s", m.Name, constraint, unpublished)
+	}
+	return fmt.Errorf("unable to resolve version for %s@%s because the package has no published versions", m.Name, constraint)
+}
@@ -0,0 +1,56 @@
+package npm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestNoVersions(t *testing.T) {
+	is := is.New(t)
+	registry := registryHandler(t, map[string]map[string]string{
+		"uid@1.0.0": {},
+	})
+	documents := map[string]string{
+		"/gone":      `{"name":"gone","time":{"created":"2020-01-01T00:00:00.000Z","unpublished":{"time":"2024-01-01T00:00:00.000Z","versions":["1.0.0"]}}}`,
+		"/empty":     `{"name":"empty","dist-tags":{},"versions":{}}`,
+		"/tags-only": `{"name":"tags-only","dist-tags":{"latest":"1.0.0"}}`,
+		"/stale-tag": `{"name":"stale-tag","dist-tags":{"latest":"2.0.0"},"versions":{"1.0.0":{"name":"stale-tag","version":"1.0.0"}}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if document, ok := documents[r.URL.Path]; ok {
+			w.Write([]byte(document))
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	installer := npm.New(npm.WithRegistry(server.URL))
+	tests := []struct {
+		pkg        string
+		constraint string
+		expect     string
+	}{
+		{"gone", "^1.0.0", "gone@^1.0.0 because the package was unpublished at 2024-01-01T00:00:00.000Z"},
+		{"empty", "*", "empty@* because the package has no published versions"},
+		{"tags-only", "latest", "tags-only@latest because the package has no published versions"},
+		{"stale-tag", "latest", "stale-tag@latest because the tag points to 2.0.0, which isn't published"},
+		// Versions that don't match are a different error
+		{"uid", "^2.0.0", "uid@^2.0.0: no matching version"},
+	}
+	for _, test := range tests {
+		_, err := installer.Version(ctx, test.pkg, test.constraint)
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), test.expect))
+	}
+	// Installing fails the same way
+	err := installer.Install(ctx, t.TempDir(), "tags-only@latest")
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "has no published versions"))
+}
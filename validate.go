@@ -0,0 +1,120 @@
+package npm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ManifestProblem is a field in an installed package's package.json that
+// points to a file that doesn't exist
+type ManifestProblem struct {
+	Name    string
+	Version string
+	// Field is the package.json field (e.g. main or bin.cli)
+	Field string
+	// Path is the missing path within the package
+	Path string
+}
+
+func (p *ManifestProblem) String() string {
+	return fmt.Sprintf("%s@%s: %s points to %s, which doesn't exist", p.Name, p.Version, p.Field, p.Path)
+}
+
+// WithValidation checks the package.json of every installed package after
+// installing, calling fn for each field that points to a missing file. The
+// main, types, typings and bin fields are checked. Main is resolved like Node
+// does, so "main": "lib" matches lib.js or lib/index.js. Files left out with
+// WithFilter are reported too.
+func WithValidation(fn func(problem *ManifestProblem)) Option {
+	return func(in *Installer) {
+		in.onProblem = fn
+	}
+}
+
+// validateManifests reports the problems in the installed packages
+func (s *session) validateManifests() error {
+	if s.in.onProblem == nil {
+		return nil
+	}
+	var problems []*ManifestProblem
+	for _, pkg := range s.result().Packages {
+		found, err := s.in.validateManifest(pkg)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, found...)
+	}
+	for _, problem := range problems {
+		s.in.onProblem(problem)
+	}
+	return nil
+}
+
+// validateManifest returns the problems in the installed package's
+// package.json
+func (in *Installer) validateManifest(pkg *InstalledPackage) ([]*ManifestProblem, error) {
+	manifestPath := filepath.Join(pkg.Dir, "package.json")
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("npm: unable to read %s: %w", manifestPath, err)
+	}
+	var manifest struct {
+		Main    string          `json:"main,omitempty"`
+		Types   string          `json:"types,omitempty"`
+		Typings string          `json:"typings,omitempty"`
+		Bin     json.RawMessage `json:"bin,omitempty"`
+	}
+	if err := in.unmarshalManifest(data, &manifest); err != nil {
+		return nil, fmt.Errorf("npm: unable to unmarshal %s: %w", manifestPath, err)
+	}
+	var problems []*ManifestProblem
+	check := func(field, path string, exists func(dir, path string) bool) {
+		if path == "" || exists(pkg.Dir, path) {
+			return
+		}
+		problems = append(problems, &ManifestProblem{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Field:   field,
+			Path:    path,
+		})
+	}
+	check("main", manifest.Main, mainExists)
+	check("types", manifest.Types, fileExists)
+	check("typings", manifest.Typings, fileExists)
+	var bin string
+	var bins map[string]string
+	if json.Unmarshal(manifest.Bin, &bin) == nil {
+		check("bin", bin, fileExists)
+	} else if json.Unmarshal(manifest.Bin, &bins) == nil {
+		names := make([]string, 0, len(bins))
+		for name := range bins {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			check("bin."+name, bins[name], fileExists)
+		}
+	}
+	return problems, nil
+}
+
+// fileExists returns true if the file exists within the package
+func fileExists(dir, path string) bool {
+	info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+	return err == nil && !info.IsDir()
+}
+
+// mainExists returns true if the main entry resolves like require would,
+// trying the extensions and the directory's index
+func mainExists(dir, path string) bool {
+	for _, candidate := range []string{"", ".js", ".json", ".node", "/index.js", "/index.json", "/index.node"} {
+		if fileExists(dir, path+candidate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package npm_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestValidation(t *testing.T) {
+	is := is.New(t)
+	server := httptest.NewServer(registryHandler(t, map[string]map[string]string{
+		"cli@1.0.0": {
+			"package.json": `{"name":"cli","version":"1.0.0","main":"lib","types":"index.d.ts","bin":{"cli":"bin/cli.js","ok":"bin/ok.js"}}`,
+			"lib/index.js": `module.exports = {}`,
+			"bin/ok.js":    `#!/usr/bin/env node`,
+		},
+		"fine@1.0.0": {
+			"package.json": `{"name":"fine","version":"1.0.0","main":"./index","bin":"cli.js"}`,
+			"index.js":     `module.exports = {}`,
+			"cli.js":       `#!/usr/bin/env node`,
+		},
+	}))
+	defer server.Close()
+	var problems []string
+	installer := npm.New(npm.WithRegistry(server.URL), npm.WithValidation(func(problem *npm.ManifestProblem) {
+		problems = append(problems, problem.String())
+	}))
+	is.NoErr(installer.Install(context.Background(), t.TempDir(), "cli@1.0.0", "fine@1.0.0"))
+	is.Equal(problems, []string{
+		"cli@1.0.0: types points to index.d.ts, which doesn't exist",
+		"cli@1.0.0: bin.cli points to bin/cli.js, which doesn't exist",
+	})
+}
@@ -0,0 +1,110 @@
+package npm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// workspaceProtocol prefixes dependency specs that refer to a package in the
+// workspace (e.g. "workspace:*" or "workspace:^1.0.0")
+const workspaceProtocol = "workspace:"
+
+// isWorkspace returns true if the version refers to a workspace package
+func isWorkspace(version string) bool {
+	return strings.HasPrefix(version, workspaceProtocol)
+}
+
+// readWorkspaces reads the packages in the workspaces of dir/package.json by
+// name. Workspaces are either a list of paths and globs, or an object with
+// the list under "packages".
+func (in *Installer) readWorkspaces(dir string) (map[string]*localPackage, error) {
+	manifest, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]*localPackage{}, nil
+		}
+		return nil, fmt.Errorf("npm: unable to read package.json: %w", err)
+	}
+	var pkg struct {
+		Workspaces json.RawMessage `json:"workspaces,omitempty"`
+	}
+	if err := in.unmarshalManifest(manifest, &pkg); err != nil {
+		return nil, fmt.Errorf("npm: unable to unmarshal package.json: %w", err)
+	}
+	var patterns []string
+	if len(pkg.Workspaces) > 0 && json.Unmarshal(pkg.Workspaces, &patterns) != nil {
+		var object struct {
+			Packages []string `json:"packages,omitempty"`
+		}
+		if err := json.Unmarshal(pkg.Workspaces, &object); err != nil {
+			return nil, fmt.Errorf("npm: unable to unmarshal workspaces in package.json: %w", err)
+		}
+		patterns = object.Packages
+	}
+	workspaces := map[string]*localPackage{}
+	s := &session{in: in, dir: dir}
+	for _, pattern := range patterns {
+		pattern = "./" + strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+		if !isGlob(pattern) {
+			pkg, err := in.readLocalPackage(filepath.Join(dir, pattern))
+			if err != nil {
+				return nil, fmt.Errorf("npm: unable to read workspace %s: %w", pattern, err)
+			}
+			workspaces[pkg.Name] = pkg
+			continue
+		}
+		group, err := s.resolveLocalGlob(pattern)
+		if err != nil {
+			return nil, err
+		} else if len(group.Broken) > 0 {
+			return nil, fmt.Errorf("npm: unable to read workspace %s: %w", pattern, errors.Join(group.Broken...))
+		}
+		for _, pkg := range group.Packages {
+			workspaces[pkg.Name] = pkg
+		}
+	}
+	return workspaces, nil
+}
+
+// findWorkspace finds the workspace package the spec refers to
+func findWorkspace(workspaces map[string]*localPackage, name, spec string) (*localPackage, error) {
+	pkg, ok := workspaces[name]
+	if !ok {
+		return nil, fmt.Errorf("npm: unable to find %s@%s in the workspaces", name, spec)
+	}
+	constraint := strings.TrimPrefix(spec, workspaceProtocol)
+	// workspace:*, workspace:^ and workspace:~ match any version
+	if constraint == "*" || constraint == "^" || constraint == "~" || constraint == "" || pkg.Version == "" {
+		return pkg, nil
+	}
+	checker, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("npm: invalid workspace version %s for %s: %w", spec, name, err)
+	}
+	version, err := semver.NewVersion(pkg.Version)
+	if err != nil {
+		return nil, fmt.Errorf("npm: invalid version %s for workspace %s: %w", pkg.Version, name, err)
+	}
+	if !checker.Check(version) {
+		return nil, fmt.Errorf("npm: workspace %s is at %s, which doesn't satisfy %s", name, pkg.Version, spec)
+	}
+	return pkg, nil
+}
+
+// workspace resolves a workspace spec to the local package in the session's
+// workspaces
+func (s *session) workspace(name, spec string) (*localPackage, error) {
+	s.workspaceOnce.Do(func() {
+		s.workspaces, s.workspaceErr = s.in.readWorkspaces(s.dir)
+	})
+	if s.workspaceErr != nil {
+		return nil, s.workspaceErr
+	}
+	return findWorkspace(s.workspaces, name, spec)
+}
@@ -0,0 +1,56 @@
+package npm_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livebud/npm"
+	"github.com/matryer/is"
+)
+
+func TestWorkspaceProtocol(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json":            `{"name":"root","workspaces":["packages/*"],"dependencies":{"a":"workspace:*"}}`,
+		"packages/a/package.json": `{"name":"a","version":"1.0.0","main":"index.js","dependencies":{"b":"workspace:^1.0.0"}}`,
+		"packages/a/index.js":     `export const a = "a"`,
+		"packages/b/package.json": `{"name":"b","version":"1.2.0","main":"index.js"}`,
+		"packages/b/index.js":     `export const b = "b"`,
+	}))
+	is.NoErr(npm.Install(ctx, dir))
+	equals(t, filepath.Join(dir, "node_modules", "a", "index.js"), `export const a = "a"`)
+	equals(t, filepath.Join(dir, "node_modules", "b", "index.js"), `export const b = "b"`)
+	tree, err := npm.ResolveTree(ctx, dir)
+	is.NoErr(err)
+	is.Equal(tree.Roots, []string{"a@1.0.0"})
+	is.Equal(tree.Nodes["a@1.0.0"].Dependencies["b"], "b@1.2.0")
+	// The workspace has to satisfy the version
+	dir = t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json":            `{"name":"root","workspaces":{"packages":["packages/b"]},"dependencies":{"b":"workspace:^2.0.0"}}`,
+		"packages/b/package.json": `{"name":"b","version":"1.2.0"}`,
+	}))
+	err = npm.Install(ctx, dir)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "workspace b is at 1.2.0, which doesn't satisfy workspace:^2.0.0"))
+}
+
+func TestAddWorkspace(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	is.NoErr(writeFiles(dir, map[string]string{
+		"package.json":             `{"name":"root","workspaces":["packages/*"]}`,
+		"packages/ui/package.json": `{"name":"ui","version":"1.0.0"}`,
+	}))
+	is.NoErr(npm.Add(context.Background(), dir, "ui@workspace:*"))
+	exists(t, filepath.Join(dir, "node_modules", "ui", "package.json"))
+	// Only the workspace version is saved
+	manifest, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	is.NoErr(err)
+	is.True(strings.Contains(string(manifest), `"ui": "workspace:*"`))
+}